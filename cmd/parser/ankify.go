@@ -1,14 +1,21 @@
 package parser
 
 import (
-	"encoding/csv"
+	"context"
+	"encoding/json"
 	"fmt"
 	"log"
 	"os"
+	"path"
+	"strings"
 	"time"
 
 	"github.com/acrucetta/anki-builder/pkg/ankify"
+	"github.com/acrucetta/anki-builder/pkg/dedupe"
 	"github.com/acrucetta/anki-builder/pkg/docparser"
+	"github.com/acrucetta/anki-builder/pkg/exporter"
+	"github.com/acrucetta/anki-builder/pkg/store"
+	"github.com/acrucetta/anki-builder/pkg/tokenizer"
 	"github.com/spf13/cobra"
 )
 
@@ -16,68 +23,184 @@ var AnkifyCmd = &cobra.Command{
 	Use:     "ankify [file path]",
 	Aliases: []string{"a"},
 	Short:   "Parses a PDF and generates Anki cards",
-	Long: `Parses a PDF and generates Anki cards, which are then printed to the console and saved as a JSON file in your output folder. 
+	Long: `Parses a PDF and generates Anki cards, which are then saved as a CSV file in your output folder.
+	The file starts with header lines that tell Anki the note type, deck, tags and GUID columns, so it imports without setup.
+	Each row holds the question, answer and tags as HTML, followed by the source document, page, chunk and section of the card and its GUID.
+	Sections come from the headings of .md files and web pages and from PDF bookmarks; each card is also tagged with its section name.
 	You may use the flag "type" or "t" to specify the input file type.
-	You may use the flag "page" or "p" to specify the page numbers to parse.
+	You may use the flag "pages" or "p" to specify the page numbers to parse.
 	You may use the flag "tag" or "T" to specify the tags to add to the cards.
-	You may use the flag "cards" or "c" to specify the number of cards to generate per page.`,
+	You may use the flag "cards" or "c" to specify the number of cards to generate per page.
+	You may use the flag "card-type" to write 'basic' question and answer cards, 'cloze' deletion notes ({{c1::...}}),
+	which Anki imports as Cloze notes, or 'multiple-choice' questions, which are also saved as a JSON file next to the CSV.
+	You may use the flag "format" to save a TSV ('tsv') or an Anki package ('apkg') that opens in Anki with a double click, instead of a CSV,
+	or to add the cards to a running Anki with the AnkiConnect add-on ('ankiconnect'), skipping the cards Anki already has.
+	The formats 'json', 'jsonl' and 'markdown' (a note for the Obsidian spaced repetition plugin) are for other tools, as are 'mochi' (a Mochi archive),
+	'supermemo' (Q&A text that SuperMemo and RemNote import) and 'mnemosyne' (Mnemosyne XML), and 'gift', 'moodle' (Moodle XML) and 'qti'
+	(an IMS QTI 2.1 package) turn the cards into quiz questions grouped by document; all formats keep each card's source.
+	You may use the flag "deck" to name the deck (defaults to the document name) and "note-type" to choose the AnkiConnect note type.
+	You may use the flag "provider" to choose the LLM backend: 'openai', 'ollama' or 'llamacpp' (defaults to $ANKIFY_PROVIDER or 'openai').
+	The 'ollama' and 'llamacpp' providers talk to a local server ($OLLAMA_HOST, $LLAMACPP_HOST) and work offline.
+	You may use the flags "base-url", "model", "temperature", "max-tokens" and "seed" to tune the provider,
+	or set the same fields in a JSON file passed with "config" (./ankify.json is read if present).
+	You may use the flag "concurrency" to send several requests to the provider at once, whether for pages, summary chunks or cards.
+	You may use the flags "chunk-tokens" and "chunk-overlap" to control how long pages are split on paragraph, sentence and word boundaries.
+	Long pages are summarized chunk by chunk, and the summaries are summarized again until they fit in a single prompt.
+	You may use the flag "no-summary" to write cards for every chunk instead, so no content is lost.
+	Every run is recorded in a local database with its document, chunks, provider, model, prompt version and cards, and where the cards were exported;
+	use the flag "store" to choose the database, "no-store" to skip it, and the list, show and export commands to read it.
+	Cards too similar to a stored card or to another card of the run are dropped, and each is logged with the card it repeats;
+	use the flag "dedupe-threshold" to set the similarity from which cards are duplicates (1 drops only identical cards) and "no-dedupe" to keep them all.
+	Cards that break the rules of the prompt (empty or too long sides, yes-no questions, "in the text", an answer that repeats its question)
+	are dropped with the reason; use the flag "critic" to also have the provider score each card and rewrite the weak ones,
+	"critic-score" to set the lowest score kept (1 to 5, default is 3) and "no-lint" to keep every card, which cannot be combined with "critic".
+	You may use the flag "semantic-dedupe" to also compare the meaning of cards with the provider's embedding model ("embedding-model"),
+	keeping the best card of each group of cards closer than "semantic-threshold"; the cluster command prints these groups for review.
+	You may use the flag "timeout" to bound the whole run; Ctrl-C also stops the run and saves the cards created so far.`,
 	Args: cobra.ExactArgs(1),
 	Run: func(cmd *cobra.Command, args []string) {
 
 		file_type, _ := cmd.Flags().GetString("type")
-		page_numbers, _ := cmd.Flags().GetIntSlice("page")
+		page_numbers, _ := cmd.Flags().GetIntSlice("pages")
 		card_num, _ := cmd.Flags().GetInt("cards")
 		tag, _ := cmd.Flags().GetString("tag")
+		provider_config, err := providerConfig(cmd)
+		if err != nil {
+			log.Fatal(err)
+		}
 
-		var err error
-		var res map[int]string
-		switch file_type {
-		case "txt":
-			res, err = docparser.ParseTxt(args[0])
-		case "pdf":
-			res, err = docparser.ParsePdf(args[0], page_numbers)
-		case "url":
-			res, err = docparser.ParseUrl(args[0])
-		default:
-			fmt.Println("Flag 'type' must be either 'txt' or 'pdf, defaulting to 'txt'")
+		provider, err := ankify.NewProvider(provider_config)
+		if err != nil {
+			log.Fatal(err)
 		}
 
+		// Stop on Ctrl-C or when the --timeout for the whole run expires,
+		// keeping the cards finished so far.
+		ctx, cancel, err := runContext(cmd)
 		if err != nil {
 			log.Fatal(err)
 		}
+		defer cancel()
 
-		anki_cards, _ := ankify.Ankify(res, card_num)
+		config, err := commandConfig(cmd)
+		if err != nil {
+			log.Fatal(err)
+		}
+		card_type, err := ankify.ParseCardType(stringOption(cmd, "card-type", config.CardType))
+		if err != nil {
+			log.Fatal(err)
+		}
+		output, err := exporter.New(stringOption(cmd, "format", config.Format))
+		if err != nil {
+			log.Fatal(err)
+		}
+		deck_name := stringOption(cmd, "deck", config.Deck)
+		if deck_name == "" {
+			deck_name = deckName(args[0])
+		}
+		no_lint, critic, err := qualityOptions(cmd, config)
+		if err != nil {
+			log.Fatal(err)
+		}
 
-		// Save string as txt using os package
-		// Create file name based on date and time
-		const folder string = "output"
-		var file_name string = time.Now().Format("2006-01-02_15-04-05") + ".csv"
+		res, err := parseDocument(ctx, file_type, args[0], page_numbers)
+		if err != nil {
+			log.Fatal(err)
+		}
 
-		// Create output folder if it doesn't exist
-		if _, err := os.Stat(folder); os.IsNotExist(err) {
-			os.Mkdir(folder, 0755)
+		ankifier := ankify.NewAnkifier(provider)
+		ankifier.Document = args[0]
+		ankifier.CardType = card_type
+		ankifier.Tokenizer = tokenizer.ForModel(provider_config.Model)
+		ankifier.Concurrency = intOption(cmd, "concurrency", config.Concurrency)
+		ankifier.ChunkTokens = intOption(cmd, "chunk-tokens", config.ChunkTokens)
+		ankifier.ChunkOverlap = intOption(cmd, "chunk-overlap", config.ChunkOverlap)
+		ankifier.SkipSummary = config.SkipSummary
+		ankifier.Critic = critic
+		ankifier.CriticScore = intOption(cmd, "critic-score", config.CriticScore)
+		ankifier.Markdown = isMarkdown(file_type, args[0])
+		if cmd.Flags().Changed("no-summary") {
+			ankifier.SkipSummary, _ = cmd.Flags().GetBool("no-summary")
 		}
 
-		// Create file path
-		file_name = folder + "/" + file_name
+		// Use the PDF bookmarks, if any, as the section of each page
+		if file_type == "pdf" {
+			bookmarks, err := docparser.ParsePdfOutline(ctx, args[0])
+			if err != nil {
+				log.Printf("Could not read the PDF outline, cards will have no section: %v", err)
+			}
+			ankifier.PageSections = docparser.PageSections(bookmarks, page_numbers)
+		}
 
-		// Create txt file
-		file, err := os.OpenFile(file_name, os.O_CREATE|os.O_WRONLY, 0644)
+		// Record the run, the chunks sent to the model and the cards in the store
+		card_store, run_id := startRun(cmd, config, store.Run{
+			Document:      args[0],
+			FileType:      file_type,
+			Provider:      provider.Name(),
+			Model:         ankify.ProviderModel(provider),
+			PromptVersion: ankify.PromptVersion(card_type),
+			CardType:      card_type,
+		})
+		if card_store != nil {
+			defer card_store.Close()
+			ankifier.OnChunk = func(source ankify.Source, text string) {
+				if err := card_store.AddChunk(run_id, source, text); err != nil {
+					log.Printf("Could not store chunk %d of page %d: %v", source.Chunk, source.Page, err)
+				}
+			}
+		}
 
+		anki_cards, err := ankifier.Ankify(ctx, res, card_num)
 		if err != nil {
-			log.Fatal(err)
+			log.Printf("Some cards could not be created: %v", err)
+			log.Printf("Saving the %d cards that were created.", len(anki_cards.Questions))
 		}
 
-		// Create a new CSV writer
-		writer := csv.NewWriter(file)
+		for i, card := range anki_cards.Questions {
+			anki_cards.Questions[i].Tag = strings.TrimSpace(tag + " " + card.Tag)
+		}
+		if !no_lint {
+			anki_cards.Questions = validateCards(ctx, ankifier, anki_cards.Questions)
+		}
+		var card_vectors [][]float64
+		anki_cards.Questions, card_vectors = dedupeCards(ctx, cmd, config, provider, card_store, anki_cards.Questions)
 
-		// Write the data rows based on the AnkiQuestion struct
-		for _, card := range anki_cards.Questions {
-			writer.Write([]string{card.Question, card.Answer, tag})
+		var card_ids []int64
+		if card_store != nil {
+			card_ids, err = card_store.AddCards(run_id, anki_cards.Questions)
+			if err != nil {
+				log.Printf("Could not store the cards: %v", err)
+			}
+		}
+		if card_ids != nil && card_vectors != nil {
+			vectors := map[int64][]float64{}
+			for i, id := range card_ids {
+				vectors[id] = card_vectors[i]
+			}
+			if err := card_store.AddEmbeddings(embeddingKey(provider), vectors); err != nil {
+				log.Printf("Could not store the embeddings: %v", err)
+			}
+		}
+
+		file_name, exported, err := exportCards(output, anki_cards.Questions, exporter.Options{
+			Deck:     deck_name,
+			NoteType: stringOption(cmd, "note-type", config.NoteType),
+		})
+		if err != nil {
+			log.Fatal(err)
+		}
+		if card_store != nil && card_ids != nil {
+			if err := card_store.MarkExported(exportedIDs(card_ids, exported), output.Name(), exportDestination(output, file_name, deck_name)); err != nil {
+				log.Printf("Could not record the export in the store: %v", err)
+			}
 		}
 
-		// Flush the writer
-		writer.Flush()
+		// Save multiple-choice cards as JSON too, for quiz tools
+		if card_type == ankify.CARD_TYPE_MULTIPLE_CHOICE && output.Extension() != ".json" {
+			if err := saveQuiz(anki_cards.Questions, file_name); err != nil {
+				log.Fatal(err)
+			}
+		}
 	},
 }
 
@@ -88,4 +211,218 @@ func init() {
 	AnkifyCmd.Flags().IntSliceP("pages", "p", []int{1}, "Page numbers to parse, e.g., '1,2,3' (default is 1)")
 	AnkifyCmd.Flags().StringP("tag", "T", "", "Tags to add to the cards, e.g., 'tag1' (default is no tags)")
 	AnkifyCmd.Flags().IntVarP(&card_num, "cards", "c", 5, "Number of cards to generate per page (default is 1)")
+	AnkifyCmd.Flags().String("card-type", string(ankify.CARD_TYPE_BASIC), "Type of cards to write, either 'basic', 'cloze' or 'multiple-choice'")
+	AnkifyCmd.Flags().String("format", "csv", "Output format, one of "+strings.Join(exporter.FORMATS, ", ")+"; 'apkg' is an Anki package and 'ankiconnect' a running Anki")
+	AnkifyCmd.Flags().String("deck", "", "Name of the Anki deck the cards are imported into, e.g. 'Books::SICP' (default is the document name)")
+	AnkifyCmd.Flags().String("note-type", "", "Anki note type for 'ankiconnect' (default is 'Basic', or 'Cloze' for cloze cards)")
+	AnkifyCmd.Flags().Int("concurrency", 1, "Number of requests sent to the provider at once")
+	AnkifyCmd.Flags().Int("chunk-tokens", ankify.MAX_CARD_TOKENS, "Token budget of each chunk when a page is too long for one request")
+	AnkifyCmd.Flags().Int("chunk-overlap", 0, "Number of tokens repeated between consecutive chunks")
+	AnkifyCmd.Flags().String("store", "", "Path of the database that records runs and cards (default is $ANKIFY_STORE or '"+store.DEFAULT_STORE_PATH+"')")
+	AnkifyCmd.Flags().Bool("no-store", false, "Do not record the run in the store")
+	AnkifyCmd.Flags().Float64("dedupe-threshold", dedupe.DEFAULT_THRESHOLD, "Similarity, between 0 and 1, from which a card is dropped as a duplicate of a stored card or another card of the run")
+	AnkifyCmd.Flags().Bool("no-dedupe", false, "Keep cards that duplicate earlier ones")
+	AnkifyCmd.Flags().Bool("no-lint", false, "Keep cards that break the rules of the prompt")
+	AnkifyCmd.Flags().Bool("critic", false, "Have the provider score each card and rewrite or drop the weak ones")
+	AnkifyCmd.Flags().Int("critic-score", ankify.DEFAULT_CRITIC_SCORE, "Lowest critic score, from 1 to 5, a card is kept with unchanged")
+	AnkifyCmd.Flags().Bool("semantic-dedupe", false, "Also drop cards that mean the same as a stored card or another card of the run, comparing their embeddings")
+	AnkifyCmd.Flags().Float64("semantic-threshold", dedupe.DEFAULT_SEMANTIC_THRESHOLD, "Cosine similarity, between 0 and 1, from which cards mean the same thing")
+	AnkifyCmd.Flags().Bool("no-summary", false, "Write cards for every chunk of a long page instead of summarizing it; 'cards' then applies to each chunk")
+	addProviderFlags(AnkifyCmd)
+}
+
+// isMarkdown reports whether a document's headings are Markdown: web pages,
+// whose HTML headings docparser writes as Markdown, and .md text files.
+func isMarkdown(file_type string, document string) bool {
+	switch file_type {
+	case "url":
+		return true
+	case "txt":
+		extension := strings.ToLower(path.Ext(document))
+		return extension == ".md" || extension == ".markdown"
+	}
+	return false
+}
+
+// parseDocument reads the pages of a 'txt', 'pdf' or 'url' document.
+func parseDocument(ctx context.Context, file_type string, path string, page_numbers []int) (map[int]string, error) {
+	switch file_type {
+	case "txt":
+		return docparser.ParseTxt(path)
+	case "pdf":
+		return docparser.ParsePdf(ctx, path, page_numbers)
+	case "url":
+		return docparser.ParseUrl(ctx, path)
+	default:
+		return nil, fmt.Errorf("flag 'type' must be either 'txt', 'pdf' or 'url', got %q", file_type)
+	}
+}
+
+// qualityOptions reads --no-lint and --critic, which cannot be combined: the
+// critic rewrites cards to pass the lint rules.
+func qualityOptions(cmd *cobra.Command, config Config) (bool, bool, error) {
+	no_lint, critic := config.NoLint, config.Critic
+	if cmd.Flags().Changed("no-lint") {
+		no_lint, _ = cmd.Flags().GetBool("no-lint")
+	}
+	if cmd.Flags().Changed("critic") {
+		critic, _ = cmd.Flags().GetBool("critic")
+	}
+	if no_lint && critic {
+		return false, false, fmt.Errorf("'no-lint' and 'critic' cannot be used together, the critic checks cards against the lint rules")
+	}
+	return no_lint, critic, nil
+}
+
+// validateCards drops the cards that break the lint rules or, with the
+// critic on, score too low and cannot be rewritten, logging each with the
+// reason.
+func validateCards(ctx context.Context, ankifier *ankify.Ankifier, cards []ankify.AnkiQuestion) []ankify.AnkiQuestion {
+	tokens := ankifier.Usage.TotalTokens
+	kept, rejections, err := ankifier.Validate(ctx, cards)
+	if err != nil {
+		log.Printf("Some cards were only linted: %v", err)
+	}
+	for _, rejection := range rejections {
+		log.Printf("Dropped %s", rejection)
+	}
+	if len(rejections) > 0 {
+		log.Printf("Dropped %d cards that break the card rules, kept %d.", len(rejections), len(kept))
+	}
+	if ankifier.Critic {
+		log.Printf("The critic used %d tokens.", ankifier.Usage.TotalTokens-tokens)
+	}
+	return kept
+}
+
+// dedupeCards drops the cards that repeat a card of the store or an earlier
+// card of the list, logging the card each one repeats. With semantic
+// deduplication on, it also drops the cards that mean the same as another
+// and returns the embeddings of the cards kept.
+func dedupeCards(ctx context.Context, cmd *cobra.Command, config Config, provider ankify.Provider, card_store *store.Store, cards []ankify.AnkiQuestion) ([]ankify.AnkiQuestion, [][]float64) {
+	no_dedupe := config.NoDedupe
+	if cmd.Flags().Changed("no-dedupe") {
+		no_dedupe, _ = cmd.Flags().GetBool("no-dedupe")
+	}
+	if no_dedupe {
+		return cards, nil
+	}
+	threshold, _ := cmd.Flags().GetFloat64("dedupe-threshold")
+	if !cmd.Flags().Changed("dedupe-threshold") && config.DedupeThreshold > 0 {
+		threshold = config.DedupeThreshold
+	}
+
+	deduper := dedupe.NewDeduper(threshold)
+	if card_store != nil {
+		stored, err := card_store.Cards(store.CardFilter{})
+		if err != nil {
+			log.Printf("Could not read the stored cards, only this run is deduplicated: %v", err)
+		}
+		for _, card := range stored {
+			deduper.Add(card.ID, card.AnkiQuestion)
+		}
+	}
+	kept, duplicates := deduper.Filter(cards)
+	for _, duplicate := range duplicates {
+		log.Printf("Dropped %s", duplicate)
+	}
+	if len(duplicates) > 0 {
+		log.Printf("Dropped %d duplicate cards, kept %d.", len(duplicates), len(kept))
+	}
+
+	semantic := config.SemanticDedupe
+	if cmd.Flags().Changed("semantic-dedupe") {
+		semantic, _ = cmd.Flags().GetBool("semantic-dedupe")
+	}
+	if !semantic {
+		return kept, nil
+	}
+	semantic_threshold, _ := cmd.Flags().GetFloat64("semantic-threshold")
+	if !cmd.Flags().Changed("semantic-threshold") && config.SemanticThreshold > 0 {
+		semantic_threshold = config.SemanticThreshold
+	}
+	if _, ok := provider.(ankify.EmbeddingProvider); !ok {
+		log.Printf("%s cannot embed cards, skipping semantic deduplication.", provider.Name())
+		return kept, nil
+	}
+	return semanticDedupe(ctx, provider, card_store, semantic_threshold, kept)
+}
+
+// OUTPUT_FOLDER holds the files written by the exporters.
+const OUTPUT_FOLDER = "output"
+
+// exportCards exports the cards to a file named after the current time in
+// OUTPUT_FOLDER, or to the exporter's application, and returns the file name
+// without its extension and the indexes of the cards exported; an
+// application may skip some. The export is not cancelled with the run, so the
+// cards created before a Ctrl-C are kept.
+func exportCards(output exporter.Exporter, cards []ankify.AnkiQuestion, options exporter.Options) (string, []int, error) {
+	file_name := OUTPUT_FOLDER + "/" + time.Now().Format("2006-01-02_15-04-05")
+	if output.Extension() != "" {
+		if err := os.MkdirAll(OUTPUT_FOLDER, 0755); err != nil {
+			return "", nil, err
+		}
+		options.Path = file_name + output.Extension()
+	}
+	if partial, ok := output.(exporter.PartialExporter); ok {
+		exported, err := partial.ExportSome(context.Background(), cards, options)
+		return file_name, exported, err
+	}
+	if err := output.Export(context.Background(), cards, options); err != nil {
+		return "", nil, err
+	}
+	if output.Extension() != "" {
+		log.Printf("Saved %d cards to the %q deck in %s.", len(cards), options.Deck, options.Path)
+	}
+	exported := make([]int, len(cards))
+	for i := range exported {
+		exported[i] = i
+	}
+	return file_name, exported, nil
+}
+
+// exportedIDs returns the store ids of the cards at the exported indexes.
+func exportedIDs(card_ids []int64, exported []int) []int64 {
+	ids := make([]int64, 0, len(exported))
+	for _, i := range exported {
+		ids = append(ids, card_ids[i])
+	}
+	return ids
+}
+
+// saveQuiz writes the multiple-choice cards to file_name with a .json
+// extension, creating its folder when the exporter wrote no file.
+func saveQuiz(cards []ankify.AnkiQuestion, file_name string) error {
+	quiz := []ankify.QuizQuestion{}
+	for _, card := range cards {
+		quiz = append(quiz, ankify.NewQuizQuestion(card))
+	}
+	json_data, err := json.MarshalIndent(quiz, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(path.Dir(file_name), 0755); err != nil {
+		return err
+	}
+	return os.WriteFile(file_name+".json", json_data, 0644)
+}
+
+// exportDestination names where exportCards put the cards: the file, or the
+// deck of an application.
+func exportDestination(output exporter.Exporter, file_name string, deck_name string) string {
+	if output.Extension() == "" {
+		return output.Name() + ":" + deck_name
+	}
+	return file_name + output.Extension()
+}
+
+// deckName names a deck after the document it was made from, e.g. "read" for
+// "http://www.paulgraham.com/read.html".
+func deckName(document string) string {
+	name := path.Base(strings.TrimSuffix(document, "/"))
+	name = strings.TrimSuffix(name, path.Ext(name))
+	if name == "" || name == "." || name == "/" {
+		return exporter.DEFAULT_DECK_NAME
+	}
+	return name
 }
@@ -0,0 +1,124 @@
+package parser
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+
+	"github.com/acrucetta/anki-builder/pkg/ankify"
+	"github.com/acrucetta/anki-builder/pkg/exporter"
+	"github.com/spf13/cobra"
+)
+
+// fakeAnkiConnect answers canAddNotes and addNotes with can_add and ids.
+func fakeAnkiConnect(can_add []bool, ids []interface{}) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var request struct{ Action string }
+		json.NewDecoder(r.Body).Decode(&request)
+		var result interface{} = 1
+		switch request.Action {
+		case "modelFieldNames":
+			result = []string{"Front", "Back"}
+		case "canAddNotes":
+			result = can_add
+		case "addNotes":
+			result = ids
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{"result": result, "error": nil})
+	}))
+}
+
+func TestExportCardsMarksOnlyAddedCards(t *testing.T) {
+
+	// Arrange
+	server := fakeAnkiConnect([]bool{false, true, true}, []interface{}{1000, nil})
+	defer server.Close()
+
+	output := exporter.NewAnkiConnect("Go")
+	output.URL = server.URL
+	cards := []ankify.AnkiQuestion{
+		{Question: "What is Go?", Answer: "A language"},
+		{Question: "Who wrote Go?", Answer: "Pike"},
+		{Question: "When was Go released?", Answer: "2009"},
+	}
+
+	// Act
+	_, exported, err := exportCards(output, cards, exporter.Options{Deck: "Go"})
+
+	// Assert
+	if err != nil {
+		t.Fatal(err)
+	}
+	ids := exportedIDs([]int64{7, 8, 9}, exported)
+	if len(ids) != 1 || ids[0] != 8 {
+		t.Errorf("Expected only card 8 to be marked exported, got %v", ids)
+	}
+}
+
+func TestSaveQuizAfterAnkiConnectExport(t *testing.T) {
+
+	// Arrange
+	server := fakeAnkiConnect([]bool{true}, []interface{}{1000})
+	defer server.Close()
+
+	directory, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chdir(t.TempDir()); err != nil {
+		t.Fatal(err)
+	}
+	defer os.Chdir(directory)
+
+	output := exporter.NewAnkiConnect("Go")
+	output.URL = server.URL
+	cards := []ankify.AnkiQuestion{{
+		Question: "Which keyword starts a goroutine?",
+		Answer:   "go",
+		Type:     ankify.CARD_TYPE_MULTIPLE_CHOICE,
+		Choices:  &ankify.MultipleChoice{Distractors: []string{"defer", "chan", "select"}},
+	}}
+
+	// Act
+	file_name, _, err := exportCards(output, cards, exporter.Options{Deck: "Go"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = saveQuiz(cards, file_name)
+
+	// Assert
+	if err != nil {
+		t.Fatalf("Expected the quiz to be saved without an output folder, got %v", err)
+	}
+	json_data, err := os.ReadFile(file_name + ".json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var quiz []ankify.QuizQuestion
+	if err := json.Unmarshal(json_data, &quiz); err != nil || len(quiz) != 1 {
+		t.Errorf("Expected one quiz question, got %s (%v)", json_data, err)
+	}
+}
+
+func TestQualityOptionsRejectsNoLintWithCritic(t *testing.T) {
+
+	// Arrange
+	cmd := &cobra.Command{}
+	cmd.Flags().Bool("no-lint", false, "")
+	cmd.Flags().Bool("critic", false, "")
+	cmd.Flags().Set("no-lint", "true")
+
+	// Act
+	_, _, flags_err := qualityOptions(cmd, Config{Critic: true})
+	no_lint, critic, config_err := qualityOptions(cmd, Config{})
+
+	// Assert
+	if flags_err == nil {
+		t.Error("Expected an error for --no-lint with the config's critic")
+	}
+	if config_err != nil || !no_lint || critic {
+		t.Errorf("Expected --no-lint alone to be accepted, got %v, %v and %v", no_lint, critic, config_err)
+	}
+}
@@ -0,0 +1,191 @@
+package parser
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/acrucetta/anki-builder/pkg/ankify"
+	"github.com/acrucetta/anki-builder/pkg/dedupe"
+	"github.com/acrucetta/anki-builder/pkg/store"
+	"github.com/spf13/cobra"
+)
+
+var ClusterCmd = &cobra.Command{
+	Use:   "cluster",
+	Short: "Groups recorded cards that mean the same thing",
+	Long: `Embeds the cards recorded in the store with the provider's embedding model and prints the groups of cards
+	that mean the same thing, marking with '*' the card to keep in each: the one most similar to the others.
+	Embeddings are kept in the store, so only new cards are sent to the provider.
+	You may use the flag "threshold" to set the cosine similarity from which cards are grouped (default is 0.9),
+	"since", "run" and "document" to choose the cards, and "all" to print the cards without duplicates too.
+	You may use the provider flags of the ankify command, "embedding-model" to choose the embedding model,
+	and "store" to choose the database.`,
+	Args: cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		since_value, _ := cmd.Flags().GetString("since")
+		run_id, _ := cmd.Flags().GetInt64("run")
+		document, _ := cmd.Flags().GetString("document")
+		threshold, _ := cmd.Flags().GetFloat64("threshold")
+		all, _ := cmd.Flags().GetBool("all")
+		filter := store.CardFilter{RunID: run_id, Document: document}
+		if since_value != "" {
+			var err error
+			if filter.Since, err = parseSince(since_value, time.Now()); err != nil {
+				log.Fatal(err)
+			}
+		}
+
+		provider_config, err := providerConfig(cmd)
+		if err != nil {
+			log.Fatal(err)
+		}
+		provider, err := ankify.NewProvider(provider_config)
+		if err != nil {
+			log.Fatal(err)
+		}
+		embedder, ok := provider.(ankify.EmbeddingProvider)
+		if !ok {
+			log.Fatalf("%s: %v", provider.Name(), ankify.ErrEmbeddingsUnsupported)
+		}
+		ctx, cancel, err := runContext(cmd)
+		if err != nil {
+			log.Fatal(err)
+		}
+		defer cancel()
+
+		card_store := openStore(cmd)
+		defer card_store.Close()
+		cards, err := card_store.Cards(filter)
+		if err != nil {
+			log.Fatal(err)
+		}
+		if len(cards) == 0 {
+			log.Printf("No cards to cluster.")
+			return
+		}
+		vectors, err := cardVectors(ctx, embedder, card_store, cards)
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		clusters := dedupe.Clusters(store.Questions(cards), vectors, threshold)
+		groups, duplicates := 0, 0
+		for _, cluster := range clusters {
+			if len(cluster.Members) < 2 && !all {
+				continue
+			}
+			groups++
+			duplicates += len(cluster.Members) - 1
+			best := cards[cluster.Best]
+			fmt.Printf("\nGroup %d, %d %s cards:\n", groups, len(cluster.Members), best.Type)
+			for i, member := range cluster.Members {
+				card := cards[member]
+				mark := " "
+				if member == cluster.Best {
+					mark = "*"
+				}
+				fmt.Printf("%s #%d %.2f  %s\n     %s\n     (run %d, %s)\n", mark, card.ID, cluster.Similarity[i], card.Question, card.Answer, card.RunID, card.Source.Document)
+			}
+		}
+		fmt.Printf("\n%d cards in %d groups; keeping the best card of each group would drop %d.\n", len(cards), groups, duplicates)
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(ClusterCmd)
+	ClusterCmd.Flags().String("store", "", "Path of the database that records runs and cards (default is $ANKIFY_STORE or '"+store.DEFAULT_STORE_PATH+"')")
+	ClusterCmd.Flags().Float64("threshold", dedupe.DEFAULT_SEMANTIC_THRESHOLD, "Cosine similarity, between 0 and 1, from which cards are grouped")
+	ClusterCmd.Flags().String("since", "", "Cluster the cards created since a date, time or duration, e.g. '2026-10-01' or '7d' (default is all cards)")
+	ClusterCmd.Flags().Int64("run", 0, "Cluster the cards of this run only")
+	ClusterCmd.Flags().String("document", "", "Cluster the cards written from this document only")
+	ClusterCmd.Flags().Bool("all", false, "Print the cards that have no duplicate too")
+	addProviderFlags(ClusterCmd)
+}
+
+// embeddingKey names the embeddings of a provider in the store, so vectors
+// of different models are never compared.
+func embeddingKey(provider ankify.Provider) string {
+	return provider.Name() + "/" + ankify.EmbeddingModel(provider)
+}
+
+// cardVectors returns the embedding of each stored card, reading it from the
+// store if it was computed before and saving the new ones.
+func cardVectors(ctx context.Context, embedder ankify.EmbeddingProvider, card_store *store.Store, cards []store.Card) ([][]float64, error) {
+	key := embeddingKey(embedder)
+	cached, err := card_store.Embeddings(key, store.IDs(cards))
+	if err != nil {
+		return nil, err
+	}
+	missing := []store.Card{}
+	for _, card := range cards {
+		if _, ok := cached[card.ID]; !ok {
+			missing = append(missing, card)
+		}
+	}
+	if len(missing) > 0 {
+		log.Printf("Embedding %d cards with %s.", len(missing), key)
+		vectors, _, err := dedupe.Embed(ctx, embedder, store.Questions(missing))
+		if err != nil {
+			return nil, err
+		}
+		computed := map[int64][]float64{}
+		for i, card := range missing {
+			computed[card.ID] = vectors[i]
+			cached[card.ID] = vectors[i]
+		}
+		if err := card_store.AddEmbeddings(key, computed); err != nil {
+			log.Printf("Could not store the embeddings: %v", err)
+		}
+	}
+
+	vectors := [][]float64{}
+	for _, card := range cards {
+		vectors = append(vectors, cached[card.ID])
+	}
+	return vectors, nil
+}
+
+// semanticDedupe drops the new cards that mean the same as a stored card or
+// another new card, keeping the best card of each group, and returns the
+// cards kept with their embeddings. Errors are logged and every card is kept,
+// with nil embeddings.
+func semanticDedupe(ctx context.Context, provider ankify.Provider, card_store *store.Store, threshold float64, cards []ankify.AnkiQuestion) ([]ankify.AnkiQuestion, [][]float64) {
+	embedder, ok := provider.(ankify.EmbeddingProvider)
+	if !ok || len(cards) == 0 {
+		return cards, nil
+	}
+	vectors, _, err := dedupe.Embed(ctx, embedder, cards)
+	if err != nil {
+		log.Printf("Could not embed the cards, skipping semantic deduplication: %v", err)
+		return cards, nil
+	}
+
+	stored := []store.Card{}
+	stored_vectors := [][]float64{}
+	if card_store != nil {
+		if stored, err = card_store.Cards(store.CardFilter{}); err == nil {
+			stored_vectors, err = cardVectors(ctx, embedder, card_store, stored)
+		}
+		if err != nil {
+			log.Printf("Could not embed the stored cards, only this run is deduplicated: %v", err)
+			stored, stored_vectors = nil, nil
+		}
+	}
+
+	kept, duplicates := dedupe.SemanticFilter(store.Questions(stored), store.IDs(stored), stored_vectors, cards, vectors, threshold)
+	for _, duplicate := range duplicates {
+		log.Printf("Dropped %s", duplicate)
+	}
+	if len(duplicates) > 0 {
+		log.Printf("Dropped %d cards that mean the same as another, kept %d.", len(duplicates), len(kept))
+	}
+	kept_cards := []ankify.AnkiQuestion{}
+	kept_vectors := [][]float64{}
+	for _, i := range kept {
+		kept_cards = append(kept_cards, cards[i])
+		kept_vectors = append(kept_vectors, vectors[i])
+	}
+	return kept_cards, kept_vectors
+}
@@ -0,0 +1,189 @@
+package parser
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/acrucetta/anki-builder/pkg/ankify"
+	"github.com/spf13/cobra"
+)
+
+// DEFAULT_CONFIG_FILE is read from the working directory when --config is not given.
+const DEFAULT_CONFIG_FILE = "ankify.json"
+
+// Config mirrors the command line flags so runs can be reproduced from a file, e.g.
+//
+//	{"provider": "openai", "base_url": "http://localhost:8000/v1", "model": "mistral", "temperature": 0, "seed": 42}
+type Config struct {
+	ankify.ProviderConfig
+	// Timeout bounds the whole run, e.g. "30m".
+	Timeout ankify.Duration `json:"timeout"`
+	// Concurrency is the number of requests sent to the provider at once.
+	Concurrency int `json:"concurrency"`
+	// ChunkTokens and ChunkOverlap control how long pages are split.
+	ChunkTokens  int `json:"chunk_tokens"`
+	ChunkOverlap int `json:"chunk_overlap"`
+	// SkipSummary writes cards for every chunk instead of summarizing long pages.
+	SkipSummary bool `json:"skip_summary"`
+	// CardType is "basic", "cloze" or "multiple-choice".
+	CardType string `json:"card_type"`
+	// Format names the exporter, and Deck the deck the cards go to.
+	// NoteType is the AnkiConnect note type.
+	Format   string `json:"format"`
+	Deck     string `json:"deck"`
+	NoteType string `json:"note_type"`
+	// Store is the path of the run database, and NoStore skips recording runs.
+	Store   string `json:"store"`
+	NoStore bool   `json:"no_store"`
+	// DedupeThreshold is the similarity from which a card is a duplicate,
+	// and NoDedupe keeps duplicate cards.
+	DedupeThreshold float64 `json:"dedupe_threshold"`
+	NoDedupe        bool    `json:"no_dedupe"`
+	// NoLint keeps the cards that break the card rules, and Critic has the
+	// provider review them, keeping those scoring at least CriticScore.
+	NoLint      bool `json:"no_lint"`
+	Critic      bool `json:"critic"`
+	CriticScore int  `json:"critic_score"`
+	// SemanticDedupe also drops cards whose embeddings are at least
+	// SemanticThreshold similar to another card's.
+	SemanticDedupe    bool    `json:"semantic_dedupe"`
+	SemanticThreshold float64 `json:"semantic_threshold"`
+}
+
+// LoadConfig reads a JSON config file. A missing default config file is not an error.
+func LoadConfig(path string) (Config, error) {
+	var config Config
+	if path == "" {
+		path = DEFAULT_CONFIG_FILE
+		if _, err := os.Stat(path); os.IsNotExist(err) {
+			return config, nil
+		}
+	}
+
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return config, err
+	}
+	err = json.Unmarshal(data, &config)
+	return config, err
+}
+
+// providerConfig loads the config file and overrides it with any provider flags set on cmd.
+func providerConfig(cmd *cobra.Command) (ankify.ProviderConfig, error) {
+	config, err := commandConfig(cmd)
+	if err != nil {
+		return ankify.ProviderConfig{}, err
+	}
+	provider_config := config.ProviderConfig
+
+	if provider_config.Provider == "" {
+		provider_config.Provider = os.Getenv("ANKIFY_PROVIDER")
+	}
+	flags := cmd.Flags()
+	if flags.Changed("provider") {
+		provider_config.Provider, _ = flags.GetString("provider")
+	}
+	if flags.Changed("base-url") {
+		provider_config.BaseURL, _ = flags.GetString("base-url")
+	}
+	if flags.Changed("model") {
+		provider_config.Model, _ = flags.GetString("model")
+	}
+	if flags.Changed("embedding-model") {
+		provider_config.EmbeddingModel, _ = flags.GetString("embedding-model")
+	}
+	if flags.Changed("temperature") {
+		temperature, _ := flags.GetFloat64("temperature")
+		provider_config.Temperature = &temperature
+	}
+	if flags.Changed("max-tokens") {
+		provider_config.MaxTokens, _ = flags.GetInt("max-tokens")
+	}
+	if flags.Changed("seed") {
+		seed, _ := flags.GetInt("seed")
+		provider_config.Seed = &seed
+	}
+	if flags.Changed("max-retries") {
+		max_retries, _ := flags.GetInt("max-retries")
+		provider_config.MaxRetries = &max_retries
+	}
+	if flags.Changed("retry-budget") {
+		retry_budget, _ := flags.GetInt("retry-budget")
+		provider_config.RetryBudget = &retry_budget
+	}
+	if flags.Changed("request-timeout") {
+		request_timeout, _ := flags.GetDuration("request-timeout")
+		provider_config.RequestTimeout = ankify.Duration(request_timeout)
+	}
+	return provider_config, nil
+}
+
+// addProviderFlags registers the flags read by providerConfig.
+func addProviderFlags(cmd *cobra.Command) {
+	cmd.Flags().String("config", "", "Path to a JSON config file (default is ./"+DEFAULT_CONFIG_FILE+" if it exists)")
+	cmd.Flags().String("provider", "", "LLM provider used to generate the cards, 'openai', 'ollama' or 'llamacpp' (default is $ANKIFY_PROVIDER or 'openai')")
+	cmd.Flags().String("base-url", "", "Base URL of an OpenAI-compatible API or local server, e.g., 'http://localhost:8000/v1'")
+	cmd.Flags().String("model", "", "Model name, e.g., 'gpt-4o-mini' or 'llama3' (default depends on the provider)")
+	cmd.Flags().String("embedding-model", "", "Model that embeds cards for semantic deduplication, e.g. 'nomic-embed-text' (default depends on the provider)")
+	cmd.Flags().Float64("temperature", 0, "Sampling temperature (default is the provider's default)")
+	cmd.Flags().Int("max-tokens", 0, "Maximum number of tokens per completion (default is the provider's default)")
+	cmd.Flags().Int("seed", 0, "Sampling seed for reproducible runs, where the provider supports it")
+	cmd.Flags().Int("max-retries", 4, "Retries per request on rate limits, server and network errors")
+	cmd.Flags().Int("retry-budget", 20, "Maximum number of retries for the whole run, 0 for no limit")
+	cmd.Flags().Duration("request-timeout", 2*time.Minute, "Timeout for each request to the provider")
+	cmd.Flags().Duration("timeout", 0, "Timeout for the whole run, e.g., '30m' (default is no timeout)")
+}
+
+// commandConfig loads the config file named by the --config flag of cmd.
+func commandConfig(cmd *cobra.Command) (Config, error) {
+	config_path, _ := cmd.Flags().GetString("config")
+	return LoadConfig(config_path)
+}
+
+// intOption returns the named int flag if it was set, else config_value if
+// it is positive, else the flag's default.
+func intOption(cmd *cobra.Command, name string, config_value int) int {
+	value, _ := cmd.Flags().GetInt(name)
+	if !cmd.Flags().Changed(name) && config_value > 0 {
+		return config_value
+	}
+	return value
+}
+
+// stringOption returns the named string flag if it was set, else
+// config_value if it is not empty, else the flag's default.
+func stringOption(cmd *cobra.Command, name string, config_value string) string {
+	value, _ := cmd.Flags().GetString(name)
+	if !cmd.Flags().Changed(name) && config_value != "" {
+		return config_value
+	}
+	return value
+}
+
+// runContext returns a context cancelled on SIGINT/SIGTERM and, if set through
+// --timeout or the config file, when the run timeout expires.
+func runContext(cmd *cobra.Command) (context.Context, context.CancelFunc, error) {
+	config, err := commandConfig(cmd)
+	if err != nil {
+		return nil, nil, err
+	}
+	timeout := time.Duration(config.Timeout)
+	if cmd.Flags().Changed("timeout") {
+		timeout, _ = cmd.Flags().GetDuration("timeout")
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	if timeout <= 0 {
+		return ctx, stop, nil
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	return ctx, func() {
+		cancel()
+		stop()
+	}, nil
+}
@@ -1,6 +1,7 @@
 package parser
 
 import (
+	"context"
 	"fmt"
 
 	"github.com/acrucetta/anki-builder/pkg/docparser"
@@ -13,7 +14,7 @@ var ParseCmd = &cobra.Command{
 	Short:   "Parses a PDF and generates Anki cards",
 	Args:    cobra.ExactArgs(1),
 	Run: func(cmd *cobra.Command, args []string) {
-		res, err := docparser.ParsePdf(args[0], []int{1})
+		res, err := docparser.ParsePdf(context.Background(), args[0], []int{1})
 		if err != nil {
 			fmt.Println(err)
 		}
@@ -0,0 +1,244 @@
+package parser
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/acrucetta/anki-builder/pkg/exporter"
+	"github.com/acrucetta/anki-builder/pkg/store"
+	"github.com/spf13/cobra"
+)
+
+var ListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "Lists the recorded ankify runs",
+	Long: `Lists the ankify runs recorded in the store, most recent first, with their document, provider, model,
+	prompt version and how many of their cards were exported.
+	You may use the flag "store" to choose the database.`,
+	Args: cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		card_store := openStore(cmd)
+		defer card_store.Close()
+
+		runs, err := card_store.Runs()
+		if err != nil {
+			log.Fatal(err)
+		}
+		writer := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+		fmt.Fprintln(writer, "RUN\tSTARTED\tDOCUMENT\tPROVIDER\tMODEL\tPROMPT\tTYPE\tCARDS\tEXPORTED")
+		for _, run := range runs {
+			fmt.Fprintf(writer, "%d\t%s\t%s\t%s\t%s\t%s\t%s\t%d\t%d\n",
+				run.ID, run.StartedAt.Local().Format("2006-01-02 15:04"), run.Document, run.Provider, run.Model,
+				run.PromptVersion, run.CardType, run.Cards, run.Exported)
+		}
+		writer.Flush()
+	},
+}
+
+var ShowCmd = &cobra.Command{
+	Use:   "show [run id]",
+	Short: "Shows a recorded run with its cards",
+	Long: `Shows a run recorded in the store: its settings, the chunks sent to the model and every card with its
+	source and exports.
+	You may use the flag "chunks" to print the text of the chunks too, and "store" to choose the database.`,
+	Args: cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		run_id, err := strconv.ParseInt(args[0], 10, 64)
+		if err != nil {
+			log.Fatalf("run id must be a number, got %q", args[0])
+		}
+		show_chunks, _ := cmd.Flags().GetBool("chunks")
+		card_store := openStore(cmd)
+		defer card_store.Close()
+
+		run, err := card_store.Run(run_id)
+		if err != nil {
+			log.Fatal(err)
+		}
+		chunks, err := card_store.Chunks(run_id)
+		if err != nil {
+			log.Fatal(err)
+		}
+		cards, err := card_store.Cards(store.CardFilter{RunID: run_id})
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		fmt.Printf("Run %d, started %s\n", run.ID, run.StartedAt.Local().Format("2006-01-02 15:04:05"))
+		fmt.Printf("Document: %s (%s)\n", run.Document, run.FileType)
+		fmt.Printf("Provider: %s, model %s, prompt version %s, %s cards\n", run.Provider, run.Model, run.PromptVersion, run.CardType)
+		fmt.Printf("Chunks: %d, cards: %d, exported: %d\n", len(chunks), run.Cards, run.Exported)
+		if show_chunks {
+			for _, chunk := range chunks {
+				fmt.Printf("\n--- Page %d, chunk %d", chunk.Source.Page, chunk.Source.Chunk)
+				if chunk.Source.Section != "" {
+					fmt.Printf(", %s", chunk.Source.Section)
+				}
+				fmt.Printf("\n%s\n", strings.TrimSpace(chunk.Text))
+			}
+		}
+		for _, card := range cards {
+			fmt.Printf("\n#%d [%s] page %d, chunk %d", card.ID, card.Type, card.Source.Page, card.Source.Chunk)
+			if card.Source.Section != "" {
+				fmt.Printf(", %s", card.Source.Section)
+			}
+			if card.Tag != "" {
+				fmt.Printf(" (%s)", card.Tag)
+			}
+			fmt.Printf("\nQ: %s\nA: %s\n", card.Question, card.Answer)
+			for _, export := range card.Exports {
+				fmt.Printf("Exported as %s to %s on %s\n", export.Format, export.Destination, export.ExportedAt.Local().Format("2006-01-02 15:04"))
+			}
+		}
+	},
+}
+
+var ExportCmd = &cobra.Command{
+	Use:   "export",
+	Short: "Exports recorded cards again",
+	Long: `Exports cards recorded in the store to any format of the ankify command, and records the export.
+	You may use the flag "since" to export the cards created since a date ('2026-10-01'), a time (RFC 3339)
+	or a while ago ('36h', '7d'), "run" to export the cards of one run, and "unexported" to skip cards exported before.
+	You may use the flags "format", "deck" and "note-type" as with the ankify command, and "store" to choose the database.`,
+	Args: cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		since_value, _ := cmd.Flags().GetString("since")
+		run_id, _ := cmd.Flags().GetInt64("run")
+		unexported, _ := cmd.Flags().GetBool("unexported")
+		config, err := commandConfig(cmd)
+		if err != nil {
+			log.Fatal(err)
+		}
+		output, err := exporter.New(stringOption(cmd, "format", config.Format))
+		if err != nil {
+			log.Fatal(err)
+		}
+		deck_name := stringOption(cmd, "deck", config.Deck)
+		if deck_name == "" {
+			deck_name = exporter.DEFAULT_DECK_NAME
+		}
+		filter := store.CardFilter{RunID: run_id, Unexported: unexported}
+		if since_value != "" {
+			if filter.Since, err = parseSince(since_value, time.Now()); err != nil {
+				log.Fatal(err)
+			}
+		}
+
+		card_store := openStore(cmd)
+		defer card_store.Close()
+		cards, err := card_store.Cards(filter)
+		if err != nil {
+			log.Fatal(err)
+		}
+		if len(cards) == 0 {
+			log.Printf("No cards to export.")
+			return
+		}
+
+		file_name, exported, err := exportCards(output, store.Questions(cards), exporter.Options{
+			Deck:     deck_name,
+			NoteType: stringOption(cmd, "note-type", config.NoteType),
+		})
+		if err != nil {
+			log.Fatal(err)
+		}
+		if err := card_store.MarkExported(exportedIDs(store.IDs(cards), exported), output.Name(), exportDestination(output, file_name, deck_name)); err != nil {
+			log.Fatal(err)
+		}
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(ListCmd)
+	rootCmd.AddCommand(ShowCmd)
+	rootCmd.AddCommand(ExportCmd)
+	for _, cmd := range []*cobra.Command{ListCmd, ShowCmd, ExportCmd} {
+		cmd.Flags().String("store", "", "Path of the database that records runs and cards (default is $ANKIFY_STORE or '"+store.DEFAULT_STORE_PATH+"')")
+		cmd.Flags().String("config", "", "Path to a JSON config file (default is ./"+DEFAULT_CONFIG_FILE+" if it exists)")
+	}
+	ShowCmd.Flags().Bool("chunks", false, "Print the text of the chunks sent to the model")
+	ExportCmd.Flags().String("since", "", "Export the cards created since a date, time or duration, e.g. '2026-10-01' or '7d' (default is all cards)")
+	ExportCmd.Flags().Int64("run", 0, "Export the cards of this run only")
+	ExportCmd.Flags().Bool("unexported", false, "Export only the cards that were never exported")
+	ExportCmd.Flags().String("format", "csv", "Output format, one of "+strings.Join(exporter.FORMATS, ", "))
+	ExportCmd.Flags().String("deck", "", "Name of the deck the cards go to (default is '"+exporter.DEFAULT_DECK_NAME+"')")
+	ExportCmd.Flags().String("note-type", "", "Anki note type for 'ankiconnect' (default is 'Basic', or 'Cloze' for cloze cards)")
+}
+
+// storePath returns the --store flag if set, else the config's store, else
+// ANKIFY_STORE, else store.DEFAULT_STORE_PATH.
+func storePath(cmd *cobra.Command, config Config) string {
+	path := stringOption(cmd, "store", config.Store)
+	if path == "" {
+		path = os.Getenv("ANKIFY_STORE")
+	}
+	if path == "" {
+		path = store.DEFAULT_STORE_PATH
+	}
+	return path
+}
+
+// openStore opens the store of a command that reads it, or exits.
+func openStore(cmd *cobra.Command) *store.Store {
+	config, err := commandConfig(cmd)
+	if err != nil {
+		log.Fatal(err)
+	}
+	card_store, err := store.Open(storePath(cmd, config))
+	if err != nil {
+		log.Fatal(err)
+	}
+	return card_store
+}
+
+// startRun opens the store and records the run, unless --no-store or the
+// config turn it off. The cards are still exported when the store cannot be
+// opened, so errors are logged and a nil store is returned.
+func startRun(cmd *cobra.Command, config Config, run store.Run) (*store.Store, int64) {
+	no_store := config.NoStore
+	if cmd.Flags().Changed("no-store") {
+		no_store, _ = cmd.Flags().GetBool("no-store")
+	}
+	if no_store {
+		return nil, 0
+	}
+	card_store, err := store.Open(storePath(cmd, config))
+	if err != nil {
+		log.Printf("Could not open the store, the run will not be recorded: %v", err)
+		return nil, 0
+	}
+	run_id, err := card_store.StartRun(run)
+	if err != nil {
+		log.Printf("Could not record the run in the store: %v", err)
+		card_store.Close()
+		return nil, 0
+	}
+	return card_store, run_id
+}
+
+var sinceDays = regexp.MustCompile(`^(\d+)d$`)
+
+// parseSince reads a --since value: a date, an RFC 3339 time, or a duration
+// before now such as "36h" or "7d".
+func parseSince(value string, now time.Time) (time.Time, error) {
+	if match := sinceDays.FindStringSubmatch(value); match != nil {
+		days, _ := strconv.Atoi(match[1])
+		return now.AddDate(0, 0, -days), nil
+	}
+	if duration, err := time.ParseDuration(value); err == nil {
+		return now.Add(-duration), nil
+	}
+	if since, err := time.ParseInLocation("2006-01-02", value, time.Local); err == nil {
+		return since, nil
+	}
+	if since, err := time.Parse(time.RFC3339, value); err == nil {
+		return since, nil
+	}
+	return time.Time{}, fmt.Errorf("flag 'since' must be a date ('2006-01-02'), a time (RFC 3339) or a duration ('36h', '7d'), got %q", value)
+}
@@ -0,0 +1,62 @@
+package parser
+
+import (
+	"fmt"
+	"log"
+	"sort"
+
+	"github.com/acrucetta/anki-builder/pkg/tokenizer"
+	"github.com/spf13/cobra"
+)
+
+var TokensCmd = &cobra.Command{
+	Use:   "tokens [file path]",
+	Short: "Counts the tokens in a document",
+	Long: `Counts the tokens in a document with the tokenizer of the chosen model, page by page.
+	You may use the flags "type", "pages" and "model" as with the ankify command; without "model", the model of the config file is used.`,
+	Args: cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		file_type, _ := cmd.Flags().GetString("type")
+		page_numbers, _ := cmd.Flags().GetIntSlice("pages")
+		config, err := commandConfig(cmd)
+		if err != nil {
+			log.Fatal(err)
+		}
+		model := stringOption(cmd, "model", config.Model)
+
+		ctx, cancel, err := runContext(cmd)
+		if err != nil {
+			log.Fatal(err)
+		}
+		defer cancel()
+
+		res, err := parseDocument(ctx, file_type, args[0], page_numbers)
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		t := tokenizer.ForModel(model)
+		pages := make([]int, 0, len(res))
+		for page := range res {
+			pages = append(pages, page)
+		}
+		sort.Ints(pages)
+
+		total := 0
+		for _, page := range pages {
+			count := t.Count(res[page])
+			total += count
+			fmt.Printf("page %d\t%d\n", page, count)
+		}
+		fmt.Printf("total\t%d (%s)\n", total, t.Name())
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(TokensCmd)
+	TokensCmd.Flags().StringP("type", "t", "txt", "Type of file to parse, either 'txt', 'pdf', or 'url' (default is 'txt')")
+	TokensCmd.Flags().IntSliceP("pages", "p", []int{1}, "Page numbers to parse, e.g., '1,2,3' (default is 1)")
+	TokensCmd.Flags().String("model", "", "Model whose tokenizer is used, e.g., 'gpt-4o' (default is cl100k_base)")
+	TokensCmd.Flags().String("config", "", "Path to a JSON config file (default is ./"+DEFAULT_CONFIG_FILE+" if it exists)")
+	TokensCmd.Flags().Duration("timeout", 0, "Timeout for reading the document, e.g., '1m' (default is no timeout)")
+}
@@ -1,14 +1,17 @@
 package main
 
 import (
+	"log"
+
 	"github.com/acrucetta/anki-builder/cmd/parser"
 	"github.com/joho/godotenv"
 )
 
 func main() {
+	// The .env file is optional: local providers such as Ollama need no API key.
 	err := godotenv.Load(".env")
 	if err != nil {
-		panic(err)
+		log.Printf("No .env file loaded: %v", err)
 	}
 	parser.Execute()
 }
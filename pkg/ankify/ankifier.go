@@ -1,53 +1,18 @@
 package ankify
 
 import (
-	"bytes"
-	"encoding/json"
-	"io/ioutil"
-	"net/http"
-	"os"
+	"context"
+	"fmt"
+	"log"
+	"sort"
 	"strconv"
 	"strings"
+	"sync"
 
-	"log"
+	"github.com/acrucetta/anki-builder/pkg/chunker"
+	"github.com/acrucetta/anki-builder/pkg/tokenizer"
 )
 
-type ResponseBody struct {
-	ID      string   `json:"id"`
-	Object  string   `json:"object"`
-	Created int      `json:"created"`
-	Model   string   `json:"model"`
-	Usage   Usage    `json:"usage"`
-	Choices []Choice `json:"choices"`
-}
-
-type Usage struct {
-	PromptTokens     int `json:"prompt_tokens"`
-	CompletionTokens int `json:"completion_tokens"`
-	TotalTokens      int `json:"total_tokens"`
-}
-
-type Choice struct {
-	Message      ResponseMessage `json:"message"`
-	FinishReason string          `json:"finish_reason"`
-	Index        int             `json:"index"`
-}
-
-type ResponseMessage struct {
-	Role    string `json:"role"`
-	Content string `json:"content"`
-}
-
-type OpenAIRequest struct {
-	Model    string           `json:"model"`
-	Messages []RequestMessage `json:"messages"`
-}
-
-type RequestMessage struct {
-	Role    string `json:"role"`
-	Content string `json:"content"`
-}
-
 type AnkiQuestions struct {
 	Questions []AnkiQuestion `json:"questions"`
 }
@@ -56,9 +21,25 @@ type AnkiQuestion struct {
 	Question string
 	Answer   string
 	Tag      string
+	// Type is the note type of the card, empty for CARD_TYPE_BASIC.
+	Type CardType
+	// Choices holds the options of a CARD_TYPE_MULTIPLE_CHOICE card.
+	Choices *MultipleChoice
+	Source  Source
+}
+
+// Source records where a card came from.
+type Source struct {
+	// Document is the file path or URL that was ankified.
+	Document string `json:"document"`
+	Page     int    `json:"page"`
+	// Section is the heading or PDF bookmark the card's text falls under.
+	Section string `json:"section,omitempty"`
+	// Chunk is the 1-based chunk of the page the card was written from, or 0
+	// when it was written from a summary of the whole page.
+	Chunk int `json:"chunk"`
 }
 
-const API_URL = "https://api.openai.com/v1/chat/completions"
 const QUESTION_HELPER = `You're an AI memorizing assistant. You will help me write Anki questions to retain inforomation in the text through spaced repetition. 
 
 The Anki questions should be:
@@ -70,185 +51,279 @@ The Anki questions should be:
 - Not a yes-no questions
 - Avoid saying "in the text" or "in the passage"
 
-I want you to make {card_num} Anki cards for the following text, give it to me in the following format: 
+I want you to make {card_num} Anki cards for the following text, {format}{section}The text is the following: 
+{text}`
+
+// TEXT_FORMAT_HELPER fills the {format} placeholder of QUESTION_HELPER for
+// providers without structured output; replies are read with ParseAnkiText.
+const TEXT_FORMAT_HELPER = `give it to me in the following format: 
 
 Q: [Insert question here] 
 A: [Insert answer here] 
 \n\n 
 
-The text is the following: 
-{text}`
+`
+
+// SECTION_HELPER fills the {section} placeholder of QUESTION_HELPER when the
+// text comes from a titled section of the document.
+const SECTION_HELPER = `The text comes from the section "{section}" of the document, use it as context for the questions.
+
+`
+
+// MAX_CARD_TOKENS is the token budget for the text sent with QUESTION_HELPER.
+const MAX_CARD_TOKENS = 3000
+
 const SUMMARY_HELPER = `Assume you’re an expert in summarizing text to the most important points of paragraph in a way that retains the original meaning and context of the pragraph, I want you to summarize the following text into less than {summary_size} words with the most unique and helpful points: {text}`
 
-func CallOpenAI(prompt string) (string, error) {
+// SplitTextIntoRequests splits text into requests of at most max_tokens
+// tokens, cutting on paragraph, sentence and word boundaries.
+func SplitTextIntoRequests(text string, max_tokens int) []string {
+	return chunker.Split(text, chunker.Options{MaxTokens: max_tokens})
+}
 
-	// Create a new HTTP client
-	client := &http.Client{}
+// Ankifier turns documents into Anki cards using a Provider.
+type Ankifier struct {
+	Provider Provider
+	// Tokenizer counts tokens for the prompt budgets (default is the cl100k_base encoding).
+	Tokenizer tokenizer.Tokenizer
+	// ChunkTokens is the token budget of each chunk of a page (default is MAX_CARD_TOKENS).
+	ChunkTokens int
+	// ChunkOverlap is the number of tokens repeated between consecutive chunks.
+	ChunkOverlap int
+	// SkipSummary writes cards for every chunk instead of summarizing long
+	// pages first, so no content is lost; cardNum then applies to each chunk.
+	SkipSummary bool
+	// PageSections names the section each page falls under, e.g. from PDF
+	// bookmarks. Markdown headings within a page take precedence.
+	PageSections map[int]string
+	// Markdown splits pages on their Markdown headings, for Markdown files
+	// and web pages; plain text is never split, so a "#" line stays text.
+	Markdown bool
+	// CardType selects the prompt and parser used for the cards (default is CARD_TYPE_BASIC).
+	CardType CardType
+	// Document is recorded as the source of every card, e.g. a file path or URL.
+	Document string
+	// Concurrency is the number of provider calls made at once, whether for
+	// pages, summary chunks or card batches (default is 1).
+	Concurrency int
+	// Usage accumulates the tokens reported by the provider across calls.
+	Usage Usage
+	// OnChunk, if set, is called with the source and text of every chunk
+	// before cards are written from it, one call at a time.
+	OnChunk func(source Source, text string)
+	// Critic has Validate ask the provider to score every card and rewrite
+	// the weak ones; CriticScore is the lowest score kept (default is
+	// DEFAULT_CRITIC_SCORE).
+	Critic      bool
+	CriticScore int
+
+	mu        sync.Mutex
+	text_only bool
+	// calls holds a slot for every provider call in flight; pools nest, so
+	// the bound on Concurrency is kept here rather than by each pool.
+	calls      chan struct{}
+	calls_once sync.Once
+}
 
-	// Create a new request
-	req, err := http.NewRequest("POST", API_URL, nil)
-	if err != nil {
-		log.Fatal(err, os.Stderr)
-		return "", err
+// NewAnkifier returns an Ankifier backed by the given provider.
+func NewAnkifier(provider Provider) *Ankifier {
+	return &Ankifier{
+		Provider:    provider,
+		Concurrency: 1,
+		Tokenizer:   tokenizer.ForModel(""),
+		ChunkTokens: MAX_CARD_TOKENS,
+		CardType:    CARD_TYPE_BASIC,
 	}
+}
 
-	var API_KEY string = os.Getenv("OPENAI_KEY")
-	req.Header.Add("Content-Type", "application/json")
-	req.Header.Add("Authorization", "Bearer "+API_KEY)
+// acquire waits for one of the Concurrency provider call slots, or until
+// ctx is done.
+func (a *Ankifier) acquire(ctx context.Context) error {
+	a.calls_once.Do(func() {
+		concurrency := a.Concurrency
+		if concurrency < 1 {
+			concurrency = 1
+		}
+		a.calls = make(chan struct{}, concurrency)
+	})
+	select {
+	case a.calls <- struct{}{}:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
 
-	// Create a message struct
+// release frees the slot taken by acquire.
+func (a *Ankifier) release() {
+	<-a.calls
+}
+
+// complete sends a single user prompt to the provider and records its usage.
+func (a *Ankifier) complete(ctx context.Context, prompt string) (string, error) {
 	message := RequestMessage{
 		Role:    "user",
 		Content: prompt,
 	}
-
-	json_request := OpenAIRequest{
-		Model:    "gpt-3.5-turbo",
-		Messages: []RequestMessage{message},
-	}
-
-	// Attach the JSON payload to the request body
-	json_data, err := json.Marshal(json_request)
-
-	if err != nil {
-		log.Fatal(err, os.Stderr)
+	if err := a.acquire(ctx); err != nil {
 		return "", err
 	}
-
-	req.Body = ioutil.NopCloser(bytes.NewBuffer(json_data))
-	// Make the request
-	resp, err := client.Do(req)
+	response, usage, err := a.Provider.Complete(ctx, []RequestMessage{message})
+	a.release()
+	a.addUsage(usage)
 	if err != nil {
-		log.Fatal(err, os.Stderr)
 		return "", err
 	}
-	defer resp.Body.Close()
-
-	body, err := ioutil.ReadAll(resp.Body)
+	return response, nil
+}
 
-	if err != nil {
-		log.Fatal(err, os.Stderr)
-		return "", err
-	}
+func (a *Ankifier) addUsage(usage Usage) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.Usage.PromptTokens += usage.PromptTokens
+	a.Usage.CompletionTokens += usage.CompletionTokens
+	a.Usage.TotalTokens += usage.TotalTokens
+}
 
-	// Unmarshal the response body into a struct
-	var response ResponseBody
-	json.Unmarshal(body, &response)
+func SummarizeRequests(ctx context.Context, requests []string, summarySize int) (string, error) {
+	return NewAnkifier(DefaultProvider()).SummarizeRequests(ctx, requests, summarySize)
+}
 
-	// Check if the response is valid
-	if len(response.Choices) > 0 {
-		return response.Choices[0].Message.Content, nil
-	} else {
-		log.Fatal("The error response is: ", string(body))
+// SummarizeRequests summarizes each request, up to Concurrency at a time, and
+// joins the summaries in the order of the requests.
+func (a *Ankifier) SummarizeRequests(ctx context.Context, requests []string, summarySize int) (string, error) {
+	if len(requests) == 0 {
 		return "", nil
 	}
+	if len(requests) == 1 {
+		return requests[0], nil
+	}
+	log.Println("Each summary will be approximately", summarySize, "words.")
+	summaries := make([]string, len(requests))
+	errs := runPool(ctx, a.Concurrency, len(requests), func(i int) error {
+		// Create the summary prompt for the provider
+		summaryPrompt := strings.Replace(SUMMARY_HELPER, "{text}", requests[i], 1)
+		summaryPrompt = strings.Replace(summaryPrompt, "{summary_size}", strconv.Itoa(summarySize), 1)
+		ankiResponse, err := a.complete(ctx, summaryPrompt)
+		if err != nil {
+			return err
+		}
+		// Log the request number using logger
+		log.Printf("Finished processing request %d of %d.", i+1, len(requests))
+		summaries[i] = ankiResponse
+		return nil
+	})
+	for _, err := range errs {
+		if err != nil {
+			return "", err
+		}
+	}
+	return strings.Join(summaries, "\n\n"), nil
 }
 
-// ParseAnkiText parses an Anki text and returns a struct with the questions and answers
-func ParseAnkiText(anki_text string) (AnkiQuestions, error) {
-	/**
-		anki_text: string
-		returns: string
-
-		Example:
-		anki_text = "Q: What is the capital of France? A: Paris; Q: What is the capital of Germany? A: Berlin"
-		anki_cards = ParseAnkiText(anki_text)
-		anki_cards.Questions[0].Question = "What is the capital of France?"
-		anki_cards.Questions[0].Answer = "Paris"
-	**/
-	// Split the text based on "line breaks"
-	anki_cards := AnkiQuestions{}
-
-	// Split the text based on "\n\n")
-	anki_cards_split := strings.Split(anki_text, "\n\n")
-
-	// Loop through the split text and create a new AnkiQuestion for each card
-	for _, card := range anki_cards_split {
-
-		if card == "" {
-			continue
+// MAX_SUMMARY_DEPTH bounds the number of summarize-then-merge rounds in Summarize.
+const MAX_SUMMARY_DEPTH = 5
+
+// MIN_SUMMARY_WORDS is the smallest summary asked for, however many chunks there are.
+const MIN_SUMMARY_WORDS = 50
+
+// Summarize reduces the chunks of a text to a single text that fits in
+// MAX_CARD_TOKENS. Chunks that fit together are joined as they are; otherwise
+// each chunk is summarized, and while the joined summaries are still too long
+// they are chunked and summarized again, so late parts of a long document
+// weigh as much as early ones.
+func (a *Ankifier) Summarize(ctx context.Context, requests []string) (string, error) {
+	text := strings.Join(requests, "\n\n")
+	previous_tokens := a.Tokenizer.Count(text)
+	if previous_tokens <= MAX_CARD_TOKENS {
+		return text, nil
+	}
+	for depth := 1; len(requests) > 1; depth++ {
+		// Ask for summaries that together fit the budget, counting about 4 tokens per 3 words
+		summary_size := MAX_CARD_TOKENS * 3 / 4 / len(requests)
+		if summary_size < MIN_SUMMARY_WORDS {
+			summary_size = MIN_SUMMARY_WORDS
 		}
-
-		// If the card doesn't contain "Q: " or "A: ", skip it
-		if !strings.Contains(card, "Q: ") || !strings.Contains(card, "A: ") {
-			continue
+		merged, err := a.SummarizeRequests(ctx, requests, summary_size)
+		if err != nil {
+			return "", err
 		}
-
-		// Split the card based on "Q: " and "A: "
-		card_split := strings.Split(card, "A:")
-
-		card_split[0] = strings.TrimPrefix(card_split[0], "Q: ")
-		card_split[0] = strings.TrimSpace(card_split[0])
-		card_split[1] = strings.TrimSpace(card_split[1])
-
-		// Create a new AnkiQuestion
-		anki_card := AnkiQuestion{
-			Question: card_split[0],
-			Answer:   card_split[1],
+		tokens := a.Tokenizer.Count(merged)
+		log.Printf("Summary round %d merged %d chunks into %d tokens.", depth, len(requests), tokens)
+		if tokens <= MAX_CARD_TOKENS {
+			return merged, nil
+		}
+		if depth >= MAX_SUMMARY_DEPTH || tokens >= previous_tokens {
+			log.Printf("The summaries are not getting shorter, using the first %d tokens.", MAX_CARD_TOKENS)
+			return tokenizer.Truncate(a.Tokenizer, merged, MAX_CARD_TOKENS), nil
 		}
-		// Append the new AnkiQuestion to the AnkiQuestions struct
-		anki_cards.Questions = append(anki_cards.Questions, anki_card)
+		previous_tokens = tokens
+		requests = a.chunk(merged)
+	}
+	if len(requests) == 0 {
+		return "", nil
 	}
-	return anki_cards, nil
+	return requests[0], nil
 }
 
-func SplitTextIntoRequests(text string, max_tokens int) []string {
-	var requests []string
-	var num_of_splits int = 1
-	var input_token_size int = GetTokenSize(text)
-
-	if input_token_size > max_tokens {
-		num_of_splits = (input_token_size / max_tokens) + 1
-		for i := 0; i < num_of_splits; i++ {
-			startIndex := i * max_tokens
-			endIndex := (i + 1) * max_tokens
-			requests = append(requests, text[startIndex:endIndex])
-		}
-	} else {
-		requests = append(requests, text)
-	}
-	log.Printf(`Splitting request into %d parts, the max number of words per request is %d. The document has %d words.`, num_of_splits, max_tokens, input_token_size)
-	return requests
+func CreateAnkiCards(ctx context.Context, text string, card_num int) (AnkiQuestions, error) {
+	return NewAnkifier(DefaultProvider()).CreateAnkiCards(ctx, text, card_num)
 }
 
-func SummarizeRequests(requests []string, summarySize int) (string, error) {
-	var requestsSummaries string = ""
-	if len(requests) > 1 {
-		log.Println("Each summary will be approximately", summarySize, "words.")
-		for i, request := range requests {
-			// Create the prompt for OpenAI
-			summaryPrompt := strings.Replace(SUMMARY_HELPER, "{text}", request, 1)
-			summaryPrompt = strings.Replace(summaryPrompt, "{summary_size}", strconv.Itoa(summarySize), 1)
-			ankiResponse, err := CallOpenAI(summaryPrompt)
+func (a *Ankifier) CreateAnkiCards(ctx context.Context, text string, card_num int) (AnkiQuestions, error) {
+	return a.createAnkiCards(ctx, text, "", card_num)
+}
+
+// createAnkiCards writes cards for text, telling the model which section it comes from.
+func (a *Ankifier) createAnkiCards(ctx context.Context, text string, section string, card_num int) (AnkiQuestions, error) {
+	anki_questions := AnkiQuestions{}
+	anki_token_size := a.Tokenizer.Count(text)
+	log.Printf("The summary has %d tokens.", anki_token_size)
+	if anki_token_size > MAX_CARD_TOKENS {
+		log.Printf("The summary is too long, we will use only the first %d tokens.", MAX_CARD_TOKENS)
+		text = tokenizer.Truncate(a.Tokenizer, text, MAX_CARD_TOKENS)
+	}
+	section_prompt := ""
+	if section != "" {
+		section_prompt = strings.Replace(SECTION_HELPER, "{section}", section, 1)
+	}
+	card_format := formatFor(a.CardType)
+	buildPrompt := func(format string) string {
+		anki_prompt := strings.Replace(card_format.prompt, "{text}", text, 1)
+		anki_prompt = strings.Replace(anki_prompt, "{card_num}", strconv.Itoa(card_num), 1)
+		anki_prompt = strings.Replace(anki_prompt, "{format}", format, 1)
+		return strings.Replace(anki_prompt, "{section}", section_prompt, 1)
+	}
+
+	// Ask for schema-constrained JSON first, and fall back to the text
+	// format for providers that cannot produce it.
+	if !a.textOnly() {
+		anki_prompt := buildPrompt(card_format.json_format)
+		log.Printf("The final length of the prompt is %d tokens.", a.Tokenizer.Count(anki_prompt))
+		anki_response, err := a.completeJSON(ctx, anki_prompt, card_format.schema)
+		if err == nil {
+			parsed_questions, err := card_format.parseJSON(anki_response)
 			if err != nil {
-				return "", err
+				return AnkiQuestions{}, err
 			}
-			// Log the request number using logger
-			log.Printf("Finished processing request %d of %d.", i+1, len(requests))
-			requestsSummaries += ankiResponse
+			log.Println("Successfully parsed the anki cards, adding them to the CSV.")
+			anki_questions.Questions = append(anki_questions.Questions, parsed_questions.Questions...)
+			return anki_questions, nil
+		}
+		if !isStructuredOutputUnsupported(err) {
+			return AnkiQuestions{}, err
 		}
-	} else {
-		requestsSummaries = requests[0]
+		log.Printf("%s has no structured output (%v), asking for text cards instead.", a.Provider.Name(), err)
+		a.setTextOnly()
 	}
-	return requestsSummaries, nil
-}
 
-func CreateAnkiCards(text string, card_num int) (AnkiQuestions, error) {
-	anki_questions := AnkiQuestions{}
-	anki_token_size := GetTokenSize(text)
-	log.Printf("The summary has %d tokens.", anki_token_size)
-	if anki_token_size > 3000 {
-		log.Printf("The summary is too long, we will use only the first 3000 tokens.")
-		text = text[:(3000 * 4)]
-	}
-	anki_prompt := strings.Replace(QUESTION_HELPER, "{text}", text, 1)
-	anki_prompt = strings.Replace(anki_prompt, "{card_num}", strconv.Itoa(card_num), 1)
-	log.Printf("The final length of the prompt is %d tokens.", GetTokenSize(anki_prompt))
-	anki_response, err := CallOpenAI(anki_prompt)
+	anki_prompt := buildPrompt(card_format.text_format)
+	log.Printf("The final length of the prompt is %d tokens.", a.Tokenizer.Count(anki_prompt))
+	anki_response, err := a.complete(ctx, anki_prompt)
 	if err != nil {
 		return AnkiQuestions{}, err
 	}
-	parsed_questions, err := ParseAnkiText(anki_response)
+	parsed_questions, err := card_format.parseText(anki_response)
 	if err != nil {
 		return AnkiQuestions{}, err
 	}
@@ -257,38 +332,260 @@ func CreateAnkiCards(text string, card_num int) (AnkiQuestions, error) {
 	return anki_questions, nil
 }
 
-func Ankify(ankiText map[int]string, cardNum int) (AnkiQuestions, error) {
+func Ankify(ctx context.Context, ankiText map[int]string, cardNum int) (AnkiQuestions, error) {
+	return NewAnkifier(DefaultProvider()).Ankify(ctx, ankiText, cardNum)
+}
+
+// PageError records a page whose cards could not be created.
+type PageError struct {
+	Page int
+	Err  error
+}
+
+func (e PageError) Error() string {
+	return fmt.Sprintf("page %d: %v", e.Page, e.Err)
+}
+
+func (e PageError) Unwrap() error {
+	return e.Err
+}
+
+// PageErrors is returned by Ankify when some pages failed while the others
+// still produced cards.
+type PageErrors []PageError
+
+func (e PageErrors) Error() string {
+	messages := make([]string, len(e))
+	for i, page_error := range e {
+		messages[i] = page_error.Error()
+	}
+	return fmt.Sprintf("%d page(s) failed: %s", len(e), strings.Join(messages, "; "))
+}
+
+// Ankify summarizes each page if needed and generates cardNum cards per page,
+// processing up to Concurrency pages at once. Cards are returned in page
+// order, so runs over the same document are reproducible.
+// A failed page does not stop the others: their cards are returned along with
+// a PageErrors. When ctx is done, the cards finished so far are returned with ctx.Err().
+func (a *Ankifier) Ankify(ctx context.Context, ankiText map[int]string, cardNum int) (AnkiQuestions, error) {
+	pages := make([]int, 0, len(ankiText))
+	for page := range ankiText {
+		pages = append(pages, page)
+	}
+	sort.Ints(pages)
+
+	results := make([]AnkiQuestions, len(pages))
+	errs := runPool(ctx, a.Concurrency, len(pages), func(i int) error {
+		var err error
+		results[i], err = a.ankifyPage(ctx, pages[i], ankiText[pages[i]], cardNum)
+		return err
+	})
+
 	ankiQuestions := AnkiQuestions{}
-	const max_tokens int = 3000
-	for _, text := range ankiText {
+	var page_errors PageErrors
+	for i, page := range pages {
+		ankiQuestions.Questions = append(ankiQuestions.Questions, results[i].Questions...)
+		if errs[i] != nil {
+			page_errors = append(page_errors, PageError{Page: page, Err: errs[i]})
+		}
+	}
+	log.Printf("%s used %d tokens in total.", a.Provider.Name(), a.Usage.TotalTokens)
+
+	if err := ctx.Err(); err != nil {
+		return ankiQuestions, err
+	}
+	if len(page_errors) > 0 {
+		return ankiQuestions, page_errors
+	}
+	return ankiQuestions, nil
+}
+
+// chunk splits a page into requests within the chunk budget.
+func (a *Ankifier) chunk(text string) []string {
+	max_tokens := a.ChunkTokens
+	if max_tokens <= 0 {
+		max_tokens = MAX_CARD_TOKENS
+	}
+	requests := chunker.Split(text, chunker.Options{
+		MaxTokens: max_tokens,
+		Overlap:   a.ChunkOverlap,
+		Tokenizer: a.Tokenizer,
+	})
+	if len(requests) > 1 {
+		log.Printf(`Splitting request into %d parts, the max number of tokens per request is %d.`, len(requests), max_tokens)
+	}
+	return requests
+}
+
+// ankifyPage creates the cards for a single page and records their source.
+// Markdown pages with headings are processed section by section, sharing
+// cardNum between the sections by length; sections too short for a card of
+// their own are merged into a neighbor, see mergeShortSections.
+func (a *Ankifier) ankifyPage(ctx context.Context, page int, text string, cardNum int) (AnkiQuestions, error) {
+	sections := []chunker.Section{{Text: text}}
+	if a.Markdown {
+		sections = chunker.SplitSections(text)
+	}
+	lengths := make([]int, len(sections))
+	for i, section := range sections {
+		lengths[i] = a.Tokenizer.Count(section.Text)
+	}
+	sections, shares := mergeShortSections(sections, shareCards(lengths, cardNum))
+
+	ankiQuestions := AnkiQuestions{}
+	chunk_number := 0
+	for i, section := range sections {
+		title := section.Title
+		section_context := strings.Join(section.Path, " > ")
+		if title == "" {
+			title = a.PageSections[page]
+			section_context = title
+		}
+		section_cards := shares[i]
+
 		// Check the number of tokens in the text
 		// doesn't exceed the maximum number of tokens
 		// allowed by OpenAI (3800); if it does, split
 		// the text into multiple requests
-		requests := SplitTextIntoRequests(text, max_tokens)
-		var summary_size int = max_tokens / len(requests)
-		var summarized_text string
+		requests := a.chunk(section.Text)
+		if len(requests) == 0 {
+			continue
+		}
 
-		if len(requests) > 1 {
-			summarized_text, _ = SummarizeRequests(requests, summary_size)
+		source := Source{Document: a.Document, Page: page, Section: title}
+		a.recordChunks(source, chunk_number, requests)
+		var ankiQuestionsForText AnkiQuestions
+		if a.SkipSummary {
+			// Create the anki cards from every chunk, up to Concurrency at a time
+			results := make([]AnkiQuestions, len(requests))
+			errs := runPool(ctx, a.Concurrency, len(requests), func(i int) error {
+				var err error
+				results[i], err = a.createAnkiCards(ctx, requests[i], section_context, section_cards)
+				return err
+			})
+			for i := range requests {
+				chunk_number++
+				if errs[i] != nil {
+					return ankiQuestions, fmt.Errorf("creating cards for chunk %d: %w", chunk_number, errs[i])
+				}
+				source.Chunk = chunk_number
+				ankiQuestionsForText.Questions = append(ankiQuestionsForText.Questions, withSource(results[i].Questions, source)...)
+			}
 		} else {
-			summarized_text = requests[0]
-		}
+			summarized_text, err := a.Summarize(ctx, requests)
+			if err != nil {
+				return ankiQuestions, fmt.Errorf("summarizing: %w", err)
+			}
 
-		// Create the anki cards from the summary
-		ankiQuestionsForText, err := CreateAnkiCards(summarized_text, cardNum)
-		if err != nil {
-			log.Fatal(err, os.Stderr)
-			return AnkiQuestions{}, err
+			// Create the anki cards from the summary
+			questions, err := a.createAnkiCards(ctx, summarized_text, section_context, section_cards)
+			if err != nil {
+				return ankiQuestions, fmt.Errorf("creating cards: %w", err)
+			}
+			chunk_number += len(requests)
+			if len(requests) == 1 {
+				source.Chunk = chunk_number
+			}
+			ankiQuestionsForText.Questions = withSource(questions.Questions, source)
 		}
 		ankiQuestions.Questions = append(ankiQuestions.Questions, ankiQuestionsForText.Questions...)
 	}
 	return ankiQuestions, nil
 }
 
+// shareCards splits cardNum between sections of the given lengths in
+// proportion to their length, so the shares add up to cardNum. Leftover cards
+// go to the sections with the largest remainders, earlier ones first.
+func shareCards(lengths []int, cardNum int) []int {
+	shares := make([]int, len(lengths))
+	if len(lengths) == 1 {
+		shares[0] = cardNum
+		return shares
+	}
+	total := 0
+	for _, length := range lengths {
+		total += length
+	}
+	if total == 0 {
+		return shares
+	}
+	remainders := make([]int, len(lengths))
+	given := 0
+	for i, length := range lengths {
+		shares[i] = cardNum * length / total
+		remainders[i] = cardNum * length % total
+		given += shares[i]
+	}
+	order := make([]int, len(lengths))
+	for i := range order {
+		order[i] = i
+	}
+	sort.SliceStable(order, func(i, j int) bool {
+		return remainders[order[i]] > remainders[order[j]]
+	})
+	for _, i := range order[:cardNum-given] {
+		shares[i]++
+	}
+	return shares
+}
+
+// mergeShortSections appends every section that got no card, heading
+// included, to the previous section that did, or prepends it to the next one
+// when it comes first, so its text still reaches the model.
+func mergeShortSections(sections []chunker.Section, shares []int) ([]chunker.Section, []int) {
+	var merged []chunker.Section
+	var merged_shares []int
+	var pending []string
+	for i, section := range sections {
+		text := section.Text
+		if section.Title != "" {
+			text = strings.Repeat("#", section.Level) + " " + section.Title + "\n\n" + text
+		}
+		switch {
+		case shares[i] > 0:
+			section.Text = strings.Join(append(pending, section.Text), "\n\n")
+			pending = nil
+			merged = append(merged, section)
+			merged_shares = append(merged_shares, shares[i])
+		case len(merged) > 0:
+			last := &merged[len(merged)-1]
+			last.Text += "\n\n" + text
+		default:
+			pending = append(pending, text)
+		}
+	}
+	return merged, merged_shares
+}
+
+// recordChunks passes the chunks of a section to OnChunk, numbered after
+// the first chunks of the page.
+func (a *Ankifier) recordChunks(source Source, first int, chunks []string) {
+	if a.OnChunk == nil {
+		return
+	}
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	for i, chunk := range chunks {
+		source.Chunk = first + i + 1
+		a.OnChunk(source, chunk)
+	}
+}
+
+// withSource sets the source of the cards and tags them with its section.
+func withSource(questions []AnkiQuestion, source Source) []AnkiQuestion {
+	for i := range questions {
+		questions[i].Source = source
+		questions[i].Tag = SectionTag(source.Section)
+	}
+	return questions
+}
+
+// SectionTag turns a section title into an Anki tag, which cannot contain spaces.
+func SectionTag(title string) string {
+	return strings.Join(strings.Fields(title), "_")
+}
+
+// GetTokenSize counts the tokens in text with the default tokenizer.
 func GetTokenSize(text string) int {
-	// We assume a token is about 4 characters
-	// and we count the number of spaces
-	// to get the number of tokens
-	return len(text) / 4
+	return tokenizer.ForModel("").Count(text)
 }
@@ -1,8 +1,11 @@
 package ankify
 
 import (
+	"context"
 	"fmt"
+	"strings"
 	"testing"
+	"unicode/utf8"
 
 	"github.com/acrucetta/anki-builder/pkg/docparser"
 	"github.com/joho/godotenv"
@@ -18,7 +21,7 @@ func TestAnkify(t *testing.T) {
 	godotenv.Load("../../.env")
 
 	// Act
-	res, err := Ankify(anki_text_map, 10)
+	res, err := Ankify(context.Background(), anki_text_map, 10)
 
 	// Assert
 	if err != nil {
@@ -60,8 +63,8 @@ func TestAnkifyUrl(t *testing.T) {
 	godotenv.Load("../../.env")
 
 	// Act
-	url_body, _ := docparser.ParseUrl(url)
-	res, err := Ankify(url_body, 10)
+	url_body, _ := docparser.ParseUrl(context.Background(), url)
+	res, err := Ankify(context.Background(), url_body, 10)
 
 	// Assert
 	if err != nil {
@@ -73,3 +76,28 @@ func TestAnkifyUrl(t *testing.T) {
 
 	fmt.Println(res)
 }
+
+func TestSplitTextIntoRequests(t *testing.T) {
+
+	// Arrange
+	text := strings.Repeat("Les élèves étudient à Montréal. ", 2000)
+
+	// Act
+	requests := SplitTextIntoRequests(text, 3000)
+
+	// Assert
+	if len(requests) < 2 {
+		t.Fatalf("Expected several requests, got %d", len(requests))
+	}
+	for i, request := range requests {
+		if !utf8.ValidString(request) {
+			t.Errorf("Request %d is not valid UTF-8", i)
+		}
+		if !strings.HasPrefix(request, "Les") || !strings.HasSuffix(request, "Montréal.") {
+			t.Errorf("Request %d is not cut on a sentence boundary", i)
+		}
+		if count := GetTokenSize(request); count > 3000 {
+			t.Errorf("Request %d has %d tokens, expected at most 3000", i, count)
+		}
+	}
+}
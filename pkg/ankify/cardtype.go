@@ -0,0 +1,90 @@
+package ankify
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"strings"
+)
+
+// CardType is the kind of Anki note the cards are written as.
+type CardType string
+
+const (
+	// CARD_TYPE_BASIC cards have a question on the front and an answer on the back.
+	CARD_TYPE_BASIC CardType = "basic"
+	// CARD_TYPE_CLOZE cards hide parts of a statement with {{c1::...}} deletions;
+	// Question holds the cloze text and Answer the optional "Back Extra".
+	CARD_TYPE_CLOZE CardType = "cloze"
+	// CARD_TYPE_MULTIPLE_CHOICE cards ask a question with one correct option
+	// among distractors; Answer holds the correct option and Choices the rest.
+	CARD_TYPE_MULTIPLE_CHOICE CardType = "multiple-choice"
+)
+
+// ParseCardType returns the CardType named by name, "basic" if empty.
+func ParseCardType(name string) (CardType, error) {
+	switch card_type := CardType(strings.ToLower(name)); card_type {
+	case "":
+		return CARD_TYPE_BASIC, nil
+	case CARD_TYPE_BASIC, CARD_TYPE_CLOZE, CARD_TYPE_MULTIPLE_CHOICE:
+		return card_type, nil
+	default:
+		return "", fmt.Errorf("unknown card type %q, expected 'basic', 'cloze' or 'multiple-choice'", name)
+	}
+}
+
+// PromptVersion identifies the prompts used to write cards of card_type, so
+// stored cards record which prompts produced them. It changes whenever the
+// card prompt, its reply formats or the summary prompt change.
+func PromptVersion(card_type CardType) string {
+	format := formatFor(card_type)
+	hash := sha256.New()
+	for _, prompt := range []string{format.prompt, format.text_format, format.json_format, SECTION_HELPER, SUMMARY_HELPER} {
+		hash.Write([]byte(prompt + "\x00"))
+	}
+	return hex.EncodeToString(hash.Sum(nil))[:12]
+}
+
+// cardFormat holds the prompt and parsers used to write one CardType.
+type cardFormat struct {
+	// prompt has {card_num}, {format}, {section} and {text} placeholders.
+	prompt string
+	// text_format and json_format fill {format} for text and structured replies.
+	text_format string
+	json_format string
+	schema      Schema
+	parseText   func(string) (AnkiQuestions, error)
+	parseJSON   func(string) (AnkiQuestions, error)
+}
+
+func formatFor(card_type CardType) cardFormat {
+	switch card_type {
+	case CARD_TYPE_CLOZE:
+		return cardFormat{
+			prompt:      CLOZE_HELPER,
+			text_format: CLOZE_TEXT_FORMAT_HELPER,
+			json_format: CLOZE_JSON_FORMAT_HELPER,
+			schema:      ClozeSchema,
+			parseText:   ParseClozeText,
+			parseJSON:   ParseClozeJSON,
+		}
+	case CARD_TYPE_MULTIPLE_CHOICE:
+		return cardFormat{
+			prompt:      CHOICE_HELPER,
+			text_format: CHOICE_TEXT_FORMAT_HELPER,
+			json_format: CHOICE_JSON_FORMAT_HELPER,
+			schema:      ChoiceSchema,
+			parseText:   ParseChoiceText,
+			parseJSON:   ParseChoiceJSON,
+		}
+	default:
+		return cardFormat{
+			prompt:      QUESTION_HELPER,
+			text_format: TEXT_FORMAT_HELPER,
+			json_format: JSON_FORMAT_HELPER,
+			schema:      CardSchema,
+			parseText:   ParseAnkiText,
+			parseJSON:   ParseAnkiJSON,
+		}
+	}
+}
@@ -0,0 +1,342 @@
+package ankify
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"html"
+	"log"
+	"math/rand"
+	"regexp"
+	"strings"
+)
+
+const CHOICE_HELPER = `You're an AI quiz assistant. You will help me write multiple-choice questions to check understanding of the text. 
+
+The questions should be:
+- Concise
+- Have exactly one correct option
+- Have plausible distractors of the same kind and length as the correct option, that someone who skimmed the text might pick
+- Not use "all of the above", "none of the above" or true/false options
+- Come with a short explanation of why the correct option is right
+- Avoid saying "in the text" or "in the passage"
+
+I want you to make {card_num} multiple-choice questions for the following text, {format}{section}The text is the following: 
+{text}`
+
+// CHOICE_TEXT_FORMAT_HELPER fills the {format} placeholder of CHOICE_HELPER for
+// providers without structured output; replies are read with ParseChoiceText.
+const CHOICE_TEXT_FORMAT_HELPER = `give it to me in the following format, with 3 wrong options: 
+
+Q: [Insert question here] 
+Correct: [Insert correct option here] 
+Wrong: [Insert a plausible wrong option here] 
+Explanation: [Insert why the correct option is right here] 
+\n\n 
+
+`
+
+// CHOICE_JSON_FORMAT_HELPER fills the {format} placeholder of CHOICE_HELPER for
+// providers with structured output; replies are read with ParseChoiceJSON.
+const CHOICE_JSON_FORMAT_HELPER = `give it to me as a JSON object with a "cards" array, where each question has a "question", the "correct" option, 3 plausible wrong "distractors" and an "explanation": 
+
+{"cards": [{"question": "[Insert question here]", "correct": "[Insert correct option here]", "distractors": ["[Insert wrong option here]"], "explanation": "[Insert why the correct option is right here]"}]}
+
+`
+
+// ChoiceSchema describes the reply expected for CHOICE_JSON_FORMAT_HELPER.
+var ChoiceSchema = Schema{
+	Name: "multiple_choice_questions",
+	Schema: json.RawMessage(`{
+	"type": "object",
+	"properties": {
+		"cards": {
+			"type": "array",
+			"items": {
+				"type": "object",
+				"properties": {
+					"question": {"type": "string"},
+					"correct": {"type": "string"},
+					"distractors": {"type": "array", "items": {"type": "string"}},
+					"explanation": {"type": "string"}
+				},
+				"required": ["question", "correct", "distractors", "explanation"],
+				"additionalProperties": false
+			}
+		}
+	},
+	"required": ["cards"],
+	"additionalProperties": false
+}`),
+}
+
+// MIN_DISTRACTORS is the number of wrong options a multiple-choice card needs.
+const MIN_DISTRACTORS = 2
+
+// SKIP_INVALID_CHOICE is reported for questions without a usable set of options.
+const SKIP_INVALID_CHOICE = "invalid multiple choice"
+
+// ErrInvalidChoice is returned by ValidateChoice.
+var ErrInvalidChoice = errors.New("invalid multiple choice")
+
+// MultipleChoice holds the options of a multiple-choice card besides its
+// correct one, which is the card's Answer.
+type MultipleChoice struct {
+	Distractors []string
+	Explanation string
+}
+
+// ValidateChoice checks that a multiple-choice card has a question, a correct
+// option and at least MIN_DISTRACTORS distinct wrong options.
+func ValidateChoice(card AnkiQuestion) error {
+	if strings.TrimSpace(card.Question) == "" {
+		return fmt.Errorf("%w: empty question", ErrInvalidChoice)
+	}
+	if strings.TrimSpace(card.Answer) == "" {
+		return fmt.Errorf("%w: no correct option", ErrInvalidChoice)
+	}
+	if card.Choices == nil || len(card.Choices.Distractors) < MIN_DISTRACTORS {
+		return fmt.Errorf("%w: %q needs at least %d wrong options", ErrInvalidChoice, card.Question, MIN_DISTRACTORS)
+	}
+	seen := map[string]bool{normalizeOption(card.Answer): true}
+	for _, distractor := range card.Choices.Distractors {
+		option := normalizeOption(distractor)
+		if option == "" || seen[option] {
+			return fmt.Errorf("%w: %q has an empty or repeated option %q", ErrInvalidChoice, card.Question, distractor)
+		}
+		seen[option] = true
+	}
+	return nil
+}
+
+func normalizeOption(option string) string {
+	return strings.ToLower(strings.Join(strings.Fields(option), " "))
+}
+
+// Options returns the correct option and distractors of a multiple-choice
+// card in a shuffled order, and the index of the correct one. The order
+// depends only on the card, so a card renders the same way on every export.
+func (q AnkiQuestion) Options() ([]string, int) {
+	options := []string{q.Answer}
+	if q.Choices != nil {
+		options = append(options, q.Choices.Distractors...)
+	}
+	hash := fnv.New64a()
+	hash.Write([]byte(q.Question))
+	order := rand.New(rand.NewSource(int64(hash.Sum64()))).Perm(len(options))
+
+	shuffled := make([]string, len(options))
+	correct := 0
+	for i, j := range order {
+		shuffled[j] = options[i]
+		if i == 0 {
+			correct = j
+		}
+	}
+	return shuffled, correct
+}
+
+// ChoiceHTML renders a multiple-choice card as the HTML front and back of an
+// Anki Basic note: the question with lettered options, then the correct
+// option and the explanation.
+func ChoiceHTML(q AnkiQuestion) (string, string) {
+	options, correct := q.Options()
+	var front strings.Builder
+	front.WriteString(html.EscapeString(q.Question))
+	front.WriteString(`<ol type="A">`)
+	for _, option := range options {
+		front.WriteString("<li>" + html.EscapeString(option) + "</li>")
+	}
+	front.WriteString("</ol>")
+
+	back := fmt.Sprintf("<b>%c. %s</b>", 'A'+correct, html.EscapeString(q.Answer))
+	if q.Choices != nil && q.Choices.Explanation != "" {
+		back += "<br><br>" + strings.ReplaceAll(html.EscapeString(q.Choices.Explanation), "\n", "<br>")
+	}
+	return front.String(), back
+}
+
+// QuizQuestion is the structured form of a multiple-choice card, for tools
+// other than Anki.
+type QuizQuestion struct {
+	Question string   `json:"question"`
+	Options  []string `json:"options"`
+	// Answer is the index of the correct option in Options.
+	Answer      int      `json:"answer"`
+	Correct     string   `json:"correct"`
+	Distractors []string `json:"distractors"`
+	Explanation string   `json:"explanation,omitempty"`
+	Tags        []string `json:"tags,omitempty"`
+	Source      Source   `json:"source"`
+}
+
+// NewQuizQuestion returns the structured form of a multiple-choice card.
+func NewQuizQuestion(q AnkiQuestion) QuizQuestion {
+	options, correct := q.Options()
+	quiz := QuizQuestion{
+		Question:    q.Question,
+		Options:     options,
+		Answer:      correct,
+		Correct:     q.Answer,
+		Distractors: []string{},
+		Tags:        strings.Fields(q.Tag),
+		Source:      q.Source,
+	}
+	if q.Choices != nil {
+		quiz.Distractors = q.Choices.Distractors
+		quiz.Explanation = q.Choices.Explanation
+	}
+	return quiz
+}
+
+func choiceCard(question string, correct string, distractors []string, explanation string) AnkiQuestion {
+	trimmed := []string{}
+	for _, distractor := range distractors {
+		trimmed = append(trimmed, strings.TrimSpace(distractor))
+	}
+	return AnkiQuestion{
+		Question: strings.TrimSpace(question),
+		Answer:   strings.TrimSpace(correct),
+		Type:     CARD_TYPE_MULTIPLE_CHOICE,
+		Choices: &MultipleChoice{
+			Distractors: trimmed,
+			Explanation: strings.TrimSpace(explanation),
+		},
+	}
+}
+
+type jsonChoices struct {
+	Cards []struct {
+		Question    string   `json:"question"`
+		Correct     string   `json:"correct"`
+		Distractors []string `json:"distractors"`
+		Explanation string   `json:"explanation"`
+	} `json:"cards"`
+}
+
+// ParseChoiceJSON reads a reply constrained by ChoiceSchema. Questions that
+// fail ValidateChoice are skipped; a reply that is not valid JSON or has no
+// valid question returns ErrInvalidCards.
+func ParseChoiceJSON(choice_json string) (AnkiQuestions, error) {
+	decoder := json.NewDecoder(strings.NewReader(stripCodeFence(choice_json)))
+	decoder.DisallowUnknownFields()
+	var reply jsonChoices
+	if err := decoder.Decode(&reply); err != nil {
+		return AnkiQuestions{}, fmt.Errorf("%w: %v", ErrInvalidCards, err)
+	}
+	if reply.Cards == nil {
+		return AnkiQuestions{}, fmt.Errorf(`%w: missing "cards" array`, ErrInvalidCards)
+	}
+
+	anki_cards := AnkiQuestions{}
+	for i, card := range reply.Cards {
+		choice := choiceCard(card.Question, card.Correct, card.Distractors, card.Explanation)
+		if err := ValidateChoice(choice); err != nil {
+			log.Printf("Skipping question %d: %v", i+1, err)
+			continue
+		}
+		anki_cards.Questions = append(anki_cards.Questions, choice)
+	}
+	if len(reply.Cards) > 0 && len(anki_cards.Questions) == 0 {
+		return AnkiQuestions{}, fmt.Errorf("%w: none of the %d questions has a valid set of options", ErrInvalidCards, len(reply.Cards))
+	}
+	return anki_cards, nil
+}
+
+// ParseChoiceText parses a model reply in the Q:/Correct:/Wrong:/Explanation:
+// format and returns its questions. The blocks it cannot read are logged; see
+// ParseChoiceTextReport.
+func ParseChoiceText(choice_text string) (AnkiQuestions, error) {
+	anki_cards, report := ParseChoiceTextReport(choice_text)
+	if len(report.Skipped) > 0 {
+		log.Printf("The reply had unreadable parts: %s.", report)
+		for _, block := range report.Skipped {
+			log.Printf("Skipped line %d (%s): %.80q", block.Line, block.Reason, block.Text)
+		}
+	}
+	return anki_cards, nil
+}
+
+// choiceLabel matches the labels of the multiple-choice text format, e.g.
+// "Q:", "**Correct:**", "Wrong 2:" or "Explanation:".
+var choiceLabel = regexp.MustCompile(`(?i)^(\*\*|__|\*|_)?\s*(q|question|correct|correct answer|answer|a|wrong|incorrect|distractor|explanation|why)\s*\d*\s*(\*\*|__|\*|_)?\s*[:：]\s*(\*\*|__|\*|_)?\s*(.*)$`)
+
+// ParseChoiceTextReport reads one question per "Q:" label, followed by a
+// "Correct:" option, one "Wrong:" line per distractor and an "Explanation:"
+// that runs until the next question. Questions that fail ValidateChoice are
+// reported with SKIP_INVALID_CHOICE, text before the first question with
+// SKIP_NO_LABEL.
+func ParseChoiceTextReport(choice_text string) (AnkiQuestions, ParseReport) {
+	anki_cards := AnkiQuestions{}
+	report := ParseReport{}
+
+	var question, correct, explanation, unlabeled []string
+	var distractors []string
+	field := &unlabeled
+	in_card := false
+	start := 0
+	flush := func() {
+		if in_card {
+			card := choiceCard(joinLines(question), joinLines(correct), distractors, joinLines(explanation))
+			if err := ValidateChoice(card); err != nil {
+				report.Skipped = append(report.Skipped, SkippedBlock{Line: start, Reason: SKIP_INVALID_CHOICE, Text: card.Question})
+			} else {
+				anki_cards.Questions = append(anki_cards.Questions, card)
+			}
+		} else if text := joinLines(unlabeled); text != "" {
+			report.Skipped = append(report.Skipped, SkippedBlock{Line: start, Reason: SKIP_NO_LABEL, Text: text})
+		}
+		question, correct, explanation, unlabeled, distractors = nil, nil, nil, nil, nil
+		field = &unlabeled
+		in_card = false
+	}
+
+	for i, line := range strings.Split(strings.ReplaceAll(choice_text, "\r\n", "\n"), "\n") {
+		if isBlank(line) {
+			if !in_card && len(unlabeled) > 0 {
+				flush()
+			} else if field == &explanation && len(explanation) > 0 && explanation[len(explanation)-1] != "" {
+				explanation = append(explanation, "")
+			}
+			continue
+		}
+
+		cleaned := headingMarker.ReplaceAllString(listMarker.ReplaceAllString(strings.TrimSpace(line), ""), "")
+		match := choiceLabel.FindStringSubmatch(cleaned)
+		if match == nil {
+			if !in_card && len(unlabeled) == 0 {
+				start = i + 1
+			}
+			if field == &distractors {
+				// A wrong option wrapped onto the next line.
+				distractors[len(distractors)-1] += " " + strings.TrimSpace(line)
+				continue
+			}
+			*field = append(*field, strings.TrimSpace(line))
+			continue
+		}
+
+		rest := strings.TrimSpace(match[5])
+		switch strings.ToLower(match[2]) {
+		case "q", "question":
+			flush()
+			in_card = true
+			start = i + 1
+			question = appendLine(nil, rest)
+			field = &question
+		case "correct", "correct answer", "answer", "a":
+			correct = appendLine(correct, rest)
+			field = &correct
+		case "wrong", "incorrect", "distractor":
+			distractors = append(distractors, rest)
+			field = &distractors
+		default:
+			explanation = appendLine(explanation, rest)
+			field = &explanation
+		}
+	}
+	flush()
+	report.Cards = len(anki_cards.Questions)
+	return anki_cards, report
+}
@@ -0,0 +1,144 @@
+package ankify
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseChoiceText(t *testing.T) {
+
+	// Arrange
+	const text = `Here are your questions:
+
+1. **Q:** What is the capital of France?
+**Correct:** Paris
+**Wrong:** Lyon
+**Wrong:** Marseille
+**Wrong:** Nice
+**Explanation:** Paris has been the capital
+since 508 AD.
+
+Q: What is the capital of Spain?
+Correct: Madrid
+Wrong: Barcelona
+Explanation: Only one wrong option.
+
+Question: Which river flows through Berlin?
+Answer: The Spree
+Wrong 1: The Rhine
+Wrong 2: The Spree
+Explanation: Repeated option.`
+
+	// Act
+	res, report := ParseChoiceTextReport(text)
+
+	// Assert
+	if len(res.Questions) != 1 {
+		t.Fatalf("Expected 1 question, got %+v", res.Questions)
+	}
+	want := choiceCard("What is the capital of France?", "Paris", []string{"Lyon", "Marseille", "Nice"}, "Paris has been the capital\nsince 508 AD.")
+	if !reflect.DeepEqual(res.Questions[0], want) {
+		t.Errorf("Expected %+v, got %+v", want, res.Questions[0])
+	}
+	reasons := []string{}
+	for _, block := range report.Skipped {
+		reasons = append(reasons, block.Reason)
+	}
+	if !reflect.DeepEqual(reasons, []string{SKIP_NO_LABEL, SKIP_INVALID_CHOICE, SKIP_INVALID_CHOICE}) {
+		t.Errorf("Unexpected skipped blocks: %+v", report.Skipped)
+	}
+}
+
+func TestParseChoiceJSON(t *testing.T) {
+	res, err := ParseChoiceJSON(`{"cards":[
+		{"question":"What is 2 + 2?","correct":"4","distractors":["3","5","22"],"explanation":"Addition."},
+		{"question":"What is 1 + 1?","correct":"2","distractors":["2","3"],"explanation":""}
+	]}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(res.Questions) != 1 || res.Questions[0].Answer != "4" || res.Questions[0].Type != CARD_TYPE_MULTIPLE_CHOICE {
+		t.Errorf("Unexpected questions: %+v", res.Questions)
+	}
+
+	if _, err := ParseChoiceJSON(`{"cards":[{"question":"Q","correct":"A","distractors":[],"explanation":""}]}`); !errors.Is(err, ErrInvalidCards) {
+		t.Errorf("Expected ErrInvalidCards, got %v", err)
+	}
+}
+
+func TestChoiceOptionsAreStable(t *testing.T) {
+	card := choiceCard("What is the capital of France?", "Paris", []string{"Lyon", "Marseille", "Nice"}, "")
+	options, correct := card.Options()
+	again, correct_again := card.Options()
+	if !reflect.DeepEqual(options, again) || correct != correct_again {
+		t.Errorf("Expected the same order twice, got %v and %v", options, again)
+	}
+	if len(options) != 4 || options[correct] != "Paris" {
+		t.Errorf("Expected Paris at %d in %v", correct, options)
+	}
+}
+
+func TestChoiceHTML(t *testing.T) {
+	card := choiceCard("Which is <b>bold</b>?", "Paris & co", []string{"Lyon", "Nice"}, "Line one\nLine two")
+	options, correct := card.Options()
+
+	front, back := ChoiceHTML(card)
+
+	if !strings.HasPrefix(front, "Which is &lt;b&gt;bold&lt;/b&gt;?<ol type=\"A\">") || strings.Count(front, "<li>") != 3 {
+		t.Errorf("Unexpected front: %s", front)
+	}
+	if !strings.Contains(front, "<li>"+strings.ReplaceAll(options[0], "&", "&amp;")+"</li>") {
+		t.Errorf("Expected the options in order on the front: %s", front)
+	}
+	letter := string(rune('A' + correct))
+	if back != "<b>"+letter+". Paris &amp; co</b><br><br>Line one<br>Line two" {
+		t.Errorf("Unexpected back: %s", back)
+	}
+}
+
+func TestNewQuizQuestion(t *testing.T) {
+	card := choiceCard("What is 2 + 2?", "4", []string{"3", "5"}, "Addition.")
+	card.Tag = "math arithmetic"
+	card.Source = Source{Document: "book.pdf", Page: 3}
+
+	data, err := json.Marshal(NewQuizQuestion(card))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var quiz map[string]interface{}
+	json.Unmarshal(data, &quiz)
+	options := quiz["options"].([]interface{})
+	if options[int(quiz["answer"].(float64))] != "4" || quiz["correct"] != "4" || len(quiz["distractors"].([]interface{})) != 2 {
+		t.Errorf("Unexpected quiz question: %s", data)
+	}
+	if !strings.Contains(string(data), `"tags":["math","arithmetic"]`) || !strings.Contains(string(data), `"source":{"document":"book.pdf","page":3,"chunk":0}`) {
+		t.Errorf("Expected tags and source in %s", data)
+	}
+}
+
+func TestAnkifyMultipleChoice(t *testing.T) {
+
+	// Arrange
+	provider := &fakeProvider{reply: "Q: What is the capital of Germany?\nCorrect: Berlin\nWrong: Bonn\nWrong: Munich\nExplanation: Since 1990."}
+	ankifier := NewAnkifier(provider)
+	ankifier.CardType = CARD_TYPE_MULTIPLE_CHOICE
+
+	// Act
+	res, err := ankifier.Ankify(context.Background(), map[int]string{1: "The capital of Germany is Berlin."}, 1)
+
+	// Assert
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(provider.prompts[0], "multiple-choice questions") {
+		t.Errorf("Expected the multiple-choice prompt, got %q", provider.prompts[0])
+	}
+	if len(res.Questions) != 1 || res.Questions[0].Choices == nil || res.Questions[0].Source.Page != 1 {
+		t.Errorf("Unexpected questions: %+v", res.Questions)
+	}
+}
@@ -0,0 +1,271 @@
+package ankify
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+const CLOZE_HELPER = `You're an AI memorizing assistant. You will help me write Anki cloze deletion notes to retain information in the text through spaced repetition. 
+
+The cloze notes should be:
+- One self-contained statement or short paragraph per note
+- Hide key terms, names, numbers and dates with {{c1::...}}, and use {{c2::...}}, {{c3::...}} for further deletions in the same note
+- Give deletions the same number only when they should be recalled together
+- Keep enough context visible to unambiguously recall each deletion
+- Avoid saying "in the text" or "in the passage"
+
+I want you to make {card_num} cloze notes for the following text, {format}{section}The text is the following: 
+{text}`
+
+// CLOZE_TEXT_FORMAT_HELPER fills the {format} placeholder of CLOZE_HELPER for
+// providers without structured output; replies are read with ParseClozeText.
+const CLOZE_TEXT_FORMAT_HELPER = `give it to me in the following format: 
+
+Text: [Insert statement with {{c1::deletions}} here] 
+Extra: [Insert optional context for the back of the card here] 
+\n\n 
+
+`
+
+// CLOZE_JSON_FORMAT_HELPER fills the {format} placeholder of CLOZE_HELPER for
+// providers with structured output; replies are read with ParseClozeJSON.
+const CLOZE_JSON_FORMAT_HELPER = `give it to me as a JSON object with a "cards" array, where each note has a "text" with the deletions and an "extra" string, which may be empty: 
+
+{"cards": [{"text": "[Insert statement with {{c1::deletions}} here]", "extra": "[Insert optional context here]"}]}
+
+`
+
+// ClozeSchema describes the reply expected for CLOZE_JSON_FORMAT_HELPER.
+var ClozeSchema = Schema{
+	Name: "anki_cloze_notes",
+	Schema: json.RawMessage(`{
+	"type": "object",
+	"properties": {
+		"cards": {
+			"type": "array",
+			"items": {
+				"type": "object",
+				"properties": {
+					"text": {"type": "string"},
+					"extra": {"type": "string"}
+				},
+				"required": ["text", "extra"],
+				"additionalProperties": false
+			}
+		}
+	},
+	"required": ["cards"],
+	"additionalProperties": false
+}`),
+}
+
+// SKIP_INVALID_CLOZE is reported for notes whose deletions Anki cannot read.
+const SKIP_INVALID_CLOZE = "invalid cloze"
+
+// ErrInvalidCloze is returned by ValidateCloze.
+var ErrInvalidCloze = errors.New("invalid cloze")
+
+// ClozeDeletion matches a {{cN::answer}} or {{cN::answer::hint}} deletion,
+// capturing its number, answer and hint.
+var ClozeDeletion = regexp.MustCompile(`(?s)\{\{c(\d+)::(.*?)(?:::(.*?))?\}\}`)
+
+// ClozeText returns a cloze text as it reads once revealed, with each
+// deletion shown as its answer.
+func ClozeText(text string) string {
+	return ClozeDeletion.ReplaceAllString(text, "$2")
+}
+
+// ValidateCloze checks that text has at least one deletion and that every
+// deletion is numbered from c1 and hides some text, as Anki requires.
+func ValidateCloze(text string) error {
+	matches := ClozeDeletion.FindAllStringSubmatch(text, -1)
+	if len(matches) == 0 {
+		return fmt.Errorf("%w: no {{c1::...}} deletion", ErrInvalidCloze)
+	}
+	for _, match := range matches {
+		if strings.TrimLeft(match[1], "0") == "" {
+			return fmt.Errorf("%w: deletion %q must be numbered from c1", ErrInvalidCloze, match[0])
+		}
+		if strings.Contains(match[0][2:], "{{") {
+			return fmt.Errorf("%w: nested deletion in %q", ErrInvalidCloze, match[0])
+		}
+		if strings.TrimSpace(match[2]) == "" {
+			return fmt.Errorf("%w: deletion %q hides nothing", ErrInvalidCloze, match[0])
+		}
+	}
+	if rest := ClozeDeletion.ReplaceAllString(text, ""); strings.Contains(rest, "{{") || strings.Contains(rest, "}}") {
+		return fmt.Errorf("%w: malformed deletion in %q", ErrInvalidCloze, text)
+	}
+	return nil
+}
+
+// ClozeNumbers returns the distinct deletion numbers of a cloze text in
+// increasing order; Anki makes one card per number.
+func ClozeNumbers(text string) []int {
+	seen := map[int]bool{}
+	numbers := []int{}
+	for _, match := range ClozeDeletion.FindAllStringSubmatch(text, -1) {
+		number, err := strconv.Atoi(match[1])
+		if err != nil || number < 1 || seen[number] {
+			continue
+		}
+		seen[number] = true
+		numbers = append(numbers, number)
+	}
+	sort.Ints(numbers)
+	return numbers
+}
+
+type jsonCloze struct {
+	Cards []struct {
+		Text  *string `json:"text"`
+		Extra string  `json:"extra"`
+	} `json:"cards"`
+}
+
+// ParseClozeJSON reads a reply constrained by ClozeSchema. Notes that fail
+// ValidateCloze are skipped; a reply that is not valid JSON or has no valid
+// note returns ErrInvalidCards.
+func ParseClozeJSON(cloze_json string) (AnkiQuestions, error) {
+	decoder := json.NewDecoder(strings.NewReader(stripCodeFence(cloze_json)))
+	decoder.DisallowUnknownFields()
+	var reply jsonCloze
+	if err := decoder.Decode(&reply); err != nil {
+		return AnkiQuestions{}, fmt.Errorf("%w: %v", ErrInvalidCards, err)
+	}
+	if reply.Cards == nil {
+		return AnkiQuestions{}, fmt.Errorf(`%w: missing "cards" array`, ErrInvalidCards)
+	}
+
+	anki_cards := AnkiQuestions{}
+	for i, card := range reply.Cards {
+		if card.Text == nil {
+			log.Printf("Skipping note %d: it has no text.", i+1)
+			continue
+		}
+		if err := ValidateCloze(*card.Text); err != nil {
+			log.Printf("Skipping note %d: %v", i+1, err)
+			continue
+		}
+		anki_cards.Questions = append(anki_cards.Questions, clozeCard(*card.Text, card.Extra))
+	}
+	if len(reply.Cards) > 0 && len(anki_cards.Questions) == 0 {
+		return AnkiQuestions{}, fmt.Errorf("%w: none of the %d notes has a valid cloze deletion", ErrInvalidCards, len(reply.Cards))
+	}
+	return anki_cards, nil
+}
+
+// ParseClozeText parses a model reply in the Text:/Extra: format and returns
+// its notes. The blocks it cannot read are logged; see ParseClozeTextReport.
+func ParseClozeText(cloze_text string) (AnkiQuestions, error) {
+	anki_cards, report := ParseClozeTextReport(cloze_text)
+	if len(report.Skipped) > 0 {
+		log.Printf("The reply had unreadable parts: %s.", report)
+		for _, block := range report.Skipped {
+			log.Printf("Skipped line %d (%s): %.80q", block.Line, block.Reason, block.Text)
+		}
+	}
+	return anki_cards, nil
+}
+
+var (
+	// clozeLabel matches "Text:", "**Cloze:**", "Extra:", "Back Extra:" and the like.
+	clozeLabel = regexp.MustCompile(`(?i)^(\*\*|__|\*|_)?\s*(text|cloze|note|extra|back extra)\s*\d*\s*(\*\*|__|\*|_)?\s*[:：]\s*(\*\*|__|\*|_)?\s*(.*)$`)
+)
+
+// ParseClozeTextReport reads one note per block: a "Text:" line, or any line
+// with a deletion outside a note or in a list item, starts a note and an
+// "Extra:" line holds its back. Lines
+// that follow continue the current field until a blank line ends the note's
+// text or a new note starts, so notes need not be labeled. Notes that fail ValidateCloze are
+// reported with SKIP_INVALID_CLOZE.
+func ParseClozeTextReport(cloze_text string) (AnkiQuestions, ParseReport) {
+	anki_cards := AnkiQuestions{}
+	report := ParseReport{}
+
+	var text, extra, unlabeled []string
+	in_extra := false
+	ended := false // a blank line followed the note's text
+	start := 0
+	flush := func() {
+		if len(text) > 0 {
+			note := joinLines(text)
+			if err := ValidateCloze(note); err != nil {
+				report.Skipped = append(report.Skipped, SkippedBlock{Line: start, Reason: SKIP_INVALID_CLOZE, Text: note})
+			} else {
+				anki_cards.Questions = append(anki_cards.Questions, clozeCard(note, joinLines(extra)))
+			}
+		} else if len(extra) > 0 {
+			report.Skipped = append(report.Skipped, SkippedBlock{Line: start, Reason: SKIP_NO_QUESTION, Text: joinLines(extra)})
+		}
+		if note := joinLines(unlabeled); note != "" {
+			report.Skipped = append(report.Skipped, SkippedBlock{Line: start, Reason: SKIP_NO_LABEL, Text: note})
+		}
+		text, extra, unlabeled = nil, nil, nil
+		in_extra, ended = false, false
+	}
+
+	for i, line := range strings.Split(strings.ReplaceAll(cloze_text, "\r\n", "\n"), "\n") {
+		if isBlank(line) {
+			if len(text) > 0 && !in_extra {
+				ended = true
+			} else if in_extra && len(extra) > 0 && extra[len(extra)-1] != "" {
+				extra = append(extra, "")
+			} else if len(unlabeled) > 0 {
+				flush()
+			}
+			continue
+		}
+
+		cleaned := headingMarker.ReplaceAllString(listMarker.ReplaceAllString(strings.TrimSpace(line), ""), "")
+		match := clozeLabel.FindStringSubmatch(cleaned)
+		is_extra := match != nil && strings.Contains(strings.ToLower(match[2]), "extra")
+		if ended && !is_extra {
+			flush()
+		}
+		ended = false
+		switch {
+		case is_extra:
+			if in_extra || len(text) == 0 {
+				flush()
+				start = i + 1
+			}
+			in_extra = true
+			extra = appendLine(extra, match[5])
+		case match != nil:
+			flush()
+			start = i + 1
+			text = appendLine(nil, match[5])
+		case ClozeDeletion.MatchString(cleaned) && (in_extra || len(text) == 0 || listMarker.MatchString(strings.TrimSpace(line))):
+			flush()
+			start = i + 1
+			text = appendLine(nil, cleaned)
+		case in_extra:
+			extra = append(extra, strings.TrimSpace(line))
+		case len(text) > 0:
+			text = append(text, strings.TrimSpace(line))
+		default:
+			if len(unlabeled) == 0 {
+				start = i + 1
+			}
+			unlabeled = append(unlabeled, strings.TrimSpace(line))
+		}
+	}
+	flush()
+	report.Cards = len(anki_cards.Questions)
+	return anki_cards, report
+}
+
+func clozeCard(text string, extra string) AnkiQuestion {
+	return AnkiQuestion{
+		Question: strings.TrimSpace(text),
+		Answer:   strings.TrimSpace(extra),
+		Type:     CARD_TYPE_CLOZE,
+	}
+}
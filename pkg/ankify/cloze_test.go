@@ -0,0 +1,166 @@
+package ankify
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestValidateCloze(t *testing.T) {
+	tests := []struct {
+		text  string
+		valid bool
+	}{
+		{"{{c1::Paris}} is the capital of France.", true},
+		{"{{c1::Paris}} is the capital of {{c2::France}}, {{c1::Berlin}} of Germany.", true},
+		{"{{c1::Paris::city}} is the capital of France.", true},
+		{"Paris is the capital of France.", false},
+		{"{{c0::Paris}} is the capital of France.", false},
+		{"{{c1::}} is the capital of France.", false},
+		{"{{c1::  ::hint}} is the capital of France.", false},
+		{"{{c1:Paris}} is the capital of France.", false},
+		{"{{c1::Paris}} is the capital of {{c2::France.", false},
+		{"{{c1::Paris {{c2::France}}}}", false},
+		{"{{c1::Paris::{{c2::city}}}}", false},
+	}
+	for _, test := range tests {
+		err := ValidateCloze(test.text)
+		if test.valid && err != nil {
+			t.Errorf("Expected %q to be valid, got %v", test.text, err)
+		}
+		if !test.valid && !errors.Is(err, ErrInvalidCloze) {
+			t.Errorf("Expected %q to be invalid, got %v", test.text, err)
+		}
+	}
+}
+
+func TestClozeText(t *testing.T) {
+
+	// Arrange
+	text := "{{c1::Paris::city}} is the capital of {{c2::France}}."
+
+	// Act
+	revealed := ClozeText(text)
+
+	// Assert
+	if revealed != "Paris is the capital of France." {
+		t.Errorf("Expected the deletions shown without hints, got %q", revealed)
+	}
+}
+
+func TestParseClozeText(t *testing.T) {
+	tests := []struct {
+		name    string
+		text    string
+		want    []AnkiQuestion
+		skipped []string
+	}{
+		{
+			name: "labeled notes",
+			text: "Text: {{c1::Paris}} is the capital of {{c2::France}}.\nExtra: Since 508 AD.\n\\n\\n\nText: {{c1::Berlin}} is the capital of Germany.\nExtra:",
+			want: []AnkiQuestion{
+				{Question: "{{c1::Paris}} is the capital of {{c2::France}}.", Answer: "Since 508 AD.", Type: CARD_TYPE_CLOZE},
+				{Question: "{{c1::Berlin}} is the capital of Germany.", Type: CARD_TYPE_CLOZE},
+			},
+		},
+		{
+			name: "unlabeled list",
+			text: "Here are the notes:\n\n1. {{c1::Paris}} is the capital of France.\n2. {{c1::Berlin}} is the capital of Germany.",
+			want: []AnkiQuestion{
+				{Question: "{{c1::Paris}} is the capital of France.", Type: CARD_TYPE_CLOZE},
+				{Question: "{{c1::Berlin}} is the capital of Germany.", Type: CARD_TYPE_CLOZE},
+			},
+			skipped: []string{SKIP_NO_LABEL},
+		},
+		{
+			name: "extra after a blank line",
+			text: "**Text:** {{c1::Madrid}} is the capital of Spain.\n\n**Extra:** Since 1561.",
+			want: []AnkiQuestion{{Question: "{{c1::Madrid}} is the capital of Spain.", Answer: "Since 1561.", Type: CARD_TYPE_CLOZE}},
+		},
+		{
+			name:    "invalid notes",
+			text:    "Text: Paris is the capital of France.\nExtra: No deletion.\n\nText: {{c1:Rome}} is the capital of Italy.\n\nExtra: Orphan",
+			skipped: []string{SKIP_INVALID_CLOZE, SKIP_INVALID_CLOZE},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			res, report := ParseClozeTextReport(test.text)
+			if len(res.Questions) != len(test.want) {
+				t.Fatalf("Expected %d notes, got %+v", len(test.want), res.Questions)
+			}
+			for i, card := range test.want {
+				if res.Questions[i] != card {
+					t.Errorf("Note %d: expected %+v, got %+v", i, card, res.Questions[i])
+				}
+			}
+			if len(report.Skipped) != len(test.skipped) {
+				t.Fatalf("Expected %d skipped blocks, got %+v", len(test.skipped), report.Skipped)
+			}
+			for i, reason := range test.skipped {
+				if report.Skipped[i].Reason != reason {
+					t.Errorf("Skipped block %d: expected %q, got %+v", i, reason, report.Skipped[i])
+				}
+			}
+		})
+	}
+}
+
+func TestParseClozeJSON(t *testing.T) {
+	res, err := ParseClozeJSON(`{"cards":[{"text":"{{c1::Paris}} is in {{c2::France}}","extra":"Capital"},{"text":"No deletion","extra":""}]}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := AnkiQuestion{Question: "{{c1::Paris}} is in {{c2::France}}", Answer: "Capital", Type: CARD_TYPE_CLOZE}
+	if len(res.Questions) != 1 || res.Questions[0] != want {
+		t.Errorf("Unexpected notes: %+v", res.Questions)
+	}
+
+	if _, err := ParseClozeJSON(`{"cards":[{"text":"No deletion","extra":""}]}`); !errors.Is(err, ErrInvalidCards) {
+		t.Errorf("Expected ErrInvalidCards, got %v", err)
+	}
+}
+
+func TestAnkifyCloze(t *testing.T) {
+
+	// Arrange
+	provider := &fakeProvider{reply: "Text: {{c1::Berlin}} is the capital of {{c2::Germany}}.\nExtra: Since 1990."}
+	ankifier := NewAnkifier(provider)
+	ankifier.CardType = CARD_TYPE_CLOZE
+
+	// Act
+	res, err := ankifier.Ankify(context.Background(), map[int]string{1: "The capital of Germany is Berlin."}, 1)
+
+	// Assert
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(provider.prompts[0], "cloze deletion notes") || !strings.Contains(provider.prompts[0], "Extra:") {
+		t.Errorf("Expected the cloze prompt, got %q", provider.prompts[0])
+	}
+	if len(res.Questions) != 1 || res.Questions[0].Type != CARD_TYPE_CLOZE || res.Questions[0].Answer != "Since 1990." {
+		t.Errorf("Unexpected notes: %+v", res.Questions)
+	}
+}
+
+func TestParseCardType(t *testing.T) {
+	for name, want := range map[string]CardType{"": CARD_TYPE_BASIC, "basic": CARD_TYPE_BASIC, "Cloze": CARD_TYPE_CLOZE} {
+		if card_type, err := ParseCardType(name); err != nil || card_type != want {
+			t.Errorf("ParseCardType(%q) = %q, %v", name, card_type, err)
+		}
+	}
+	if _, err := ParseCardType("reversed"); err == nil {
+		t.Error("Expected an error for an unknown card type")
+	}
+}
+
+func TestPromptVersion(t *testing.T) {
+	basic, cloze := PromptVersion(CARD_TYPE_BASIC), PromptVersion(CARD_TYPE_CLOZE)
+	if len(basic) != 12 || basic == cloze {
+		t.Errorf("Expected distinct versions per card type, got %q and %q", basic, cloze)
+	}
+	if PromptVersion(CARD_TYPE_BASIC) != basic {
+		t.Error("Expected the same version for the same prompts")
+	}
+}
@@ -0,0 +1,357 @@
+package ankify
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+const CRITIC_HELPER = `You're an AI reviewer of Anki cards. The cards were written following these rules:
+{rules}
+
+Score each card from 1 (useless) to 5 (follows every rule) and give the reason for the score in a few words. Problems found by an automatic check are listed under some cards.
+For each card scoring below {min_score} or with problems, rewrite it so it follows the rules and keeps its meaning, or leave the rewrite empty if the card cannot be saved.
+For a multiple-choice question rewrite only the question, the options stay as they are. For a cloze note keep the {{c1::...}} deletions in the question and put the extra in the answer.
+
+I want you to review the following {card_num} cards, {format}The cards are the following: 
+{cards}`
+
+// CRITIC_TEXT_FORMAT_HELPER fills the {format} placeholder of CRITIC_HELPER
+// for providers without structured output; replies are read with ParseCriticText.
+const CRITIC_TEXT_FORMAT_HELPER = `give it to me in the following format, one block per card: 
+
+Card: [Insert card number here] 
+Score: [Insert score from 1 to 5 here] 
+Reason: [Insert reason for the score here] 
+Q: [Insert rewritten question here, or leave empty] 
+A: [Insert rewritten answer here, or leave empty] 
+\n\n 
+
+`
+
+// CRITIC_JSON_FORMAT_HELPER fills the {format} placeholder of CRITIC_HELPER
+// for providers with structured output; replies are read with ParseCriticJSON.
+const CRITIC_JSON_FORMAT_HELPER = `give it to me as a JSON object with a "reviews" array, with one review per card holding its "card" number, its "score" from 1 to 5, the "reason" for the score and the rewritten "question" and "answer", which are empty when the card is not rewritten: 
+
+{"reviews": [{"card": 1, "score": 4, "reason": "[Insert reason here]", "question": "", "answer": ""}]}
+
+`
+
+// CriticSchema describes the reply expected for CRITIC_JSON_FORMAT_HELPER.
+var CriticSchema = Schema{
+	Name: "card_reviews",
+	Schema: json.RawMessage(`{
+	"type": "object",
+	"properties": {
+		"reviews": {
+			"type": "array",
+			"items": {
+				"type": "object",
+				"properties": {
+					"card": {"type": "integer"},
+					"score": {"type": "integer"},
+					"reason": {"type": "string"},
+					"question": {"type": "string"},
+					"answer": {"type": "string"}
+				},
+				"required": ["card", "score", "reason", "question", "answer"],
+				"additionalProperties": false
+			}
+		}
+	},
+	"required": ["reviews"],
+	"additionalProperties": false
+}`),
+}
+
+// DEFAULT_CRITIC_SCORE is the lowest critic score a card is kept with unchanged.
+const DEFAULT_CRITIC_SCORE = 3
+
+// CRITIC_BATCH_SIZE is the number of cards reviewed per request.
+const CRITIC_BATCH_SIZE = 10
+
+// CriticReview is the critic's verdict on one card.
+type CriticReview struct {
+	// Card is the 1-based number of the card in the request.
+	Card   int    `json:"card"`
+	Score  int    `json:"score"`
+	Reason string `json:"reason"`
+	// Question and Answer rewrite the card, and are empty to leave it as is.
+	Question string `json:"question"`
+	Answer   string `json:"answer"`
+}
+
+// Rejection is a card dropped by Validate, with the reason.
+type Rejection struct {
+	Card   AnkiQuestion
+	Reason string
+}
+
+func (r Rejection) String() string {
+	return fmt.Sprintf("%q: %s", r.Card.Question, r.Reason)
+}
+
+// Validate checks the cards against LintCard and, with Critic set, has the
+// provider score them and rewrite the weak ones. It returns the cards kept,
+// some of them rewritten, in order, and the cards dropped with the reason.
+// A card is dropped when it breaks a lint rule or scores below CriticScore
+// and the critic gave no rewrite that passes the lint rules. If a review
+// request fails, its cards are only linted and the error is returned with the
+// results.
+func (a *Ankifier) Validate(ctx context.Context, cards []AnkiQuestion) ([]AnkiQuestion, []Rejection, error) {
+	issues := make([][]LintIssue, len(cards))
+	for i, card := range cards {
+		issues[i] = LintCard(card)
+	}
+
+	reviews := make([]*CriticReview, len(cards))
+	var critic_err error
+	if a.Critic && len(cards) > 0 {
+		batches := (len(cards) + CRITIC_BATCH_SIZE - 1) / CRITIC_BATCH_SIZE
+		errs := runPool(ctx, a.Concurrency, batches, func(batch int) error {
+			start := batch * CRITIC_BATCH_SIZE
+			end := start + CRITIC_BATCH_SIZE
+			if end > len(cards) {
+				end = len(cards)
+			}
+			batch_reviews, err := a.review(ctx, cards[start:end], issues[start:end])
+			if err != nil {
+				return err
+			}
+			for _, review := range batch_reviews {
+				if review.Card >= 1 && review.Card <= end-start {
+					review := review
+					reviews[start+review.Card-1] = &review
+				}
+			}
+			return nil
+		})
+		for _, err := range errs {
+			if err != nil && critic_err == nil {
+				critic_err = fmt.Errorf("reviewing the cards: %w", err)
+			}
+		}
+	}
+
+	kept := []AnkiQuestion{}
+	rejections := []Rejection{}
+	for i, card := range cards {
+		review := reviews[i]
+		weak := review != nil && review.Score < a.criticScore()
+		if len(issues[i]) == 0 && !weak {
+			kept = append(kept, card)
+			continue
+		}
+
+		reasons := []string{}
+		if weak {
+			reasons = append(reasons, fmt.Sprintf("scored %d of 5: %s", review.Score, strings.TrimSpace(review.Reason)))
+		}
+		for _, issue := range issues[i] {
+			reasons = append(reasons, issue.String())
+		}
+		if review != nil && strings.TrimSpace(review.Question) != "" {
+			rewritten := rewriteCard(card, *review)
+			if err := checkRewrite(rewritten); err != nil {
+				reasons = append(reasons, fmt.Sprintf("the rewrite %q was rejected (%v)", rewritten.Question, err))
+			} else {
+				log.Printf("Rewrote %q as %q (%s).", card.Question, rewritten.Question, strings.Join(reasons, "; "))
+				kept = append(kept, rewritten)
+				continue
+			}
+		}
+		rejections = append(rejections, Rejection{Card: card, Reason: strings.Join(reasons, "; ")})
+	}
+	return kept, rejections, critic_err
+}
+
+func (a *Ankifier) criticScore() int {
+	if a.CriticScore > 0 {
+		return a.CriticScore
+	}
+	return DEFAULT_CRITIC_SCORE
+}
+
+// review asks the provider to review a batch of cards, whose lint issues are
+// listed with them.
+func (a *Ankifier) review(ctx context.Context, cards []AnkiQuestion, issues [][]LintIssue) ([]CriticReview, error) {
+	buildPrompt := func(format string) string {
+		prompt := strings.Replace(CRITIC_HELPER, "{rules}", promptRules(formatFor(a.CardType).prompt), 1)
+		prompt = strings.Replace(prompt, "{min_score}", strconv.Itoa(a.criticScore()), 1)
+		prompt = strings.Replace(prompt, "{card_num}", strconv.Itoa(len(cards)), 1)
+		prompt = strings.Replace(prompt, "{format}", format, 1)
+		return strings.Replace(prompt, "{cards}", criticCards(cards, issues), 1)
+	}
+
+	// Ask for schema-constrained JSON first, as for the cards themselves
+	if !a.textOnly() {
+		response, err := a.completeJSON(ctx, buildPrompt(CRITIC_JSON_FORMAT_HELPER), CriticSchema)
+		if err == nil {
+			return ParseCriticJSON(response)
+		}
+		if !isStructuredOutputUnsupported(err) {
+			return nil, err
+		}
+		log.Printf("%s has no structured output (%v), asking for text reviews instead.", a.Provider.Name(), err)
+		a.setTextOnly()
+	}
+	response, err := a.complete(ctx, buildPrompt(CRITIC_TEXT_FORMAT_HELPER))
+	if err != nil {
+		return nil, err
+	}
+	return ParseCriticText(response), nil
+}
+
+// promptRules returns the list of rules of a card prompt, the lines after
+// "should be:" up to the first blank line.
+func promptRules(prompt string) string {
+	start := strings.Index(prompt, "should be:\n")
+	if start < 0 {
+		return ""
+	}
+	rules := prompt[start+len("should be:\n"):]
+	if end := strings.Index(rules, "\n\n"); end >= 0 {
+		rules = rules[:end]
+	}
+	return strings.TrimSpace(rules)
+}
+
+// criticCards writes the numbered cards of a review request.
+func criticCards(cards []AnkiQuestion, issues [][]LintIssue) string {
+	var builder strings.Builder
+	for i, card := range cards {
+		fmt.Fprintf(&builder, "\nCard %d (%s)\nQ: %s\nA: %s\n", i+1, cardTypeName(card), card.Question, card.Answer)
+		if card.Choices != nil {
+			fmt.Fprintf(&builder, "Wrong options: %s\n", strings.Join(card.Choices.Distractors, "; "))
+		}
+		if len(issues[i]) > 0 {
+			problems := []string{}
+			for _, issue := range issues[i] {
+				problems = append(problems, issue.String())
+			}
+			fmt.Fprintf(&builder, "Problems: %s\n", strings.Join(problems, "; "))
+		}
+	}
+	return builder.String()
+}
+
+func cardTypeName(card AnkiQuestion) string {
+	switch card.Type {
+	case CARD_TYPE_CLOZE:
+		return "cloze note"
+	case CARD_TYPE_MULTIPLE_CHOICE:
+		return "multiple-choice question"
+	default:
+		return "question and answer"
+	}
+}
+
+// rewriteCard applies the critic's rewrite to a card, keeping its type,
+// options, tags and source. Multiple-choice cards keep their options, and an
+// empty rewritten answer keeps the card's answer.
+func rewriteCard(card AnkiQuestion, review CriticReview) AnkiQuestion {
+	card.Question = strings.TrimSpace(review.Question)
+	if answer := strings.TrimSpace(review.Answer); answer != "" && card.Type != CARD_TYPE_MULTIPLE_CHOICE {
+		card.Answer = answer
+	}
+	return card
+}
+
+// checkRewrite checks a rewritten card against the lint rules and the
+// validation of its type.
+func checkRewrite(card AnkiQuestion) error {
+	switch card.Type {
+	case CARD_TYPE_CLOZE:
+		if err := ValidateCloze(card.Question); err != nil {
+			return err
+		}
+	case CARD_TYPE_MULTIPLE_CHOICE:
+		if err := ValidateChoice(card); err != nil {
+			return err
+		}
+	}
+	if issues := LintCard(card); len(issues) > 0 {
+		return fmt.Errorf("%s", issues[0])
+	}
+	return nil
+}
+
+type jsonReviews struct {
+	Reviews []CriticReview `json:"reviews"`
+}
+
+// ParseCriticJSON reads a reply constrained by CriticSchema.
+func ParseCriticJSON(critic_json string) ([]CriticReview, error) {
+	var reply jsonReviews
+	if err := json.Unmarshal([]byte(stripCodeFence(critic_json)), &reply); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidCards, err)
+	}
+	if reply.Reviews == nil {
+		return nil, fmt.Errorf(`%w: missing "reviews" array`, ErrInvalidCards)
+	}
+	return reply.Reviews, nil
+}
+
+// criticLabel matches "Card:", "Card 2:", "**Score:**", "Q:", "Answer:" and the like.
+var criticLabel = regexp.MustCompile(`(?i)^(\*\*|__|\*|_)?\s*(card|score|reason|question|q|answer|a)\s*(\d*)\s*(\*\*|__|\*|_)?\s*[:：]\s*(\*\*|__|\*|_)?\s*(.*)$`)
+
+var firstNumber = regexp.MustCompile(`\d+`)
+
+// ParseCriticText reads a reply in the Card:/Score:/Reason:/Q:/A: format.
+// Each "Card:" line starts a review; lines without a label continue the
+// field above them, and reviews without a card number are skipped.
+func ParseCriticText(critic_text string) []CriticReview {
+	reviews := []CriticReview{}
+	var current *CriticReview
+	var field *string
+	flush := func() {
+		if current != nil && current.Card > 0 {
+			current.Reason = strings.TrimSpace(current.Reason)
+			current.Question = strings.TrimSpace(current.Question)
+			current.Answer = strings.TrimSpace(current.Answer)
+			reviews = append(reviews, *current)
+		}
+		current, field = nil, nil
+	}
+
+	for _, line := range strings.Split(strings.ReplaceAll(critic_text, "\r\n", "\n"), "\n") {
+		cleaned := strings.TrimSpace(listMarker.ReplaceAllString(strings.TrimSpace(line), ""))
+		match := criticLabel.FindStringSubmatch(cleaned)
+		if match == nil {
+			if field != nil && cleaned != "" {
+				*field += "\n" + cleaned
+			}
+			continue
+		}
+		value := strings.TrimSpace(match[6])
+		switch strings.ToLower(match[2]) {
+		case "card":
+			flush()
+			current = &CriticReview{}
+			current.Card, _ = strconv.Atoi(firstNumber.FindString(match[3] + " " + value))
+		case "score":
+			if current != nil {
+				current.Score, _ = strconv.Atoi(firstNumber.FindString(value))
+			}
+			field = nil
+		case "reason":
+			if current != nil {
+				current.Reason, field = value, &current.Reason
+			}
+		case "question", "q":
+			if current != nil {
+				current.Question, field = value, &current.Question
+			}
+		case "answer", "a":
+			if current != nil {
+				current.Answer, field = value, &current.Answer
+			}
+		}
+	}
+	flush()
+	return reviews
+}
@@ -0,0 +1,173 @@
+package ankify
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestValidateLintOnly(t *testing.T) {
+
+	// Arrange
+	provider := &fakeProvider{}
+	ankifier := NewAnkifier(provider)
+	cards := []AnkiQuestion{
+		{Question: "Which city is the capital of Germany?", Answer: "Berlin"},
+		{Question: "Is Berlin in Germany?", Answer: "Yes"},
+	}
+
+	// Act
+	kept, rejections, err := ankifier.Validate(context.Background(), cards)
+
+	// Assert
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(provider.prompts) != 0 {
+		t.Error("Expected no request without a critic")
+	}
+	if len(kept) != 1 || kept[0].Answer != "Berlin" {
+		t.Errorf("Unexpected kept cards %+v", kept)
+	}
+	if len(rejections) != 1 || !strings.Contains(rejections[0].Reason, LINT_YES_NO) {
+		t.Errorf("Expected the yes-no card to be dropped, got %+v", rejections)
+	}
+}
+
+func TestValidateTextCritic(t *testing.T) {
+
+	// Arrange
+	provider := &fakeProvider{reply: `Card: 1
+Score: 5
+Reason: Clear and specific.
+Q:
+A:
+
+**Card 2:**
+Score: 2
+Reason: Yes-no question.
+Q: Which country is Berlin the capital of?
+A: Germany
+
+Card: 3
+Score: 1
+Reason: Vague, nothing to recall.
+Q:
+A:
+
+Card: 4
+Score: 2
+Reason: Refers to the text.
+Q: What does the passage say about Berlin?
+A: It is big`}
+	ankifier := NewAnkifier(provider)
+	ankifier.Critic = true
+	cards := []AnkiQuestion{
+		{Question: "Which city is the capital of Germany?", Answer: "Berlin", Tag: "geo"},
+		{Question: "Is Berlin in Germany?", Answer: "Yes", Tag: "geo"},
+		{Question: "What about Berlin?", Answer: "Things"},
+		{Question: "What is said in the text about Berlin?", Answer: "It is big"},
+		{Question: "What river flows through Berlin?", Answer: "The Spree"},
+	}
+
+	// Act
+	kept, rejections, err := ankifier.Validate(context.Background(), cards)
+
+	// Assert
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(provider.prompts) != 1 {
+		t.Fatalf("Expected one review request, got %d", len(provider.prompts))
+	}
+	prompt := provider.prompts[0]
+	if !strings.Contains(prompt, "- Not a yes-no questions") || !strings.Contains(prompt, "Problems: "+LINT_YES_NO) || !strings.Contains(prompt, "Card 5 (question and answer)") {
+		t.Errorf("Expected the rules, cards and problems in the prompt, got %s", prompt)
+	}
+	if len(kept) != 3 || kept[1].Question != "Which country is Berlin the capital of?" || kept[1].Answer != "Germany" || kept[1].Tag != "geo" {
+		t.Errorf("Expected the second card to be rewritten, got %+v", kept)
+	}
+	if kept[2].Question != cards[4].Question {
+		t.Errorf("Expected the card without a review to be kept, got %+v", kept[2])
+	}
+	if len(rejections) != 2 {
+		t.Fatalf("Expected 2 rejections, got %+v", rejections)
+	}
+	if rejections[0].Reason != "scored 1 of 5: Vague, nothing to recall." {
+		t.Errorf("Unexpected reason %q", rejections[0].Reason)
+	}
+	if !strings.Contains(rejections[1].Reason, LINT_FORBIDDEN_PHRASE) || !strings.Contains(rejections[1].Reason, "the rewrite") {
+		t.Errorf("Expected a rejected rewrite, got %q", rejections[1].Reason)
+	}
+}
+
+func TestValidateStructuredCritic(t *testing.T) {
+
+	// Arrange
+	var received OpenAIRequest
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		json.NewDecoder(r.Body).Decode(&received)
+		reply, _ := json.Marshal(map[string]interface{}{"reviews": []CriticReview{
+			{Card: 1, Score: 2, Reason: "Hides a filler word.", Question: "{{c1::Berlin}} is the capital of {{c2::Germany}}.", Answer: ""},
+			{Card: 2, Score: 4, Reason: "Fine."},
+		}})
+		content, _ := json.Marshal(string(reply))
+		w.Write([]byte(`{"choices":[{"message":{"role":"assistant","content":` + string(content) + `}}]}`))
+	}))
+	defer server.Close()
+
+	provider, err := NewProvider(ProviderConfig{BaseURL: server.URL})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ankifier := NewAnkifier(provider)
+	ankifier.CardType = CARD_TYPE_CLOZE
+	ankifier.Critic = true
+	cards := []AnkiQuestion{
+		{Question: "Berlin {{c1::is}} the capital of Germany.", Answer: "Since 1990.", Type: CARD_TYPE_CLOZE},
+		{Question: "The {{c1::Spree}} flows through Berlin.", Type: CARD_TYPE_CLOZE},
+	}
+
+	// Act
+	kept, rejections, err := ankifier.Validate(context.Background(), cards)
+
+	// Assert
+	if err != nil {
+		t.Fatal(err)
+	}
+	if received.ResponseFormat == nil || received.ResponseFormat.JSONSchema.Name != CriticSchema.Name {
+		t.Errorf("Expected the critic schema, got %+v", received.ResponseFormat)
+	}
+	if !strings.Contains(received.Messages[0].Content, "Hide key terms") {
+		t.Error("Expected the cloze rules in the prompt")
+	}
+	if len(rejections) != 0 || len(kept) != 2 {
+		t.Fatalf("Expected both cards kept, got %+v and %+v", kept, rejections)
+	}
+	if kept[0].Question != "{{c1::Berlin}} is the capital of {{c2::Germany}}." || kept[0].Answer != "Since 1990." || kept[0].Type != CARD_TYPE_CLOZE {
+		t.Errorf("Expected the rewritten note with its extra, got %+v", kept[0])
+	}
+}
+
+func TestParseCriticText(t *testing.T) {
+
+	// Arrange
+	reply := "1. Card: 1\n   Score: 3/5\n   Reason: Too broad,\n   could mean anything.\nQuestion: What is Go?\nAnswer:\n\nCard 2: \nScore: 5\n\nScore: 4"
+
+	// Act
+	reviews := ParseCriticText(reply)
+
+	// Assert
+	if len(reviews) != 2 {
+		t.Fatalf("Expected 2 reviews, got %+v", reviews)
+	}
+	if reviews[0].Card != 1 || reviews[0].Score != 3 || reviews[0].Reason != "Too broad,\ncould mean anything." || reviews[0].Question != "What is Go?" || reviews[0].Answer != "" {
+		t.Errorf("Unexpected first review %+v", reviews[0])
+	}
+	if reviews[1].Card != 2 || reviews[1].Score != 4 {
+		t.Errorf("Unexpected second review %+v", reviews[1])
+	}
+}
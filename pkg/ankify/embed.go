@@ -0,0 +1,69 @@
+package ankify
+
+import (
+	"context"
+	"errors"
+	"net/url"
+	"strings"
+)
+
+// EmbeddingProvider is implemented by providers that can turn texts into
+// embedding vectors, used to find cards that mean the same thing.
+type EmbeddingProvider interface {
+	Provider
+	// Embed returns one vector per text, in order.
+	Embed(ctx context.Context, texts []string) ([][]float64, Usage, error)
+}
+
+// ErrEmbeddingsUnsupported is returned by Embed when the provider has no
+// embeddings endpoint.
+var ErrEmbeddingsUnsupported = errors.New("embeddings not supported")
+
+const DEFAULT_OPENAI_EMBEDDING_MODEL = "text-embedding-3-small"
+const DEFAULT_OLLAMA_EMBEDDING_MODEL = "nomic-embed-text"
+
+type EmbeddingRequest struct {
+	Model string   `json:"model"`
+	Input []string `json:"input"`
+}
+
+type EmbeddingResponse struct {
+	Data []struct {
+		Embedding []float64 `json:"embedding"`
+		Index     int       `json:"index"`
+	} `json:"data"`
+	Usage Usage `json:"usage"`
+}
+
+type OllamaEmbedResponse struct {
+	Model           string      `json:"model"`
+	Embeddings      [][]float64 `json:"embeddings"`
+	PromptEvalCount int         `json:"prompt_eval_count"`
+	Error           string      `json:"error"`
+}
+
+// EmbeddingModel returns the model a provider computes embeddings with, or ""
+// if it has none.
+func EmbeddingModel(provider Provider) string {
+	switch p := provider.(type) {
+	case *RetryingProvider:
+		return EmbeddingModel(p.Provider)
+	case *OpenAIProvider:
+		return p.EmbeddingModel
+	case *OllamaProvider:
+		return p.EmbeddingModel
+	default:
+		return ""
+	}
+}
+
+// embeddingsURL turns the chat completions URL of an OpenAI-compatible server
+// into its embeddings URL, keeping any query such as Azure's api-version.
+func embeddingsURL(chat_url string) string {
+	parsed, err := url.Parse(chat_url)
+	if err != nil {
+		return strings.TrimSuffix(chat_url, "/chat/completions") + "/embeddings"
+	}
+	parsed.Path = strings.TrimSuffix(strings.TrimSuffix(parsed.Path, "/"), "/chat/completions") + "/embeddings"
+	return parsed.String()
+}
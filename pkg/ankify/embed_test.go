@@ -0,0 +1,89 @@
+package ankify
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestOpenAIProviderEmbed(t *testing.T) {
+
+	// Arrange
+	var received EmbeddingRequest
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v1/embeddings" || r.URL.Query().Get("api-version") != "1" {
+			t.Errorf("Expected /v1/embeddings?api-version=1, got %s", r.URL)
+		}
+		json.NewDecoder(r.Body).Decode(&received)
+		// Answer out of order, as the index says where each vector goes
+		w.Write([]byte(`{"data":[{"embedding":[0,1],"index":1},{"embedding":[1,0],"index":0}],"usage":{"prompt_tokens":7,"total_tokens":7}}`))
+	}))
+	defer server.Close()
+
+	provider := &OpenAIProvider{Label: "openai", URL: server.URL + "/v1/chat/completions?api-version=1", Client: server.Client(), EmbeddingModel: "embedder"}
+
+	// Act
+	vectors, usage, err := NewRetryingProvider(provider, DefaultRetryPolicy).Embed(context.Background(), []string{"first", "second"})
+
+	// Assert
+	if err != nil {
+		t.Fatal(err)
+	}
+	if received.Model != "embedder" || len(received.Input) != 2 {
+		t.Errorf("Unexpected request %+v", received)
+	}
+	if len(vectors) != 2 || vectors[0][0] != 1 || vectors[1][1] != 1 {
+		t.Errorf("Unexpected vectors %v", vectors)
+	}
+	if usage.TotalTokens != 7 {
+		t.Errorf("Expected 7 tokens, got %d", usage.TotalTokens)
+	}
+}
+
+func TestOllamaProviderEmbed(t *testing.T) {
+
+	// Arrange
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/api/embed" {
+			t.Errorf("Expected /api/embed, got %s", r.URL.Path)
+		}
+		w.Write([]byte(`{"model":"nomic-embed-text","embeddings":[[0.5,0.5]],"prompt_eval_count":3}`))
+	}))
+	defer server.Close()
+
+	provider := &OllamaProvider{Host: server.URL, Client: server.Client(), EmbeddingModel: "nomic-embed-text"}
+
+	// Act
+	vectors, usage, err := provider.Embed(context.Background(), []string{"text"})
+
+	// Assert
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(vectors) != 1 || len(vectors[0]) != 2 || usage.PromptTokens != 3 {
+		t.Errorf("Unexpected vectors %v and usage %+v", vectors, usage)
+	}
+}
+
+func TestEmbedUnsupported(t *testing.T) {
+
+	// Arrange
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNotFound)
+	}))
+	defer server.Close()
+
+	provider := &OpenAIProvider{Label: "llamacpp", URL: server.URL + "/v1/chat/completions", Client: server.Client()}
+
+	// Act
+	_, _, err := provider.Embed(context.Background(), []string{"text"})
+	_, _, wrapped_err := NewRetryingProvider(&fakeProvider{}, DefaultRetryPolicy).Embed(context.Background(), []string{"text"})
+
+	// Assert
+	if !errors.Is(err, ErrEmbeddingsUnsupported) || !errors.Is(wrapped_err, ErrEmbeddingsUnsupported) {
+		t.Errorf("Expected ErrEmbeddingsUnsupported, got %v and %v", err, wrapped_err)
+	}
+}
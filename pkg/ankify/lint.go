@@ -0,0 +1,165 @@
+package ankify
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+)
+
+// Rules checked by LintCard, after the QUESTION_HELPER, CLOZE_HELPER and
+// CHOICE_HELPER instructions.
+const (
+	LINT_EMPTY             = "empty"
+	LINT_TOO_LONG          = "too long"
+	LINT_YES_NO            = "yes-no question"
+	LINT_FORBIDDEN_PHRASE  = "forbidden phrase"
+	LINT_RESTATES_QUESTION = "answer restates the question"
+)
+
+// MAX_QUESTION_WORDS, MAX_ANSWER_WORDS and MAX_CLOZE_WORDS bound the length
+// of a concise card.
+const MAX_QUESTION_WORDS = 40
+const MAX_ANSWER_WORDS = 60
+const MAX_CLOZE_WORDS = 80
+
+// FORBIDDEN_PHRASES refer to the text the card was written from, which is
+// not there when the card is reviewed.
+var FORBIDDEN_PHRASES = []string{
+	"in the passage",
+	"in this passage",
+	"from the passage",
+	"according to the passage",
+	"the passage say",
+	"the passage says",
+	"the passage mentions",
+	"in the text",
+	"in this text",
+	"in the article",
+	"in this article",
+	"according to the text",
+	"according to the article",
+	"the text say",
+	"the text says",
+	"the text mentions",
+}
+
+// yesNoStarters are the words a yes-no question starts with.
+var yesNoStarters = map[string]bool{
+	"is": true, "are": true, "was": true, "were": true, "am": true,
+	"do": true, "does": true, "did": true,
+	"can": true, "could": true, "will": true, "would": true, "shall": true, "should": true,
+	"may": true, "might": true, "must": true,
+	"has": true, "have": true, "had": true,
+	"isn": true, "aren": true, "wasn": true, "weren": true, "don": true, "doesn": true, "didn": true,
+	"won": true, "wouldn": true, "shouldn": true, "hasn": true, "haven": true,
+}
+
+// yesNoAnswers are the answers of a yes-no question.
+var yesNoAnswers = map[string]bool{"yes": true, "no": true, "true": true, "false": true}
+
+// stopWords do not count when comparing the words of an answer and its question.
+var stopWords = map[string]bool{
+	"a": true, "an": true, "the": true, "of": true, "to": true, "in": true, "on": true, "at": true, "by": true,
+	"for": true, "with": true, "and": true, "or": true, "is": true, "are": true, "was": true, "were": true,
+	"be": true, "it": true, "its": true, "this": true, "that": true, "what": true, "which": true, "who": true,
+	"how": true, "why": true, "when": true, "where": true, "does": true, "do": true, "did": true,
+}
+
+// LintIssue is a rule a card breaks.
+type LintIssue struct {
+	Rule    string
+	Message string
+}
+
+func (i LintIssue) String() string {
+	return i.Rule + ": " + i.Message
+}
+
+// LintCard checks a card against the rules its prompt asks for: a question
+// and answer, concise sides, no yes-no question, no reference to "the text"
+// and an answer that does more than repeat its question.
+func LintCard(card AnkiQuestion) []LintIssue {
+	issues := []LintIssue{}
+	card_type := card.Type
+	if card_type == "" {
+		card_type = CARD_TYPE_BASIC
+	}
+	// Check a cloze note as it reads once revealed
+	question := ClozeText(card.Question)
+	question_words := lintWords(question)
+	answer_words := lintWords(card.Answer)
+
+	if len(question_words) == 0 {
+		issues = append(issues, LintIssue{LINT_EMPTY, "the question is empty"})
+	}
+	if len(answer_words) == 0 && card_type != CARD_TYPE_CLOZE {
+		issues = append(issues, LintIssue{LINT_EMPTY, "the answer is empty"})
+	}
+
+	max_question_words := MAX_QUESTION_WORDS
+	if card_type == CARD_TYPE_CLOZE {
+		max_question_words = MAX_CLOZE_WORDS
+	}
+	if len(question_words) > max_question_words {
+		issues = append(issues, LintIssue{LINT_TOO_LONG, fmt.Sprintf("the question has %d words, more than %d", len(question_words), max_question_words)})
+	}
+	if len(answer_words) > MAX_ANSWER_WORDS {
+		issues = append(issues, LintIssue{LINT_TOO_LONG, fmt.Sprintf("the answer has %d words, more than %d", len(answer_words), MAX_ANSWER_WORDS)})
+	}
+
+	if card_type != CARD_TYPE_CLOZE && len(question_words) > 0 {
+		// "Is it X or Y?" asks to choose, not to say yes or no
+		if yesNoStarters[question_words[0]] && !containsWord(question_words, "or") {
+			issues = append(issues, LintIssue{LINT_YES_NO, fmt.Sprintf("the question starts with %q", question_words[0])})
+		} else if len(answer_words) > 0 && yesNoAnswers[answer_words[0]] {
+			issues = append(issues, LintIssue{LINT_YES_NO, fmt.Sprintf("the answer starts with %q", answer_words[0])})
+		}
+	}
+
+	text := " " + strings.Join(question_words, " ") + " " + strings.Join(answer_words, " ") + " "
+	for _, phrase := range FORBIDDEN_PHRASES {
+		if strings.Contains(text, " "+phrase+" ") {
+			issues = append(issues, LintIssue{LINT_FORBIDDEN_PHRASE, fmt.Sprintf("the card says %q", phrase)})
+			break
+		}
+	}
+
+	// The answer to "Is it X or Y?" is one of the options
+	if card_type == CARD_TYPE_BASIC && !containsWord(question_words, "or") && restates(question_words, answer_words) {
+		issues = append(issues, LintIssue{LINT_RESTATES_QUESTION, "every word of the answer is in the question"})
+	}
+	return issues
+}
+
+// restates reports whether the answer has meaningful words and all of them
+// are in the question.
+func restates(question_words []string, answer_words []string) bool {
+	content := 0
+	for _, word := range answer_words {
+		if stopWords[word] {
+			continue
+		}
+		if !containsWord(question_words, word) {
+			return false
+		}
+		content++
+	}
+	return content > 0
+}
+
+// lintWords splits text into lowercase words of letters and digits, so
+// "Isn't" is "isn" and "t".
+func lintWords(text string) []string {
+	return strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+}
+
+func containsWord(words []string, word string) bool {
+	for _, w := range words {
+		if w == word {
+			return true
+		}
+	}
+	return false
+}
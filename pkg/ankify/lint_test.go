@@ -0,0 +1,44 @@
+package ankify
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestLintCard(t *testing.T) {
+	tests := []struct {
+		name  string
+		card  AnkiQuestion
+		rules []string
+	}{
+		{"good card", AnkiQuestion{Question: "Which city is the capital of Germany?", Answer: "Berlin"}, nil},
+		{"empty answer", AnkiQuestion{Question: "What is Go?", Answer: " "}, []string{LINT_EMPTY}},
+		{"yes-no question", AnkiQuestion{Question: "Is Berlin the capital of Germany?", Answer: "Indeed, since 1990"}, []string{LINT_YES_NO}},
+		{"contraction", AnkiQuestion{Question: "Isn't Berlin the capital?", Answer: "It is"}, []string{LINT_YES_NO}},
+		{"alternative question", AnkiQuestion{Question: "Is Go compiled or interpreted?", Answer: "Compiled"}, nil},
+		{"yes-no answer", AnkiQuestion{Question: "Which statement holds for Go?", Answer: "Yes, it is compiled"}, []string{LINT_YES_NO}},
+		{"forbidden phrase", AnkiQuestion{Question: "What city is named in the text?", Answer: "Berlin"}, []string{LINT_FORBIDDEN_PHRASE}},
+		{"restated question", AnkiQuestion{Question: "What is the capital of Germany?", Answer: "The capital of Germany."}, []string{LINT_RESTATES_QUESTION}},
+		{"too long", AnkiQuestion{Question: strings.Repeat("word ", MAX_QUESTION_WORDS) + "why?", Answer: "Because"}, []string{LINT_TOO_LONG}},
+		{"cloze note", AnkiQuestion{Question: "{{c1::Berlin::city}} is the capital of Germany.", Type: CARD_TYPE_CLOZE}, nil},
+		{"passage of a law", AnkiQuestion{Question: "What did the passage of the 19th Amendment grant?", Answer: "Women the right to vote"}, nil},
+		{"cloze in the passage", AnkiQuestion{Question: "{{c1::Berlin}} is the capital in the passage.", Type: CARD_TYPE_CLOZE}, []string{LINT_FORBIDDEN_PHRASE}},
+		{"true or false option", AnkiQuestion{Question: "Which is right about Berlin?", Answer: "True", Type: CARD_TYPE_MULTIPLE_CHOICE}, []string{LINT_YES_NO}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+
+			// Act
+			issues := LintCard(test.card)
+
+			// Assert
+			rules := []string{}
+			for _, issue := range issues {
+				rules = append(rules, issue.Rule)
+			}
+			if strings.Join(rules, ",") != strings.Join(test.rules, ",") {
+				t.Errorf("Expected %v, got %v", test.rules, issues)
+			}
+		})
+	}
+}
@@ -0,0 +1,238 @@
+package ankify
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+)
+
+const DEFAULT_OLLAMA_HOST = "http://localhost:11434"
+
+// DEFAULT_OLLAMA_PORT is the port of an OLLAMA_HOST given without scheme or port.
+const DEFAULT_OLLAMA_PORT = "11434"
+const DEFAULT_OLLAMA_MODEL = "llama3"
+const DEFAULT_LLAMACPP_HOST = "http://localhost:8080"
+
+type OllamaRequest struct {
+	Model    string           `json:"model"`
+	Messages []RequestMessage `json:"messages"`
+	Stream   bool             `json:"stream"`
+	Options  *OllamaOptions   `json:"options,omitempty"`
+	// Format is a JSON schema the reply must match, see CompleteJSON.
+	Format json.RawMessage `json:"format,omitempty"`
+}
+
+// OllamaOptions holds the sampling parameters Ollama accepts per request.
+type OllamaOptions struct {
+	Temperature *float64 `json:"temperature,omitempty"`
+	NumPredict  int      `json:"num_predict,omitempty"`
+	Seed        *int     `json:"seed,omitempty"`
+}
+
+type OllamaResponse struct {
+	Model           string          `json:"model"`
+	Message         ResponseMessage `json:"message"`
+	Done            bool            `json:"done"`
+	PromptEvalCount int             `json:"prompt_eval_count"`
+	EvalCount       int             `json:"eval_count"`
+	Error           string          `json:"error"`
+}
+
+// OllamaProvider sends chat requests to a local Ollama server, so no text leaves the machine.
+type OllamaProvider struct {
+	Host    string
+	Model   string
+	Client  *http.Client
+	Options *OllamaOptions
+	// EmbeddingModel is the model Embed sends texts to.
+	EmbeddingModel string
+}
+
+// NewOllamaProvider returns an OllamaProvider configured from OLLAMA_HOST and OLLAMA_MODEL.
+func NewOllamaProvider() *OllamaProvider {
+	return &OllamaProvider{
+		Host:   getEnvOrDefault("OLLAMA_HOST", DEFAULT_OLLAMA_HOST),
+		Model:  getEnvOrDefault("OLLAMA_MODEL", DEFAULT_OLLAMA_MODEL),
+		Client: &http.Client{Timeout: DEFAULT_HTTP_TIMEOUT},
+
+		EmbeddingModel: getEnvOrDefault("OLLAMA_EMBEDDING_MODEL", DEFAULT_OLLAMA_EMBEDDING_MODEL),
+	}
+}
+
+// ollamaURL turns a host given the way Ollama reads OLLAMA_HOST into a base
+// URL: "0.0.0.0" and "127.0.0.1:11434" get the http scheme, and a host with
+// neither scheme nor port gets DEFAULT_OLLAMA_PORT.
+func ollamaURL(host string) string {
+	host = strings.TrimSuffix(strings.TrimSpace(host), "/")
+	if strings.Contains(host, "://") {
+		return host
+	}
+	address, path := host, ""
+	if i := strings.Index(host, "/"); i >= 0 {
+		address, path = host[:i], host[i:]
+	}
+	if _, _, err := net.SplitHostPort(address); err != nil {
+		address = net.JoinHostPort(strings.Trim(address, "[]"), DEFAULT_OLLAMA_PORT)
+	}
+	if strings.HasPrefix(address, ":") {
+		address = "127.0.0.1" + address
+	}
+	return "http://" + address + path
+}
+
+func (p *OllamaProvider) Name() string {
+	return "ollama"
+}
+
+// configure applies the non-zero fields of config to the provider.
+func (p *OllamaProvider) configure(config ProviderConfig) {
+	if config.BaseURL != "" {
+		p.Host = config.BaseURL
+	}
+	if config.Model != "" {
+		p.Model = config.Model
+	}
+	if config.EmbeddingModel != "" {
+		p.EmbeddingModel = config.EmbeddingModel
+	}
+	if config.Temperature != nil || config.MaxTokens > 0 || config.Seed != nil {
+		p.Options = &OllamaOptions{
+			Temperature: config.Temperature,
+			NumPredict:  config.MaxTokens,
+			Seed:        config.Seed,
+		}
+	}
+}
+
+// Complete sends the messages to the /api/chat endpoint with streaming disabled.
+func (p *OllamaProvider) Complete(ctx context.Context, messages []RequestMessage) (string, Usage, error) {
+	return p.complete(ctx, messages, nil)
+}
+
+// CompleteJSON is like Complete but passes schema as the request's "format",
+// which Ollama uses to constrain the reply.
+func (p *OllamaProvider) CompleteJSON(ctx context.Context, messages []RequestMessage, schema Schema) (string, Usage, error) {
+	return p.complete(ctx, messages, schema.Schema)
+}
+
+func (p *OllamaProvider) complete(ctx context.Context, messages []RequestMessage, format json.RawMessage) (string, Usage, error) {
+	json_data, err := json.Marshal(OllamaRequest{
+		Model:    p.Model,
+		Messages: messages,
+		Stream:   false,
+		Options:  p.Options,
+		Format:   format,
+	})
+	if err != nil {
+		return "", Usage{}, err
+	}
+
+	url := ollamaURL(p.Host) + "/api/chat"
+	req, err := http.NewRequestWithContext(ctx, "POST", url, bytes.NewBuffer(json_data))
+	if err != nil {
+		return "", Usage{}, err
+	}
+	req.Header.Add("Content-Type", "application/json")
+
+	resp, err := p.Client.Do(req)
+	if err != nil {
+		return "", Usage{}, err
+	}
+	defer resp.Body.Close()
+
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return "", Usage{}, err
+	}
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return "", Usage{}, newAPIError(p.Name(), resp, body)
+	}
+
+	var response OllamaResponse
+	if err := json.Unmarshal(body, &response); err != nil {
+		return "", Usage{}, fmt.Errorf("decoding ollama response: %w", err)
+	}
+	if response.Error != "" {
+		return "", Usage{}, fmt.Errorf("ollama error: %s", response.Error)
+	}
+	if response.Message.Content == "" {
+		return "", Usage{}, fmt.Errorf("%w: %s", ErrEmptyResponse, string(body))
+	}
+	usage := Usage{
+		PromptTokens:     response.PromptEvalCount,
+		CompletionTokens: response.EvalCount,
+		TotalTokens:      response.PromptEvalCount + response.EvalCount,
+	}
+	return response.Message.Content, usage, nil
+}
+
+// Embed sends the texts to the /api/embed endpoint in a single request.
+func (p *OllamaProvider) Embed(ctx context.Context, texts []string) ([][]float64, Usage, error) {
+	json_data, err := json.Marshal(EmbeddingRequest{Model: p.EmbeddingModel, Input: texts})
+	if err != nil {
+		return nil, Usage{}, err
+	}
+
+	url := ollamaURL(p.Host) + "/api/embed"
+	req, err := http.NewRequestWithContext(ctx, "POST", url, bytes.NewBuffer(json_data))
+	if err != nil {
+		return nil, Usage{}, err
+	}
+	req.Header.Add("Content-Type", "application/json")
+
+	resp, err := p.Client.Do(req)
+	if err != nil {
+		return nil, Usage{}, err
+	}
+	defer resp.Body.Close()
+
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, Usage{}, err
+	}
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return nil, Usage{}, newAPIError(p.Name(), resp, body)
+	}
+
+	var response OllamaEmbedResponse
+	if err := json.Unmarshal(body, &response); err != nil {
+		return nil, Usage{}, fmt.Errorf("decoding ollama embeddings: %w", err)
+	}
+	if response.Error != "" {
+		return nil, Usage{}, fmt.Errorf("ollama error: %s", response.Error)
+	}
+	usage := Usage{PromptTokens: response.PromptEvalCount, TotalTokens: response.PromptEvalCount}
+	if len(response.Embeddings) != len(texts) {
+		return nil, usage, fmt.Errorf("ollama returned %d embeddings for %d texts", len(response.Embeddings), len(texts))
+	}
+	return response.Embeddings, usage, nil
+}
+
+// NewLlamaCppProvider returns a provider for a llama.cpp server, which exposes
+// an OpenAI-compatible chat endpoint and needs no API key.
+func NewLlamaCppProvider() *OpenAIProvider {
+	host := getEnvOrDefault("LLAMACPP_HOST", DEFAULT_LLAMACPP_HOST)
+	return &OpenAIProvider{
+		Label:  "llamacpp",
+		URL:    strings.TrimSuffix(host, "/") + "/v1/chat/completions",
+		Model:  getEnvOrDefault("LLAMACPP_MODEL", "local"),
+		Client: &http.Client{Timeout: DEFAULT_HTTP_TIMEOUT},
+
+		// llama.cpp embeds with the model it serves, when started with --embeddings
+		EmbeddingModel: getEnvOrDefault("LLAMACPP_MODEL", "local"),
+	}
+}
+
+func getEnvOrDefault(key string, fallback string) string {
+	if value := os.Getenv(key); value != "" {
+		return value
+	}
+	return fallback
+}
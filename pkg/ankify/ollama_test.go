@@ -0,0 +1,144 @@
+package ankify
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestOllamaProvider(t *testing.T) {
+
+	// Arrange
+	var received OllamaRequest
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/api/chat" {
+			t.Errorf("Expected /api/chat, got %s", r.URL.Path)
+		}
+		json.NewDecoder(r.Body).Decode(&received)
+		w.Write([]byte(`{"model":"llama3","message":{"role":"assistant","content":"{\"cards\":[{\"question\":\"What is Berlin?\",\"answer\":\"The capital of Germany\"}]}"},"done":true,"prompt_eval_count":40,"eval_count":12}`))
+	}))
+	defer server.Close()
+
+	provider := &OllamaProvider{Host: server.URL, Model: "llama3", Client: server.Client()}
+	ankifier := NewAnkifier(provider)
+
+	// Act
+	res, err := ankifier.Ankify(context.Background(), map[int]string{1: "The capital of Germany is Berlin."}, 1)
+
+	// Assert
+	if err != nil {
+		t.Fatal(err)
+	}
+	if received.Stream || received.Model != "llama3" {
+		t.Errorf("Expected a non-streaming llama3 request, got %+v", received)
+	}
+	if !strings.Contains(string(received.Format), `"required":["cards"]`) {
+		t.Errorf("Expected the card schema as format, got %s", received.Format)
+	}
+	if !strings.Contains(received.Messages[0].Content, "Anki questions") {
+		t.Error("Expected the QUESTION_HELPER prompt to be sent")
+	}
+	if len(res.Questions) != 1 || res.Questions[0].Answer != "The capital of Germany" {
+		t.Errorf("Unexpected questions: %+v", res.Questions)
+	}
+	if ankifier.Usage.TotalTokens != 52 {
+		t.Errorf("Expected 52 total tokens, got %d", ankifier.Usage.TotalTokens)
+	}
+}
+
+func TestOllamaProviderError(t *testing.T) {
+
+	// Arrange
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNotFound)
+		w.Write([]byte(`{"error":"model 'llama3' not found"}`))
+	}))
+	defer server.Close()
+
+	provider := &OllamaProvider{Host: server.URL, Model: "llama3", Client: server.Client()}
+
+	// Act
+	_, _, err := provider.Complete(context.Background(), []RequestMessage{{Role: "user", Content: "hi"}})
+
+	// Assert
+	if err == nil || !strings.Contains(err.Error(), "not found") {
+		t.Errorf("Expected a model not found error, got %v", err)
+	}
+}
+
+func TestOllamaURL(t *testing.T) {
+	tests := map[string]string{
+		"http://localhost:11434/": "http://localhost:11434",
+		"https://ollama.example":  "https://ollama.example",
+		"127.0.0.1:11434":         "http://127.0.0.1:11434",
+		"0.0.0.0":                 "http://0.0.0.0:11434",
+		"ollama.lan/proxy":        "http://ollama.lan:11434/proxy",
+		":8080":                   "http://127.0.0.1:8080",
+		"[::1]":                   "http://[::1]:11434",
+	}
+	for host, expected := range tests {
+		if got := ollamaURL(host); got != expected {
+			t.Errorf("ollamaURL(%q) = %q, expected %q", host, got, expected)
+		}
+	}
+}
+
+func TestOllamaProviderHostWithoutScheme(t *testing.T) {
+
+	// Arrange
+	var path string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		path = r.URL.Path
+		w.Write([]byte(`{"message":{"role":"assistant","content":"ok"},"done":true}`))
+	}))
+	defer server.Close()
+
+	t.Setenv("OLLAMA_HOST", strings.TrimPrefix(server.URL, "http://"))
+	provider := NewOllamaProvider()
+
+	// Act
+	content, _, err := provider.Complete(context.Background(), []RequestMessage{{Role: "user", Content: "hi"}})
+
+	// Assert
+	if err != nil {
+		t.Fatal(err)
+	}
+	if content != "ok" || path != "/api/chat" {
+		t.Errorf("Expected ok from /api/chat, got %q from %s", content, path)
+	}
+}
+
+func TestLlamaCppProvider(t *testing.T) {
+
+	// Arrange
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v1/chat/completions" {
+			t.Errorf("Expected /v1/chat/completions, got %s", r.URL.Path)
+		}
+		if r.Header.Get("Authorization") != "" {
+			t.Error("Expected no Authorization header for a local server")
+		}
+		w.Write([]byte(`{"choices":[{"message":{"role":"assistant","content":"Summary"}}],"usage":{"total_tokens":7}}`))
+	}))
+	defer server.Close()
+
+	t.Setenv("LLAMACPP_HOST", server.URL)
+	provider := NewLlamaCppProvider()
+
+	// Act
+	content, usage, err := provider.Complete(context.Background(), []RequestMessage{{Role: "user", Content: "hi"}})
+
+	// Assert
+	if err != nil {
+		t.Fatal(err)
+	}
+	if content != "Summary" || usage.TotalTokens != 7 {
+		t.Errorf("Unexpected completion %q with usage %+v", content, usage)
+	}
+	if provider.Name() != "llamacpp" {
+		t.Errorf("Expected the llamacpp provider, got %s", provider.Name())
+	}
+}
@@ -0,0 +1,278 @@
+package ankify
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+)
+
+type ResponseBody struct {
+	ID      string   `json:"id"`
+	Object  string   `json:"object"`
+	Created int      `json:"created"`
+	Model   string   `json:"model"`
+	Usage   Usage    `json:"usage"`
+	Choices []Choice `json:"choices"`
+}
+
+type Usage struct {
+	PromptTokens     int `json:"prompt_tokens"`
+	CompletionTokens int `json:"completion_tokens"`
+	TotalTokens      int `json:"total_tokens"`
+}
+
+type Choice struct {
+	Message      ResponseMessage `json:"message"`
+	FinishReason string          `json:"finish_reason"`
+	Index        int             `json:"index"`
+}
+
+type ResponseMessage struct {
+	Role    string `json:"role"`
+	Content string `json:"content"`
+}
+
+type OpenAIRequest struct {
+	Model       string           `json:"model"`
+	Messages    []RequestMessage `json:"messages"`
+	Temperature *float64         `json:"temperature,omitempty"`
+	MaxTokens   int              `json:"max_tokens,omitempty"`
+	Seed        *int             `json:"seed,omitempty"`
+	// ResponseFormat constrains the reply to a JSON schema, see CompleteJSON.
+	ResponseFormat *ResponseFormat `json:"response_format,omitempty"`
+}
+
+type ResponseFormat struct {
+	Type       string          `json:"type"`
+	JSONSchema *ResponseSchema `json:"json_schema,omitempty"`
+}
+
+type ResponseSchema struct {
+	Name   string          `json:"name"`
+	Schema json.RawMessage `json:"schema"`
+	Strict bool            `json:"strict"`
+}
+
+type RequestMessage struct {
+	Role    string `json:"role"`
+	Content string `json:"content"`
+}
+
+const API_URL = "https://api.openai.com/v1/chat/completions"
+const DEFAULT_OPENAI_MODEL = "gpt-3.5-turbo"
+
+// DEFAULT_HTTP_TIMEOUT is a last-resort bound on any provider HTTP call; RetryPolicy.RequestTimeout is usually shorter.
+const DEFAULT_HTTP_TIMEOUT = 5 * time.Minute
+
+// OpenAIProvider sends chat completions to the OpenAI API or any server speaking the same protocol.
+type OpenAIProvider struct {
+	// Label is reported by Name, so OpenAI-compatible servers show up under their own name.
+	Label  string
+	URL    string
+	APIKey string
+	Model  string
+	Client *http.Client
+	// EmbeddingModel is the model Embed sends texts to, at the server's
+	// embeddings endpoint next to URL.
+	EmbeddingModel string
+
+	Temperature *float64
+	MaxTokens   int
+	Seed        *int
+}
+
+// NewOpenAIProvider returns an OpenAIProvider using the OPENAI_KEY environment variable.
+func NewOpenAIProvider() *OpenAIProvider {
+	return &OpenAIProvider{
+		Label:  "openai",
+		URL:    API_URL,
+		APIKey: os.Getenv("OPENAI_KEY"),
+		Model:  DEFAULT_OPENAI_MODEL,
+		Client: &http.Client{Timeout: DEFAULT_HTTP_TIMEOUT},
+
+		EmbeddingModel: DEFAULT_OPENAI_EMBEDDING_MODEL,
+	}
+}
+
+func (p *OpenAIProvider) Name() string {
+	return p.Label
+}
+
+// configure applies the non-zero fields of config to the provider.
+func (p *OpenAIProvider) configure(config ProviderConfig) {
+	if config.BaseURL != "" {
+		p.URL = chatCompletionsURL(config.BaseURL)
+	}
+	if config.Model != "" {
+		p.Model = config.Model
+	}
+	if config.EmbeddingModel != "" {
+		p.EmbeddingModel = config.EmbeddingModel
+	}
+	p.Temperature = config.Temperature
+	p.MaxTokens = config.MaxTokens
+	p.Seed = config.Seed
+}
+
+// chatCompletionsURL appends the chat completions path to an OpenAI-compatible base URL,
+// unless the URL already points at a chat completions endpoint.
+func chatCompletionsURL(base_url string) string {
+	path := base_url
+	if parsed, err := url.Parse(base_url); err == nil {
+		path = parsed.Path
+	}
+	if strings.HasSuffix(path, "/chat/completions") {
+		return base_url
+	}
+	return strings.TrimSuffix(base_url, "/") + "/chat/completions"
+}
+
+// isAzure reports whether the endpoint is an Azure OpenAI deployment, which
+// authenticates with an "api-key" header instead of a bearer token.
+func isAzure(endpoint string) bool {
+	parsed, err := url.Parse(endpoint)
+	return err == nil && strings.HasSuffix(parsed.Hostname(), ".openai.azure.com")
+}
+
+// Complete sends the messages to the chat completions endpoint and returns the first choice.
+func (p *OpenAIProvider) Complete(ctx context.Context, messages []RequestMessage) (string, Usage, error) {
+	return p.complete(ctx, messages, nil)
+}
+
+// CompleteJSON is like Complete but asks for a reply matching schema through
+// the "json_schema" response format. Servers without it answer with a 400
+// error, which the Ankifier treats as a reason to fall back to text.
+func (p *OpenAIProvider) CompleteJSON(ctx context.Context, messages []RequestMessage, schema Schema) (string, Usage, error) {
+	return p.complete(ctx, messages, &ResponseFormat{
+		Type: "json_schema",
+		JSONSchema: &ResponseSchema{
+			Name:   schema.Name,
+			Schema: schema.Schema,
+			Strict: true,
+		},
+	})
+}
+
+// Embed sends the texts to the embeddings endpoint in a single request.
+func (p *OpenAIProvider) Embed(ctx context.Context, texts []string) ([][]float64, Usage, error) {
+	json_data, err := json.Marshal(EmbeddingRequest{Model: p.EmbeddingModel, Input: texts})
+	if err != nil {
+		return nil, Usage{}, err
+	}
+	req, err := http.NewRequestWithContext(ctx, "POST", embeddingsURL(p.URL), bytes.NewBuffer(json_data))
+	if err != nil {
+		return nil, Usage{}, err
+	}
+	req.Header.Add("Content-Type", "application/json")
+	if p.APIKey != "" && isAzure(p.URL) {
+		req.Header.Add("api-key", p.APIKey)
+	} else if p.APIKey != "" {
+		req.Header.Add("Authorization", "Bearer "+p.APIKey)
+	}
+
+	resp, err := p.Client.Do(req)
+	if err != nil {
+		return nil, Usage{}, err
+	}
+	defer resp.Body.Close()
+
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, Usage{}, err
+	}
+	if resp.StatusCode == http.StatusNotFound {
+		return nil, Usage{}, fmt.Errorf("%w: %v", ErrEmbeddingsUnsupported, newAPIError(p.Name(), resp, body))
+	}
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return nil, Usage{}, newAPIError(p.Name(), resp, body)
+	}
+
+	var response EmbeddingResponse
+	if err := json.Unmarshal(body, &response); err != nil {
+		return nil, Usage{}, fmt.Errorf("decoding %s embeddings: %w", p.Name(), err)
+	}
+	if len(response.Data) != len(texts) {
+		return nil, response.Usage, fmt.Errorf("%s returned %d embeddings for %d texts", p.Name(), len(response.Data), len(texts))
+	}
+	vectors := make([][]float64, len(texts))
+	for _, data := range response.Data {
+		if data.Index < 0 || data.Index >= len(texts) || len(data.Embedding) == 0 {
+			return nil, response.Usage, fmt.Errorf("%w: %s", ErrEmptyResponse, string(body))
+		}
+		vectors[data.Index] = data.Embedding
+	}
+	return vectors, response.Usage, nil
+}
+
+func (p *OpenAIProvider) complete(ctx context.Context, messages []RequestMessage, format *ResponseFormat) (string, Usage, error) {
+
+	// Create a new request
+	req, err := http.NewRequestWithContext(ctx, "POST", p.URL, nil)
+	if err != nil {
+		return "", Usage{}, err
+	}
+
+	req.Header.Add("Content-Type", "application/json")
+	if p.APIKey != "" && isAzure(p.URL) {
+		req.Header.Add("api-key", p.APIKey)
+	} else if p.APIKey != "" {
+		req.Header.Add("Authorization", "Bearer "+p.APIKey)
+	}
+
+	json_request := OpenAIRequest{
+		Model:       p.Model,
+		Messages:    messages,
+		Temperature: p.Temperature,
+		MaxTokens:   p.MaxTokens,
+		Seed:        p.Seed,
+
+		ResponseFormat: format,
+	}
+
+	// Attach the JSON payload to the request body
+	json_data, err := json.Marshal(json_request)
+	if err != nil {
+		return "", Usage{}, err
+	}
+
+	req.Body = ioutil.NopCloser(bytes.NewBuffer(json_data))
+	// Make the request
+	resp, err := p.Client.Do(req)
+	if err != nil {
+		return "", Usage{}, err
+	}
+	defer resp.Body.Close()
+
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return "", Usage{}, err
+	}
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return "", Usage{}, newAPIError(p.Name(), resp, body)
+	}
+
+	// Unmarshal the response body into a struct
+	var response ResponseBody
+	if err := json.Unmarshal(body, &response); err != nil {
+		return "", Usage{}, fmt.Errorf("decoding %s response: %w", p.Name(), err)
+	}
+
+	// Check if the response is valid
+	if len(response.Choices) == 0 || response.Choices[0].Message.Content == "" {
+		return "", response.Usage, fmt.Errorf("%w: %s", ErrEmptyResponse, string(body))
+	}
+	return response.Choices[0].Message.Content, response.Usage, nil
+}
+
+// CallOpenAI sends a single user prompt to OpenAI and returns the reply.
+func CallOpenAI(ctx context.Context, prompt string) (string, error) {
+	content, _, err := NewOpenAIProvider().Complete(ctx, []RequestMessage{{Role: "user", Content: prompt}})
+	return content, err
+}
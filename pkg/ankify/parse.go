@@ -0,0 +1,313 @@
+package ankify
+
+import (
+	"fmt"
+	"log"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// Reasons reported for the blocks ParseAnkiText skips.
+const (
+	SKIP_NO_LABEL       = "text outside a card"
+	SKIP_NO_ANSWER      = "question without an answer"
+	SKIP_NO_QUESTION    = "answer without a question"
+	SKIP_EMPTY_QUESTION = "empty question"
+	SKIP_EMPTY_ANSWER   = "empty answer"
+)
+
+// SkippedBlock is a part of a model reply that did not become a card.
+type SkippedBlock struct {
+	// Line is the 1-based line the block starts on.
+	Line   int
+	Reason string
+	Text   string
+}
+
+// ParseReport lists the blocks ParseAnkiTextReport skipped.
+type ParseReport struct {
+	Cards   int
+	Skipped []SkippedBlock
+}
+
+// String summarizes the skipped blocks by reason, e.g. "skipped 2 blocks (1 empty answer, 1 text outside a card)".
+func (r ParseReport) String() string {
+	if len(r.Skipped) == 0 {
+		return fmt.Sprintf("parsed %d cards", r.Cards)
+	}
+	counts := map[string]int{}
+	for _, block := range r.Skipped {
+		counts[block.Reason]++
+	}
+	reasons := []string{}
+	for reason, count := range counts {
+		reasons = append(reasons, fmt.Sprintf("%d %s", count, reason))
+	}
+	sort.Strings(reasons)
+	return fmt.Sprintf("parsed %d cards, skipped %d blocks (%s)", r.Cards, len(r.Skipped), strings.Join(reasons, ", "))
+}
+
+// ParseAnkiText parses a model reply in the Q:/A: text format and returns its
+// cards. The blocks it cannot read are logged; see ParseAnkiTextReport.
+//
+//	anki_text = "Q: What is the capital of France?\nA: Paris\nQ: What is the capital of Germany?\nA: Berlin"
+//	anki_cards, _ = ParseAnkiText(anki_text)
+//	anki_cards.Questions[0].Question == "What is the capital of France?"
+//	anki_cards.Questions[0].Answer == "Paris"
+func ParseAnkiText(anki_text string) (AnkiQuestions, error) {
+	anki_cards, report := ParseAnkiTextReport(anki_text)
+	if len(report.Skipped) > 0 {
+		log.Printf("The reply had unreadable parts: %s.", report)
+		for _, block := range report.Skipped {
+			log.Printf("Skipped line %d (%s): %.80q", block.Line, block.Reason, block.Text)
+		}
+	}
+	return anki_cards, nil
+}
+
+// ParseAnkiTextReport parses a model reply with a line-based state machine
+// and reports the blocks that did not become a card.
+//
+// A card starts at a question label and its answer runs until the next
+// question label, so answers may span several paragraphs and fenced code
+// blocks, and cards need not be separated by blank lines. Labels may be
+// "Q:"/"A:" or "Question:"/"Answer:" in any case, optionally numbered
+// ("Question 1:"), emphasized ("**Q:**"), in a heading or in a list item
+// ("1. Q: ..."). A numbered list item directly followed by an answer label
+// is read as the question.
+func ParseAnkiTextReport(anki_text string) (AnkiQuestions, ParseReport) {
+	parser := textParser{}
+	lines := strings.Split(strings.ReplaceAll(anki_text, "\r\n", "\n"), "\n")
+
+	// Label every line, and note the label of the next non-blank line so a
+	// numbered list item can be read as a question when an answer follows.
+	labels := make([]label, len(lines))
+	rests := make([]string, len(lines))
+	next := make([]label, len(lines))
+	following := labelNone
+	for i := len(lines) - 1; i >= 0; i-- {
+		next[i] = following
+		if !isBlank(lines[i]) {
+			labels[i], rests[i] = parseLabel(lines[i])
+			following = labels[i]
+		}
+	}
+	for i, line := range lines {
+		parser.line(i+1, line, labels[i], rests[i], next[i])
+	}
+	parser.finish()
+	parser.report.Cards = len(parser.cards.Questions)
+	return parser.cards, parser.report
+}
+
+type parserState int
+
+const (
+	stateOutside  parserState = iota // between cards
+	stateQuestion                    // after a question label
+	stateAnswer                      // after an answer label
+	stateOrphan                      // after an answer label with no question
+)
+
+type textParser struct {
+	state     parserState
+	in_code   bool
+	start     int      // line the current block starts on
+	question  []string // lines of the current question
+	answer    []string // lines of the current answer
+	unlabeled []string // lines of the current block of text outside a card
+
+	cards  AnkiQuestions
+	report ParseReport
+}
+
+var (
+	// listMarker matches "1. ", "1) ", "- ", "* ", "+ " and "• " list markers.
+	listMarker = regexp.MustCompile(`^(\d+[.)]|[-*+•])\s+`)
+	// headingMarker matches Markdown ATX heading markers.
+	headingMarker = regexp.MustCompile(`^#{1,6}\s+`)
+	// cardLabel matches "Q:", "**Q:**", "__Answer__:", "Question 2:" and the like.
+	cardLabel = regexp.MustCompile(`(?i)^(\*\*|__|\*|_)?\s*(q|question|a|answer)\s*\d*\s*(\*\*|__|\*|_)?\s*[:：]\s*(\*\*|__|\*|_)?\s*(.*)$`)
+	// codeFence matches the start or end of a fenced code block.
+	codeFence = regexp.MustCompile("^\\s*(```|~~~)")
+)
+
+type label int
+
+const (
+	labelNone label = iota
+	labelQuestion
+	labelAnswer
+)
+
+// parseLabel returns the card label a line starts with and the text after it.
+func parseLabel(line string) (label, string) {
+	text := strings.TrimSpace(line)
+	text = listMarker.ReplaceAllString(text, "")
+	text = headingMarker.ReplaceAllString(text, "")
+	match := cardLabel.FindStringSubmatch(text)
+	if match == nil {
+		return labelNone, ""
+	}
+	rest := match[5]
+	if match[1] != "" && match[3] == "" && match[4] == "" {
+		// "**Q: What is Go?**" emphasizes the whole line.
+		rest = strings.TrimSuffix(strings.TrimSpace(rest), match[1])
+	}
+	if strings.HasPrefix(strings.ToLower(match[2]), "q") {
+		return labelQuestion, rest
+	}
+	return labelAnswer, rest
+}
+
+// isBlank reports whether a line is empty. Models sometimes echo the literal
+// "\n\n" separator of the prompt, which counts as blank too.
+func isBlank(line string) bool {
+	return strings.TrimSpace(strings.ReplaceAll(line, `\n`, "")) == ""
+}
+
+func (p *textParser) line(number int, line string, kind label, rest string, next label) {
+	if p.in_code || codeFence.MatchString(line) {
+		if codeFence.MatchString(line) {
+			p.in_code = !p.in_code
+		}
+		p.text(number, strings.TrimRight(line, " \t"))
+		return
+	}
+	if isBlank(line) {
+		p.blank()
+		return
+	}
+
+	if kind != labelNone && codeFence.MatchString(rest) {
+		// "A: ```go" opens a code block on the label line.
+		p.in_code = true
+	}
+	switch {
+	case kind == labelQuestion:
+		p.startQuestion(number, rest)
+	case kind == labelAnswer && p.state == stateQuestion:
+		p.state = stateAnswer
+		p.answer = appendLine(p.answer, rest)
+	case kind == labelAnswer:
+		p.flush()
+		p.state = stateOrphan
+		p.start = number
+		p.answer = appendLine(nil, rest)
+	case next == labelAnswer && p.state != stateQuestion && listMarker.MatchString(strings.TrimSpace(line)) && p.paragraphStart():
+		// "1. What is Go?" followed by "A: ..." is an unlabeled question.
+		p.startQuestion(number, listMarker.ReplaceAllString(strings.TrimSpace(line), ""))
+	default:
+		p.text(number, strings.TrimSpace(line))
+	}
+}
+
+// paragraphStart reports whether the parser is between cards or the current
+// answer has just ended a paragraph, so a list item may start a new card.
+func (p *textParser) paragraphStart() bool {
+	switch p.state {
+	case stateOutside:
+		return true
+	case stateAnswer, stateOrphan:
+		return len(p.answer) > 0 && p.answer[len(p.answer)-1] == ""
+	}
+	return false
+}
+
+func (p *textParser) startQuestion(number int, rest string) {
+	p.flush()
+	p.state = stateQuestion
+	p.start = number
+	p.question = appendLine(nil, rest)
+}
+
+// text adds a line to the field being read, or to the unlabeled block.
+func (p *textParser) text(number int, line string) {
+	switch p.state {
+	case stateQuestion:
+		p.question = append(p.question, line)
+	case stateAnswer, stateOrphan:
+		p.answer = append(p.answer, line)
+	default:
+		if len(p.unlabeled) == 0 {
+			p.start = number
+		}
+		p.unlabeled = append(p.unlabeled, line)
+	}
+}
+
+// blank ends a paragraph: fields keep it as a paragraph break, and a block
+// of unlabeled text ends there.
+func (p *textParser) blank() {
+	switch p.state {
+	case stateQuestion:
+		if len(p.question) > 0 && p.question[len(p.question)-1] != "" {
+			p.question = append(p.question, "")
+		}
+	case stateAnswer, stateOrphan:
+		if len(p.answer) > 0 && p.answer[len(p.answer)-1] != "" {
+			p.answer = append(p.answer, "")
+		}
+	default:
+		p.flushUnlabeled()
+	}
+}
+
+// flush ends the current block, adding it as a card or reporting why it was skipped.
+func (p *textParser) flush() {
+	question, answer := joinLines(p.question), joinLines(p.answer)
+	switch p.state {
+	case stateOutside:
+		p.flushUnlabeled()
+	case stateOrphan:
+		p.skip(SKIP_NO_QUESTION, answer)
+	case stateQuestion:
+		p.skip(SKIP_NO_ANSWER, question)
+	case stateAnswer:
+		switch {
+		case question == "":
+			p.skip(SKIP_EMPTY_QUESTION, answer)
+		case answer == "":
+			p.skip(SKIP_EMPTY_ANSWER, question)
+		default:
+			p.cards.Questions = append(p.cards.Questions, AnkiQuestion{Question: question, Answer: answer})
+		}
+	}
+	p.state = stateOutside
+	p.question, p.answer = nil, nil
+}
+
+func (p *textParser) flushUnlabeled() {
+	if text := joinLines(p.unlabeled); text != "" {
+		p.skip(SKIP_NO_LABEL, text)
+	}
+	p.unlabeled = nil
+}
+
+func (p *textParser) finish() {
+	if p.in_code {
+		// Close a code block the model left open so the card renders.
+		p.text(0, "```")
+		p.in_code = false
+	}
+	p.flush()
+}
+
+func (p *textParser) skip(reason string, text string) {
+	p.report.Skipped = append(p.report.Skipped, SkippedBlock{Line: p.start, Reason: reason, Text: text})
+}
+
+func appendLine(lines []string, line string) []string {
+	if line = strings.TrimSpace(line); line != "" {
+		lines = append(lines, line)
+	}
+	return lines
+}
+
+// joinLines joins the lines of a field, dropping the trailing ";" models
+// sometimes end their questions and answers with.
+func joinLines(lines []string) string {
+	text := strings.TrimSpace(strings.Join(lines, "\n"))
+	return strings.TrimSpace(strings.TrimSuffix(text, ";"))
+}
@@ -0,0 +1,156 @@
+package ankify
+
+import (
+	"strings"
+	"testing"
+	"unicode/utf8"
+)
+
+func TestParseAnkiTextFormats(t *testing.T) {
+	tests := []struct {
+		name    string
+		text    string
+		want    []AnkiQuestion
+		skipped []string
+	}{
+		{
+			name: "blank line between cards",
+			text: "Q: What is Go?\nA: A language\n\nQ: Who wrote it?\nA: Google",
+			want: []AnkiQuestion{{Question: "What is Go?", Answer: "A language"}, {Question: "Who wrote it?", Answer: "Google"}},
+		},
+		{
+			name: "single newline between cards",
+			text: "Q: What is Go?\nA: A language\nQ: Who wrote it?\nA: Google\n",
+			want: []AnkiQuestion{{Question: "What is Go?", Answer: "A language"}, {Question: "Who wrote it?", Answer: "Google"}},
+		},
+		{
+			name: "numbered list",
+			text: "1. Q: What is Go?\n   A: A language\n2. Q: Who wrote it?\n   A: Google",
+			want: []AnkiQuestion{{Question: "What is Go?", Answer: "A language"}, {Question: "Who wrote it?", Answer: "Google"}},
+		},
+		{
+			name: "numbered questions without a label",
+			text: "1. What is Go?\nA: A language\n\n2. Who wrote it?\nA: Google",
+			want: []AnkiQuestion{{Question: "What is Go?", Answer: "A language"}, {Question: "Who wrote it?", Answer: "Google"}},
+		},
+		{
+			name: "markdown labels",
+			text: "**Q:** What is Go?\n**A:** A language\n\n**Q**: Who wrote it?\n**A**: Google\n\n**Q: Is it fast?**\n**A: Yes**\n\n### Q: Is it typed?\nA: Statically",
+			want: []AnkiQuestion{
+				{Question: "What is Go?", Answer: "A language"},
+				{Question: "Who wrote it?", Answer: "Google"},
+				{Question: "Is it fast?", Answer: "Yes"},
+				{Question: "Is it typed?", Answer: "Statically"},
+			},
+		},
+		{
+			name: "question and answer labels",
+			text: "Question 1: What is Go?\nAnswer: A language\n\nquestion: Who wrote it?\nanswer: Google",
+			want: []AnkiQuestion{{Question: "What is Go?", Answer: "A language"}, {Question: "Who wrote it?", Answer: "Google"}},
+		},
+		{
+			name: "multi-paragraph answer",
+			text: "Q: What is Go?\nA: A language.\n\nIt was designed at Google.\nQ: Is it fast?\nA: Yes",
+			want: []AnkiQuestion{{Question: "What is Go?", Answer: "A language.\n\nIt was designed at Google."}, {Question: "Is it fast?", Answer: "Yes"}},
+		},
+		{
+			name: "code block",
+			text: "Q: How do you print in Go?\nA: With fmt:\n\n```go\nfunc main() {\n    fmt.Println(\"Q: hi\")\n\n}\n```\nQ: Next?\nA: Done",
+			want: []AnkiQuestion{
+				{Question: "How do you print in Go?", Answer: "With fmt:\n\n```go\nfunc main() {\n    fmt.Println(\"Q: hi\")\n\n}\n```"},
+				{Question: "Next?", Answer: "Done"},
+			},
+		},
+		{
+			name: "unterminated code block",
+			text: "Q: Hello world?\nA: ```go\nfmt.Println(\"hi\")",
+			want: []AnkiQuestion{{Question: "Hello world?", Answer: "```go\nfmt.Println(\"hi\")\n```"}},
+		},
+		{
+			name: "prompt separator and semicolons",
+			text: "Q: What is Go?; \nA: A language; \n\\n\\n \nQ: Who wrote it?;\nA: Google;",
+			want: []AnkiQuestion{{Question: "What is Go?", Answer: "A language"}, {Question: "Who wrote it?", Answer: "Google"}},
+		},
+		{
+			name:    "skipped blocks",
+			text:    "Here are your cards:\n\nQ: What is Go?\n\nQ: Who wrote it?\nA:\nA: An orphan answer\nQ: Is it fast?\nA: Yes",
+			want:    []AnkiQuestion{{Question: "Is it fast?", Answer: "Yes"}},
+			skipped: []string{SKIP_NO_LABEL, SKIP_NO_ANSWER, SKIP_EMPTY_ANSWER, SKIP_NO_QUESTION},
+		},
+		{
+			name:    "no cards",
+			text:    "I cannot make cards from this text.",
+			skipped: []string{SKIP_NO_LABEL},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			res, report := ParseAnkiTextReport(test.text)
+			if len(res.Questions) != len(test.want) {
+				t.Fatalf("Expected %d cards, got %+v", len(test.want), res.Questions)
+			}
+			for i, card := range test.want {
+				if res.Questions[i] != card {
+					t.Errorf("Card %d: expected %+v, got %+v", i, card, res.Questions[i])
+				}
+			}
+			if report.Cards != len(test.want) {
+				t.Errorf("Expected the report to count %d cards, got %d", len(test.want), report.Cards)
+			}
+			if len(report.Skipped) != len(test.skipped) {
+				t.Fatalf("Expected %d skipped blocks, got %+v", len(test.skipped), report.Skipped)
+			}
+			for i, reason := range test.skipped {
+				if report.Skipped[i].Reason != reason {
+					t.Errorf("Skipped block %d: expected %q, got %+v", i, reason, report.Skipped[i])
+				}
+			}
+		})
+	}
+}
+
+func TestParseReportString(t *testing.T) {
+	_, report := ParseAnkiTextReport("Intro\n\nQ: No answer\n\nOutro\nQ: Ok?\nA: Ok")
+	want := "parsed 1 cards, skipped 2 blocks (1 question without an answer, 1 text outside a card)"
+	if report.String() != want {
+		t.Errorf("Expected %q, got %q", want, report.String())
+	}
+	if report.Skipped[1].Line != 3 {
+		t.Errorf("Expected the question without an answer on line 3, got %d", report.Skipped[1].Line)
+	}
+}
+
+func FuzzParseAnkiText(f *testing.F) {
+	f.Add("Q: What is Go?\nA: A language\n\nQ: Who wrote it?\nA: Google")
+	f.Add("1. **Q:** What?\n   **A:** That\n```\ncode\n")
+	f.Add("Question: a\nAnswer: b\n\nc\nA: d\n\\n\\n")
+	f.Fuzz(func(t *testing.T, text string) {
+		res, report := ParseAnkiTextReport(text)
+		if report.Cards != len(res.Questions) {
+			t.Fatalf("Report counts %d cards, parsed %d", report.Cards, len(res.Questions))
+		}
+		for _, card := range res.Questions {
+			if strings.TrimSpace(card.Question) == "" || strings.TrimSpace(card.Answer) == "" {
+				t.Fatalf("Empty field in %+v", card)
+			}
+			if utf8.ValidString(text) && (!utf8.ValidString(card.Question) || !utf8.ValidString(card.Answer)) {
+				t.Fatalf("Invalid UTF-8 in %+v", card)
+			}
+		}
+		for _, block := range report.Skipped {
+			if block.Reason == "" {
+				t.Fatalf("Skipped block without a reason: %+v", block)
+			}
+		}
+
+		// Cards written back in the prompt format parse to the same cards.
+		var written strings.Builder
+		for _, card := range res.Questions {
+			written.WriteString("Q: " + card.Question + "\nA: " + card.Answer + "\n\n")
+		}
+		again, _ := ParseAnkiTextReport(written.String())
+		if len(again.Questions) > len(res.Questions) {
+			t.Fatalf("Writing %+v back gave more cards: %+v", res.Questions, again.Questions)
+		}
+	})
+}
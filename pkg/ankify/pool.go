@@ -0,0 +1,44 @@
+package ankify
+
+import (
+	"context"
+	"sync"
+)
+
+// runPool calls fn for every index in [0, jobs) using at most concurrency
+// goroutines and returns the error of each job by index. A failing job does
+// not stop the others; jobs not yet started when ctx is done get ctx.Err().
+func runPool(ctx context.Context, concurrency int, jobs int, fn func(i int) error) []error {
+	if concurrency < 1 {
+		concurrency = 1
+	}
+	errs := make([]error, jobs)
+	semaphore := make(chan struct{}, concurrency)
+	var wg sync.WaitGroup
+
+	for i := 0; i < jobs; i++ {
+		select {
+		case semaphore <- struct{}{}:
+		case <-ctx.Done():
+			for j := i; j < jobs; j++ {
+				errs[j] = ctx.Err()
+			}
+			wg.Wait()
+			return errs
+		}
+		if err := ctx.Err(); err != nil {
+			<-semaphore
+			errs[i] = err
+			continue
+		}
+
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			defer func() { <-semaphore }()
+			errs[i] = fn(i)
+		}(i)
+	}
+	wg.Wait()
+	return errs
+}
@@ -0,0 +1,158 @@
+package ankify
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestRunPoolBoundsConcurrency(t *testing.T) {
+
+	// Arrange
+	var running, max_running int32
+	results := make([]int, 20)
+
+	// Act
+	errs := runPool(context.Background(), 3, len(results), func(i int) error {
+		now := atomic.AddInt32(&running, 1)
+		for {
+			seen := atomic.LoadInt32(&max_running)
+			if now <= seen || atomic.CompareAndSwapInt32(&max_running, seen, now) {
+				break
+			}
+		}
+		time.Sleep(time.Millisecond)
+		results[i] = i * i
+		atomic.AddInt32(&running, -1)
+		return nil
+	})
+
+	// Assert
+	if max_running > 3 {
+		t.Errorf("Expected at most 3 jobs at once, got %d", max_running)
+	}
+	for i, err := range errs {
+		if err != nil || results[i] != i*i {
+			t.Errorf("Job %d: got result %d and error %v", i, results[i], err)
+		}
+	}
+}
+
+func TestRunPoolKeepsGoingAfterFailure(t *testing.T) {
+
+	// Act
+	errs := runPool(context.Background(), 2, 4, func(i int) error {
+		if i == 1 {
+			return errors.New("boom")
+		}
+		return nil
+	})
+
+	// Assert
+	if errs[1] == nil || errs[0] != nil || errs[2] != nil || errs[3] != nil {
+		t.Errorf("Expected only job 1 to fail, got %v", errs)
+	}
+}
+
+// pageProvider answers with a card naming the page it was asked about and fails on "Page two.".
+type pageProvider struct {
+	mu    sync.Mutex
+	calls int
+}
+
+func (p *pageProvider) Name() string {
+	return "pages"
+}
+
+func (p *pageProvider) Complete(ctx context.Context, messages []RequestMessage) (string, Usage, error) {
+	p.mu.Lock()
+	p.calls++
+	p.mu.Unlock()
+	prompt := messages[0].Content
+	for _, page := range []string{"one", "two", "three", "four"} {
+		if strings.Contains(prompt, "Page "+page+".") {
+			if page == "two" {
+				return "", Usage{}, errors.New("model overloaded")
+			}
+			return "Q: Which page?\nA: " + page, Usage{TotalTokens: 1}, nil
+		}
+	}
+	return "", Usage{}, errors.New("unexpected prompt")
+}
+
+func TestAnkifyConcurrentPagesInOrder(t *testing.T) {
+
+	// Arrange
+	provider := &pageProvider{}
+	ankifier := NewAnkifier(provider)
+	ankifier.Concurrency = 4
+	pages := map[int]string{4: "Page four.", 1: "Page one.", 3: "Page three.", 2: "Page two."}
+
+	// Act
+	res, err := ankifier.Ankify(context.Background(), pages, 1)
+
+	// Assert
+	var page_errors PageErrors
+	if !errors.As(err, &page_errors) || len(page_errors) != 1 || page_errors[0].Page != 2 {
+		t.Fatalf("Expected page 2 to fail, got %v", err)
+	}
+	var answers []string
+	for _, question := range res.Questions {
+		answers = append(answers, question.Answer)
+	}
+	if strings.Join(answers, ",") != "one,three,four" {
+		t.Errorf("Expected the other pages in order, got %v", answers)
+	}
+	if provider.calls != 4 || ankifier.Usage.TotalTokens != 3 {
+		t.Errorf("Expected 4 calls and 3 tokens, got %d calls and %d tokens", provider.calls, ankifier.Usage.TotalTokens)
+	}
+}
+
+// slowProvider counts the calls in flight and answers every prompt with one card.
+type slowProvider struct {
+	running, max_running int32
+}
+
+func (p *slowProvider) Name() string {
+	return "slow"
+}
+
+func (p *slowProvider) Complete(ctx context.Context, messages []RequestMessage) (string, Usage, error) {
+	now := atomic.AddInt32(&p.running, 1)
+	for {
+		seen := atomic.LoadInt32(&p.max_running)
+		if now <= seen || atomic.CompareAndSwapInt32(&p.max_running, seen, now) {
+			break
+		}
+	}
+	time.Sleep(time.Millisecond)
+	atomic.AddInt32(&p.running, -1)
+	return "Q: Which chunk?\nA: This one", Usage{}, nil
+}
+
+func TestAnkifyBoundsNestedConcurrency(t *testing.T) {
+
+	// Arrange
+	provider := &slowProvider{}
+	ankifier := NewAnkifier(provider)
+	ankifier.Concurrency = 2
+	ankifier.SkipSummary = true
+	ankifier.ChunkTokens = 5
+	page := strings.Repeat("Every chunk of this page becomes a prompt. ", 10)
+	pages := map[int]string{1: page, 2: page, 3: page}
+
+	// Act
+	_, err := ankifier.Ankify(context.Background(), pages, 1)
+
+	// Assert
+	if err != nil {
+		t.Fatal(err)
+	}
+	if provider.max_running > 2 {
+		t.Errorf("Expected at most 2 provider calls at once, got %d", provider.max_running)
+	}
+}
@@ -0,0 +1,128 @@
+package ankify
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"time"
+)
+
+// Provider is a chat completion backend used to summarize text and write cards.
+type Provider interface {
+	// Name identifies the provider in logs and configuration.
+	Name() string
+	// Complete sends the messages to the model and returns its reply and token usage.
+	Complete(ctx context.Context, messages []RequestMessage) (string, Usage, error)
+}
+
+// DEFAULT_PROVIDER is used when neither the --provider flag nor ANKIFY_PROVIDER is set.
+const DEFAULT_PROVIDER = "openai"
+
+// ProviderConfig selects a provider and tunes its requests. Zero values keep
+// the provider's defaults, so an empty config behaves like NewProvider(DEFAULT_PROVIDER).
+type ProviderConfig struct {
+	Provider string `json:"provider"`
+	// BaseURL is the server root, e.g. "https://api.openai.com/v1" or "http://localhost:11434".
+	// A full ".../chat/completions" URL (as used by Azure OpenAI deployments) is used as is.
+	BaseURL string `json:"base_url"`
+	Model   string `json:"model"`
+	// EmbeddingModel is the model used to embed cards for semantic
+	// deduplication (default depends on the provider).
+	EmbeddingModel string `json:"embedding_model"`
+	// APIKeyEnv names the environment variable holding the API key (default is OPENAI_KEY).
+	APIKeyEnv   string   `json:"api_key_env"`
+	Temperature *float64 `json:"temperature"`
+	MaxTokens   int      `json:"max_tokens"`
+	Seed        *int     `json:"seed"`
+	// MaxRetries is the number of retries per request (default is 4).
+	MaxRetries *int `json:"max_retries"`
+	// RetryBudget caps the retries of a whole run (default is 20, 0 removes the cap).
+	RetryBudget *int `json:"retry_budget"`
+	// RequestTimeout bounds each attempt of a request (default is 2m).
+	RequestTimeout Duration `json:"request_timeout"`
+}
+
+// Duration is a time.Duration read from JSON as a string such as "90s".
+type Duration time.Duration
+
+func (d *Duration) UnmarshalJSON(data []byte) error {
+	var value string
+	if err := json.Unmarshal(data, &value); err != nil {
+		return err
+	}
+	duration, err := time.ParseDuration(value)
+	if err != nil {
+		return err
+	}
+	*d = Duration(duration)
+	return nil
+}
+
+// NewProvider returns the provider registered under config.Provider with the
+// config applied, wrapped in a RetryingProvider.
+func NewProvider(config ProviderConfig) (Provider, error) {
+	provider, err := newBaseProvider(config)
+	if err != nil {
+		return nil, err
+	}
+	policy := DefaultRetryPolicy
+	if config.MaxRetries != nil {
+		policy.MaxAttempts = *config.MaxRetries + 1
+	}
+	if config.RetryBudget != nil {
+		policy.Budget = *config.RetryBudget
+	}
+	if config.RequestTimeout > 0 {
+		policy.RequestTimeout = time.Duration(config.RequestTimeout)
+	}
+	return NewRetryingProvider(provider, policy), nil
+}
+
+func newBaseProvider(config ProviderConfig) (Provider, error) {
+	switch config.Provider {
+	case "", "openai":
+		provider := NewOpenAIProvider()
+		if config.APIKeyEnv != "" {
+			provider.APIKey = os.Getenv(config.APIKeyEnv)
+		}
+		provider.configure(config)
+		return provider, nil
+	case "ollama":
+		provider := NewOllamaProvider()
+		provider.configure(config)
+		return provider, nil
+	case "llamacpp", "llama.cpp":
+		provider := NewLlamaCppProvider()
+		provider.configure(config)
+		return provider, nil
+	default:
+		return nil, fmt.Errorf("unknown provider: %q", config.Provider)
+	}
+}
+
+// ProviderModel returns the model a provider sends requests to, or "" if it
+// is not known.
+func ProviderModel(provider Provider) string {
+	switch p := provider.(type) {
+	case *RetryingProvider:
+		return ProviderModel(p.Provider)
+	case *OpenAIProvider:
+		return p.Model
+	case *OllamaProvider:
+		return p.Model
+	default:
+		return ""
+	}
+}
+
+// DefaultProvider returns the provider named by ANKIFY_PROVIDER, falling back to OpenAI.
+func DefaultProvider() Provider {
+	provider, err := NewProvider(ProviderConfig{Provider: os.Getenv("ANKIFY_PROVIDER")})
+	if err != nil {
+		log.Printf("%v, defaulting to %s.", err, DEFAULT_PROVIDER)
+		return NewRetryingProvider(NewOpenAIProvider(), DefaultRetryPolicy)
+	}
+	return provider
+}
@@ -0,0 +1,481 @@
+package ankify
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/acrucetta/anki-builder/pkg/chunker"
+	"github.com/acrucetta/anki-builder/pkg/tokenizer"
+)
+
+// fakeProvider replies with a canned response and records the prompts it receives.
+type fakeProvider struct {
+	reply   string
+	prompts []string
+}
+
+func (f *fakeProvider) Name() string {
+	return "fake"
+}
+
+func (f *fakeProvider) Complete(ctx context.Context, messages []RequestMessage) (string, Usage, error) {
+	f.prompts = append(f.prompts, messages[len(messages)-1].Content)
+	return f.reply, Usage{PromptTokens: 10, CompletionTokens: 5, TotalTokens: 15}, nil
+}
+
+func TestAnkifierWithFakeProvider(t *testing.T) {
+
+	// Arrange
+	provider := &fakeProvider{reply: "Q: What is the capital of France?\nA: Paris\n\nQ: What is the capital of Spain?\nA: Madrid"}
+	ankifier := NewAnkifier(provider)
+	pages := map[int]string{1: "The capital of France is Paris. The capital of Spain is Madrid."}
+
+	// Act
+	res, err := ankifier.Ankify(context.Background(), pages, 2)
+
+	// Assert
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(res.Questions) != 2 {
+		t.Fatalf("Expected 2 questions, got %d", len(res.Questions))
+	}
+	if res.Questions[1].Answer != "Madrid" {
+		t.Errorf("Expected answer 'Madrid', got %q", res.Questions[1].Answer)
+	}
+	if len(provider.prompts) != 1 || !strings.Contains(provider.prompts[0], "The capital of France is Paris.") {
+		t.Errorf("Expected a single card prompt containing the page text, got %v", provider.prompts)
+	}
+	if ankifier.Usage.TotalTokens != 15 {
+		t.Errorf("Expected 15 total tokens, got %d", ankifier.Usage.TotalTokens)
+	}
+}
+
+func TestNewProvider(t *testing.T) {
+
+	// Act
+	openai, err := NewProvider(ProviderConfig{Provider: "openai"})
+	_, unknownErr := NewProvider(ProviderConfig{Provider: "nope"})
+
+	// Assert
+	if err != nil {
+		t.Error(err)
+	}
+	if openai.Name() != "openai" {
+		t.Errorf("Expected the openai provider, got %s", openai.Name())
+	}
+	if unknownErr == nil {
+		t.Error("Expected an error for an unknown provider")
+	}
+}
+
+func TestDefaultProviderFallbackRetries(t *testing.T) {
+
+	// Arrange
+	t.Setenv("ANKIFY_PROVIDER", "nope")
+
+	// Act
+	provider := DefaultProvider()
+
+	// Assert
+	retrying, ok := provider.(*RetryingProvider)
+	if !ok {
+		t.Fatalf("Expected a RetryingProvider, got %T", provider)
+	}
+	if retrying.Name() != "openai" || retrying.Policy != DefaultRetryPolicy {
+		t.Errorf("Expected openai with the default retry policy, got %s with %+v", retrying.Name(), retrying.Policy)
+	}
+}
+
+func TestNewProviderWithConfig(t *testing.T) {
+
+	// Arrange
+	var received OpenAIRequest
+	var path string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		path = r.URL.Path
+		json.NewDecoder(r.Body).Decode(&received)
+		w.Write([]byte(`{"choices":[{"message":{"role":"assistant","content":"ok"}}]}`))
+	}))
+	defer server.Close()
+
+	temperature := 0.0
+	seed := 42
+	config := ProviderConfig{
+		Provider:    "openai",
+		BaseURL:     server.URL + "/v1",
+		Model:       "mistral-7b",
+		Temperature: &temperature,
+		MaxTokens:   256,
+		Seed:        &seed,
+	}
+
+	// Act
+	provider, err := NewProvider(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, _, err = provider.Complete(context.Background(), []RequestMessage{{Role: "user", Content: "hi"}})
+
+	// Assert
+	if err != nil {
+		t.Fatal(err)
+	}
+	if path != "/v1/chat/completions" {
+		t.Errorf("Expected /v1/chat/completions, got %s", path)
+	}
+	if ProviderModel(provider) != "mistral-7b" {
+		t.Errorf("Expected the model of the wrapped provider, got %q", ProviderModel(provider))
+	}
+	if received.Model != "mistral-7b" || received.MaxTokens != 256 {
+		t.Errorf("Unexpected request %+v", received)
+	}
+	if received.Temperature == nil || *received.Temperature != 0 || received.Seed == nil || *received.Seed != 42 {
+		t.Error("Expected an explicit zero temperature and seed 42 to be sent")
+	}
+}
+
+func TestChatCompletionsURL(t *testing.T) {
+	tests := map[string]string{
+		"https://api.openai.com/v1": "https://api.openai.com/v1/chat/completions",
+		"http://localhost:8000/v1/": "http://localhost:8000/v1/chat/completions",
+		"https://x.openai.azure.com/openai/deployments/gpt/chat/completions?api-version=2024-02-01": "https://x.openai.azure.com/openai/deployments/gpt/chat/completions?api-version=2024-02-01",
+	}
+	for base_url, expected := range tests {
+		if got := chatCompletionsURL(base_url); got != expected {
+			t.Errorf("chatCompletionsURL(%q) = %q, expected %q", base_url, got, expected)
+		}
+	}
+}
+
+// cancellingProvider cancels the run after its first reply.
+type cancellingProvider struct {
+	fakeProvider
+	cancel context.CancelFunc
+}
+
+func (c *cancellingProvider) Complete(ctx context.Context, messages []RequestMessage) (string, Usage, error) {
+	defer c.cancel()
+	return c.fakeProvider.Complete(ctx, messages)
+}
+
+func TestAnkifyKeepsCardsWhenCancelled(t *testing.T) {
+
+	// Arrange
+	ctx, cancel := context.WithCancel(context.Background())
+	provider := &cancellingProvider{fakeProvider: fakeProvider{reply: "Q: One?\nA: 1"}, cancel: cancel}
+	pages := map[int]string{1: "Page one.", 2: "Page two.", 3: "Page three."}
+
+	// Act
+	res, err := NewAnkifier(provider).Ankify(ctx, pages, 1)
+
+	// Assert
+	if err != context.Canceled {
+		t.Errorf("Expected context.Canceled, got %v", err)
+	}
+	if len(res.Questions) != 1 {
+		t.Errorf("Expected the card from the first page, got %d cards", len(res.Questions))
+	}
+}
+
+func TestAnkifyRecordsSource(t *testing.T) {
+
+	// Arrange
+	provider := &fakeProvider{reply: "Q: What is on this page?\nA: Text"}
+	ankifier := NewAnkifier(provider)
+	ankifier.Document = "data/test.pdf"
+	pages := map[int]string{7: "Seventh page.", 3: "Third page.", 12: "Twelfth page."}
+
+	// Act
+	res, err := ankifier.Ankify(context.Background(), pages, 1)
+
+	// Assert
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []Source{
+		{Document: "data/test.pdf", Page: 3, Chunk: 1},
+		{Document: "data/test.pdf", Page: 7, Chunk: 1},
+		{Document: "data/test.pdf", Page: 12, Chunk: 1},
+	}
+	for i, question := range res.Questions {
+		if question.Source != expected[i] {
+			t.Errorf("Card %d: expected source %+v, got %+v", i, expected[i], question.Source)
+		}
+	}
+	if !strings.Contains(provider.prompts[0], "Third page.") {
+		t.Errorf("Expected pages to be processed in order, first prompt was %q", provider.prompts[0])
+	}
+}
+
+func TestAnkifyFollowsSections(t *testing.T) {
+
+	// Arrange
+	provider := &fakeProvider{reply: "Q: What is described?\nA: A step"}
+	ankifier := NewAnkifier(provider)
+	ankifier.PageSections = map[int]string{2: "Appendix"}
+	ankifier.Markdown = true
+	pages := map[int]string{
+		1: "# MapReduce\n\n## Map phase\n\nThe map function emits pairs.\n\n## Reduce phase\n\nThe reduce function merges values.",
+		2: "Extra material without headings.",
+	}
+
+	// Act
+	res, err := ankifier.Ankify(context.Background(), pages, 2)
+
+	// Assert
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(provider.prompts) != 3 {
+		t.Fatalf("Expected one prompt per section, got %d", len(provider.prompts))
+	}
+	if !strings.Contains(provider.prompts[0], `section "MapReduce > Map phase"`) || strings.Contains(provider.prompts[0], "reduce function") {
+		t.Errorf("Expected the first prompt to hold only the map phase with its context, got %q", provider.prompts[0])
+	}
+	if !strings.Contains(provider.prompts[0], "make 1 Anki cards") {
+		t.Error("Expected the 2 cards of the page to be shared between its sections")
+	}
+	var sections, tags []string
+	for _, question := range res.Questions {
+		sections = append(sections, question.Source.Section)
+		tags = append(tags, question.Tag)
+	}
+	if strings.Join(sections, ",") != "Map phase,Reduce phase,Appendix" {
+		t.Errorf("Unexpected sections %v", sections)
+	}
+	if strings.Join(tags, ",") != "Map_phase,Reduce_phase,Appendix" {
+		t.Errorf("Unexpected tags %v", tags)
+	}
+}
+
+func TestShareCards(t *testing.T) {
+	tests := []struct {
+		lengths  []int
+		cardNum  int
+		expected []int
+	}{
+		{[]int{10}, 3, []int{3}},
+		{[]int{10, 10}, 2, []int{1, 1}},
+		{[]int{30, 10, 10}, 5, []int{3, 1, 1}},
+		{[]int{50, 5, 5, 5, 5, 5}, 2, []int{2, 0, 0, 0, 0, 0}},
+		{[]int{5, 5, 5, 5}, 2, []int{1, 1, 0, 0}},
+	}
+	for _, test := range tests {
+		got := shareCards(test.lengths, test.cardNum)
+		if !reflect.DeepEqual(got, test.expected) {
+			t.Errorf("shareCards(%v, %d) = %v, expected %v", test.lengths, test.cardNum, got, test.expected)
+		}
+	}
+}
+
+func TestMergeShortSections(t *testing.T) {
+
+	// Arrange
+	sections := []chunker.Section{
+		{Title: "Intro", Level: 1, Text: "Short."},
+		{Title: "Body", Level: 2, Text: "Long text."},
+		{Title: "Note", Level: 2, Text: "Aside."},
+	}
+
+	// Act
+	merged, shares := mergeShortSections(sections, []int{0, 3, 0})
+
+	// Assert
+	if len(merged) != 1 || !reflect.DeepEqual(shares, []int{3}) {
+		t.Fatalf("Expected a single section with 3 cards, got %+v and %v", merged, shares)
+	}
+	if merged[0].Title != "Body" || merged[0].Text != "# Intro\n\nShort.\n\nLong text.\n\n## Note\n\nAside." {
+		t.Errorf("Unexpected merged section %+v", merged[0])
+	}
+}
+
+func TestAnkifyMergesSectionsWithoutCards(t *testing.T) {
+
+	// Arrange
+	provider := &fakeProvider{reply: "Q: What is described?\nA: A step"}
+	ankifier := NewAnkifier(provider)
+	ankifier.Markdown = true
+	pages := map[int]string{1: "# A\n\nFirst.\n\n# B\n\nSecond.\n\n# C\n\nThird.\n\n# D\n\nFourth."}
+
+	// Act
+	_, err := ankifier.Ankify(context.Background(), pages, 2)
+
+	// Assert
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(provider.prompts) != 2 {
+		t.Fatalf("Expected a prompt for only 2 of the 4 sections, got %d", len(provider.prompts))
+	}
+	if !strings.Contains(provider.prompts[1], "Second.") || !strings.Contains(provider.prompts[1], "# D\n\nFourth.") {
+		t.Errorf("Expected the short sections to be merged into the second prompt, got %q", provider.prompts[1])
+	}
+}
+
+func TestAnkifyKeepsPlainTextWhole(t *testing.T) {
+
+	// Arrange
+	provider := &fakeProvider{reply: "Q: What is described?\nA: A step"}
+	ankifier := NewAnkifier(provider)
+	pages := map[int]string{1: "# of items sold rose.\n\nThe map function emits pairs."}
+
+	// Act
+	res, err := ankifier.Ankify(context.Background(), pages, 2)
+
+	// Assert
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(provider.prompts) != 1 || !strings.Contains(provider.prompts[0], "# of items sold") {
+		t.Errorf("Expected the whole page in a single prompt, got %q", provider.prompts)
+	}
+	if res.Questions[0].Source.Section != "" {
+		t.Errorf("Expected no section, got %q", res.Questions[0].Source.Section)
+	}
+}
+
+// halvingProvider summarizes by keeping the first half of the text and
+// answers card prompts with a single card.
+type halvingProvider struct {
+	mu        sync.Mutex
+	summaries int
+	cards     []string
+}
+
+func (h *halvingProvider) Name() string {
+	return "halving"
+}
+
+func (h *halvingProvider) Complete(ctx context.Context, messages []RequestMessage) (string, Usage, error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	prompt := messages[0].Content
+	if index := strings.Index(prompt, "helpful points: "); index >= 0 {
+		h.summaries++
+		text := prompt[index+len("helpful points: "):]
+		return text[:len(text)/2], Usage{}, nil
+	}
+	h.cards = append(h.cards, prompt)
+	return "Q: What?\nA: That", Usage{}, nil
+}
+
+func TestAnkifySummarizesRecursively(t *testing.T) {
+
+	// Arrange
+	var paragraphs []string
+	for i := 0; i < 400; i++ {
+		paragraphs = append(paragraphs, fmt.Sprintf("Paragraph %d explains one more detail of the long book in a few words.", i))
+	}
+	provider := &halvingProvider{}
+	ankifier := NewAnkifier(provider)
+	ankifier.Tokenizer = tokenizer.Approximate{}
+
+	// Act
+	res, err := ankifier.Ankify(context.Background(), map[int]string{1: strings.Join(paragraphs, "\n\n")}, 3)
+
+	// Assert
+	if err != nil {
+		t.Fatal(err)
+	}
+	first_round := len(ankifier.chunk(strings.Join(paragraphs, "\n\n")))
+	if provider.summaries <= first_round {
+		t.Errorf("Expected more than one round of %d summaries, got %d summaries", first_round, provider.summaries)
+	}
+	if len(provider.cards) != 1 || ankifier.Tokenizer.Count(provider.cards[0]) > MAX_CARD_TOKENS+200 {
+		t.Errorf("Expected a single card prompt within the budget")
+	}
+	if len(res.Questions) != 1 || res.Questions[0].Source.Chunk != 0 {
+		t.Errorf("Expected one card from the summary, got %+v", res.Questions)
+	}
+}
+
+func TestAnkifyJoinsSmallChunksWithoutSummary(t *testing.T) {
+
+	// Arrange
+	var paragraphs []string
+	for i := 0; i < 30; i++ {
+		paragraphs = append(paragraphs, fmt.Sprintf("Paragraph %d has a fact worth remembering.", i))
+	}
+	provider := &halvingProvider{}
+	ankifier := NewAnkifier(provider)
+	ankifier.Tokenizer = tokenizer.Approximate{}
+	ankifier.ChunkTokens = 100
+
+	// Act
+	_, err := ankifier.Ankify(context.Background(), map[int]string{1: strings.Join(paragraphs, "\n\n")}, 1)
+
+	// Assert
+	if err != nil {
+		t.Fatal(err)
+	}
+	if provider.summaries != 0 {
+		t.Errorf("Expected no summaries of a page within the card budget, got %d", provider.summaries)
+	}
+	if len(provider.cards) != 1 || !strings.Contains(provider.cards[0], "Paragraph 0 ") || !strings.Contains(provider.cards[0], "Paragraph 29 ") {
+		t.Errorf("Expected a single card prompt with the whole page, got %d prompts", len(provider.cards))
+	}
+}
+
+func TestSummarizeRequestsEmpty(t *testing.T) {
+
+	// Act
+	summary, err := NewAnkifier(&halvingProvider{}).SummarizeRequests(context.Background(), nil, 100)
+
+	// Assert
+	if summary != "" || err != nil {
+		t.Errorf("Expected an empty summary, got %q and %v", summary, err)
+	}
+}
+
+func TestAnkifySkipSummary(t *testing.T) {
+
+	// Arrange
+	var paragraphs []string
+	for i := 0; i < 30; i++ {
+		paragraphs = append(paragraphs, fmt.Sprintf("Paragraph %d has a fact worth remembering.", i))
+	}
+	provider := &halvingProvider{}
+	ankifier := NewAnkifier(provider)
+	ankifier.Tokenizer = tokenizer.Approximate{}
+	ankifier.ChunkTokens = 100
+	ankifier.SkipSummary = true
+	ankifier.Concurrency = 3
+	chunks := map[int]string{}
+	ankifier.OnChunk = func(source Source, text string) {
+		chunks[source.Chunk] = text
+	}
+
+	// Act
+	res, err := ankifier.Ankify(context.Background(), map[int]string{1: strings.Join(paragraphs, "\n\n")}, 1)
+
+	// Assert
+	if err != nil {
+		t.Fatal(err)
+	}
+	if provider.summaries != 0 {
+		t.Errorf("Expected no summaries, got %d", provider.summaries)
+	}
+	if len(res.Questions) < 3 || len(res.Questions) != len(provider.cards) {
+		t.Fatalf("Expected one card per chunk, got %d cards for %d prompts", len(res.Questions), len(provider.cards))
+	}
+	for i, question := range res.Questions {
+		if question.Source.Chunk != i+1 {
+			t.Errorf("Card %d: expected chunk %d, got %d", i, i+1, question.Source.Chunk)
+		}
+	}
+	joined := strings.Join(provider.cards, "")
+	if !strings.Contains(joined, "Paragraph 0 ") || !strings.Contains(joined, "Paragraph 29 ") {
+		t.Error("Expected every chunk to be sent")
+	}
+	if len(chunks) != len(res.Questions) || !strings.HasPrefix(chunks[1], "Paragraph 0 ") {
+		t.Errorf("Expected OnChunk to see every chunk, got %d", len(chunks))
+	}
+}
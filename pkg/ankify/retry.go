@@ -0,0 +1,247 @@
+package ankify
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"math/rand"
+	"net"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// ErrEmptyResponse is returned when a provider answers without any content.
+var ErrEmptyResponse = errors.New("empty response from provider")
+
+// ErrRetryBudgetExhausted is returned when a call fails after the shared retry budget ran out.
+var ErrRetryBudgetExhausted = errors.New("retry budget exhausted")
+
+// APIError is returned when a provider answers with a non-2xx status code.
+type APIError struct {
+	Provider   string
+	StatusCode int
+	Body       string
+	// RetryAfter is the delay requested by the server through the Retry-After header.
+	RetryAfter time.Duration
+}
+
+func (e *APIError) Error() string {
+	return fmt.Sprintf("%s returned %d %s: %s", e.Provider, e.StatusCode, http.StatusText(e.StatusCode), e.Body)
+}
+
+// Temporary reports whether the request may succeed if sent again.
+func (e *APIError) Temporary() bool {
+	switch e.StatusCode {
+	case http.StatusRequestTimeout, http.StatusConflict, http.StatusTooManyRequests:
+		return true
+	}
+	return e.StatusCode >= 500
+}
+
+// newAPIError builds an APIError from a failed HTTP response and its body.
+func newAPIError(provider string, resp *http.Response, body []byte) *APIError {
+	return &APIError{
+		Provider:   provider,
+		StatusCode: resp.StatusCode,
+		Body:       string(body),
+		RetryAfter: parseRetryAfter(resp.Header.Get("Retry-After"), time.Now()),
+	}
+}
+
+// parseRetryAfter reads a Retry-After header given either in seconds or as an HTTP date.
+func parseRetryAfter(value string, now time.Time) time.Duration {
+	if value == "" {
+		return 0
+	}
+	if seconds, err := strconv.Atoi(value); err == nil && seconds > 0 {
+		return time.Duration(seconds) * time.Second
+	}
+	if date, err := http.ParseTime(value); err == nil && date.After(now) {
+		return date.Sub(now)
+	}
+	return 0
+}
+
+// IsRetryable classifies an error returned by a provider: rate limits, server
+// errors, network failures, timeouts and empty replies are retried, everything else is not.
+func IsRetryable(err error) bool {
+	if errors.Is(err, context.Canceled) {
+		return false
+	}
+	var api_error *APIError
+	if errors.As(err, &api_error) {
+		return api_error.Temporary()
+	}
+	if errors.Is(err, ErrEmptyResponse) {
+		return true
+	}
+	var net_error net.Error
+	return errors.As(err, &net_error)
+}
+
+// RetryPolicy controls how a RetryingProvider backs off.
+type RetryPolicy struct {
+	// MaxAttempts is the number of tries per call, including the first one.
+	MaxAttempts int
+	BaseDelay   time.Duration
+	MaxDelay    time.Duration
+	// Budget caps the retries shared by all calls of a run; 0 means no cap.
+	Budget int
+	// RequestTimeout bounds each attempt; 0 means only the caller's context applies.
+	RequestTimeout time.Duration
+}
+
+// DefaultRetryPolicy retries each call up to 4 times and a whole run up to 20 times.
+var DefaultRetryPolicy = RetryPolicy{
+	MaxAttempts:    5,
+	BaseDelay:      time.Second,
+	MaxDelay:       time.Minute,
+	Budget:         20,
+	RequestTimeout: 2 * time.Minute,
+}
+
+// RetryingProvider wraps a Provider and retries retryable errors with jittered
+// exponential backoff, honoring the server's Retry-After when present. A
+// Retry-After longer than MaxDelay fails the call instead.
+type RetryingProvider struct {
+	Provider Provider
+	Policy   RetryPolicy
+
+	mu      sync.Mutex
+	retries int
+	sleep   func(context.Context, time.Duration) error
+}
+
+// NewRetryingProvider wraps provider with the given retry policy.
+func NewRetryingProvider(provider Provider, policy RetryPolicy) *RetryingProvider {
+	return &RetryingProvider{Provider: provider, Policy: policy, sleep: sleepContext}
+}
+
+func (p *RetryingProvider) Name() string {
+	return p.Provider.Name()
+}
+
+// Complete calls the wrapped provider until it succeeds, fails permanently,
+// runs out of retries or ctx is done.
+func (p *RetryingProvider) Complete(ctx context.Context, messages []RequestMessage) (string, Usage, error) {
+	return p.retry(ctx, func(ctx context.Context) (string, Usage, error) {
+		return p.Provider.Complete(ctx, messages)
+	})
+}
+
+// CompleteJSON retries the wrapped provider's CompleteJSON like Complete, or
+// returns ErrStructuredOutputUnsupported if it has none.
+func (p *RetryingProvider) CompleteJSON(ctx context.Context, messages []RequestMessage, schema Schema) (string, Usage, error) {
+	structured, ok := p.Provider.(StructuredProvider)
+	if !ok {
+		return "", Usage{}, ErrStructuredOutputUnsupported
+	}
+	return p.retry(ctx, func(ctx context.Context) (string, Usage, error) {
+		return structured.CompleteJSON(ctx, messages, schema)
+	})
+}
+
+// Embed retries the wrapped provider's Embed like Complete, or returns
+// ErrEmbeddingsUnsupported if it has none.
+func (p *RetryingProvider) Embed(ctx context.Context, texts []string) ([][]float64, Usage, error) {
+	embedder, ok := p.Provider.(EmbeddingProvider)
+	if !ok {
+		return nil, Usage{}, ErrEmbeddingsUnsupported
+	}
+	var vectors [][]float64
+	_, usage, err := p.retry(ctx, func(ctx context.Context) (string, Usage, error) {
+		var usage Usage
+		var err error
+		vectors, usage, err = embedder.Embed(ctx, texts)
+		return "", usage, err
+	})
+	if err != nil {
+		return nil, usage, err
+	}
+	return vectors, usage, nil
+}
+
+func (p *RetryingProvider) retry(ctx context.Context, call func(ctx context.Context) (string, Usage, error)) (string, Usage, error) {
+	var total Usage
+	for attempt := 1; ; attempt++ {
+		content, usage, err := p.attempt(ctx, call)
+		total.PromptTokens += usage.PromptTokens
+		total.CompletionTokens += usage.CompletionTokens
+		total.TotalTokens += usage.TotalTokens
+		if ctx.Err() != nil {
+			return "", total, ctx.Err()
+		}
+		if err == nil || !IsRetryable(err) {
+			return content, total, err
+		}
+		if attempt >= p.Policy.MaxAttempts {
+			return "", total, fmt.Errorf("giving up after %d attempts: %w", attempt, err)
+		}
+		var api_error *APIError
+		if errors.As(err, &api_error) && p.Policy.MaxDelay > 0 && api_error.RetryAfter > p.Policy.MaxDelay {
+			return "", total, fmt.Errorf("giving up, asked to retry in %s which is more than %s: %w", api_error.RetryAfter, p.Policy.MaxDelay, err)
+		}
+		if !p.takeRetry() {
+			return "", total, fmt.Errorf("%w: %v", ErrRetryBudgetExhausted, err)
+		}
+
+		delay := p.backoff(attempt, err)
+		log.Printf("%s request failed (%v), retrying in %s (attempt %d of %d).", p.Name(), err, delay.Round(time.Millisecond), attempt+1, p.Policy.MaxAttempts)
+		if err := p.sleep(ctx, delay); err != nil {
+			return "", total, err
+		}
+	}
+}
+
+// attempt makes a single call bounded by the policy's RequestTimeout.
+func (p *RetryingProvider) attempt(ctx context.Context, call func(ctx context.Context) (string, Usage, error)) (string, Usage, error) {
+	if p.Policy.RequestTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, p.Policy.RequestTimeout)
+		defer cancel()
+	}
+	return call(ctx)
+}
+
+// sleepContext waits for d or until ctx is done, whichever comes first.
+func sleepContext(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
+
+// takeRetry consumes one retry from the shared budget.
+func (p *RetryingProvider) takeRetry() bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.Policy.Budget > 0 && p.retries >= p.Policy.Budget {
+		return false
+	}
+	p.retries++
+	return true
+}
+
+// backoff returns the delay before the next attempt: the server's Retry-After
+// if given, otherwise a random delay up to BaseDelay * 2^(attempt-1), capped at MaxDelay.
+func (p *RetryingProvider) backoff(attempt int, err error) time.Duration {
+	var api_error *APIError
+	if errors.As(err, &api_error) && api_error.RetryAfter > 0 {
+		return api_error.RetryAfter
+	}
+	delay := p.Policy.BaseDelay << uint(attempt-1)
+	if delay <= 0 || delay > p.Policy.MaxDelay {
+		delay = p.Policy.MaxDelay
+	}
+	if delay <= 0 {
+		return 0
+	}
+	return time.Duration(rand.Int63n(int64(delay)) + 1)
+}
@@ -0,0 +1,170 @@
+package ankify
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestRetryingProviderHonorsRetryAfter(t *testing.T) {
+
+	// Arrange
+	calls := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		if calls == 1 {
+			w.Header().Set("Retry-After", "7")
+			w.WriteHeader(http.StatusTooManyRequests)
+			w.Write([]byte(`{"error":{"message":"Rate limit reached"}}`))
+			return
+		}
+		w.Write([]byte(`{"choices":[{"message":{"role":"assistant","content":"ok"}}]}`))
+	}))
+	defer server.Close()
+
+	var delays []time.Duration
+	provider := NewRetryingProvider(&OpenAIProvider{Label: "openai", URL: server.URL, Client: server.Client()}, DefaultRetryPolicy)
+	provider.sleep = func(ctx context.Context, d time.Duration) error {
+		delays = append(delays, d)
+		return nil
+	}
+
+	// Act
+	content, _, err := provider.Complete(context.Background(), []RequestMessage{{Role: "user", Content: "hi"}})
+
+	// Assert
+	if err != nil {
+		t.Fatal(err)
+	}
+	if content != "ok" || calls != 2 {
+		t.Errorf("Expected success on the second call, got %q after %d calls", content, calls)
+	}
+	if len(delays) != 1 || delays[0] != 7*time.Second {
+		t.Errorf("Expected a single 7s wait, got %v", delays)
+	}
+}
+
+func TestRetryingProviderFailsOnLongRetryAfter(t *testing.T) {
+
+	// Arrange
+	calls := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		w.Header().Set("Retry-After", "86400")
+		w.WriteHeader(http.StatusTooManyRequests)
+	}))
+	defer server.Close()
+
+	provider := NewRetryingProvider(&OpenAIProvider{Label: "openai", URL: server.URL, Client: server.Client()}, DefaultRetryPolicy)
+	provider.sleep = func(ctx context.Context, d time.Duration) error {
+		t.Errorf("Expected no wait, got %s", d)
+		return nil
+	}
+
+	// Act
+	_, _, err := provider.Complete(context.Background(), []RequestMessage{{Role: "user", Content: "hi"}})
+
+	// Assert
+	var api_error *APIError
+	if !errors.As(err, &api_error) || api_error.RetryAfter != 24*time.Hour {
+		t.Fatalf("Expected the 429 APIError, got %v", err)
+	}
+	if calls != 1 || provider.retries != 0 {
+		t.Errorf("Expected a single call and no retry, got %d calls and %d retries", calls, provider.retries)
+	}
+}
+
+func TestRetryingProviderDoesNotRetryClientErrors(t *testing.T) {
+
+	// Arrange
+	calls := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		w.WriteHeader(http.StatusUnauthorized)
+	}))
+	defer server.Close()
+
+	provider := NewRetryingProvider(&OpenAIProvider{Label: "openai", URL: server.URL, Client: server.Client()}, DefaultRetryPolicy)
+	provider.sleep = func(context.Context, time.Duration) error { return nil }
+
+	// Act
+	_, _, err := provider.Complete(context.Background(), []RequestMessage{{Role: "user", Content: "hi"}})
+
+	// Assert
+	var api_error *APIError
+	if !errors.As(err, &api_error) || api_error.StatusCode != http.StatusUnauthorized {
+		t.Fatalf("Expected a 401 APIError, got %v", err)
+	}
+	if calls != 1 {
+		t.Errorf("Expected a single call, got %d", calls)
+	}
+}
+
+func TestRetryingProviderBudget(t *testing.T) {
+
+	// Arrange
+	calls := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer server.Close()
+
+	policy := RetryPolicy{MaxAttempts: 5, BaseDelay: time.Millisecond, MaxDelay: time.Millisecond, Budget: 3}
+	provider := NewRetryingProvider(&OpenAIProvider{Label: "openai", URL: server.URL, Client: server.Client()}, policy)
+	provider.sleep = func(context.Context, time.Duration) error { return nil }
+
+	// Act
+	_, _, first := provider.Complete(context.Background(), []RequestMessage{{Role: "user", Content: "hi"}})
+	_, _, second := provider.Complete(context.Background(), []RequestMessage{{Role: "user", Content: "hi"}})
+
+	// Assert
+	if !errors.Is(first, ErrRetryBudgetExhausted) || !errors.Is(second, ErrRetryBudgetExhausted) {
+		t.Errorf("Expected both calls to exhaust the budget, got %v and %v", first, second)
+	}
+	if calls != 5 {
+		t.Errorf("Expected 3 retries plus 2 first attempts, got %d calls", calls)
+	}
+}
+
+func TestParseRetryAfter(t *testing.T) {
+	now := time.Date(2023, 3, 1, 12, 0, 0, 0, time.UTC)
+	tests := map[string]time.Duration{
+		"":                              0,
+		"30":                            30 * time.Second,
+		"Wed, 01 Mar 2023 12:00:10 GMT": 10 * time.Second,
+		"soon":                          0,
+	}
+	for value, expected := range tests {
+		if got := parseRetryAfter(value, now); got != expected {
+			t.Errorf("parseRetryAfter(%q) = %s, expected %s", value, got, expected)
+		}
+	}
+}
+
+func TestRetryingProviderStopsWhenContextDone(t *testing.T) {
+
+	// Arrange
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer server.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	provider := NewRetryingProvider(&OpenAIProvider{Label: "openai", URL: server.URL, Client: server.Client()}, DefaultRetryPolicy)
+	provider.sleep = func(ctx context.Context, d time.Duration) error {
+		cancel()
+		return sleepContext(ctx, d)
+	}
+
+	// Act
+	_, _, err := provider.Complete(ctx, []RequestMessage{{Role: "user", Content: "hi"}})
+
+	// Assert
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("Expected context.Canceled, got %v", err)
+	}
+}
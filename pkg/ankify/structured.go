@@ -0,0 +1,164 @@
+package ankify
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+)
+
+// Schema is a JSON schema that a StructuredProvider constrains its reply to.
+type Schema struct {
+	Name   string
+	Schema json.RawMessage
+}
+
+// StructuredProvider is implemented by providers that can constrain their
+// reply to a JSON schema, through JSON mode or tool calling.
+type StructuredProvider interface {
+	Provider
+	CompleteJSON(ctx context.Context, messages []RequestMessage, schema Schema) (string, Usage, error)
+}
+
+// ErrStructuredOutputUnsupported is returned by CompleteJSON when the provider
+// cannot constrain its output; callers fall back to the text format.
+var ErrStructuredOutputUnsupported = errors.New("structured output not supported")
+
+// ErrInvalidCards is returned when a structured reply does not match CardSchema.
+var ErrInvalidCards = errors.New("invalid cards")
+
+// CardSchema describes the reply expected for JSON_FORMAT_HELPER.
+var CardSchema = Schema{
+	Name: "anki_cards",
+	Schema: json.RawMessage(`{
+	"type": "object",
+	"properties": {
+		"cards": {
+			"type": "array",
+			"items": {
+				"type": "object",
+				"properties": {
+					"question": {"type": "string"},
+					"answer": {"type": "string"}
+				},
+				"required": ["question", "answer"],
+				"additionalProperties": false
+			}
+		}
+	},
+	"required": ["cards"],
+	"additionalProperties": false
+}`),
+}
+
+// JSON_FORMAT_HELPER fills the {format} placeholder of QUESTION_HELPER for
+// providers with structured output; replies are read with ParseAnkiJSON.
+const JSON_FORMAT_HELPER = `give it to me as a JSON object with a "cards" array, where each card has a "question" and an "answer" string: 
+
+{"cards": [{"question": "[Insert question here]", "answer": "[Insert answer here]"}]}
+
+`
+
+type jsonCards struct {
+	Cards []struct {
+		Question *string `json:"question"`
+		Answer   *string `json:"answer"`
+	} `json:"cards"`
+}
+
+// ParseAnkiJSON reads a reply constrained by CardSchema. Cards with a missing
+// or empty question or answer are skipped; a reply that is not valid JSON,
+// has no "cards" array or has no valid card returns ErrInvalidCards.
+func ParseAnkiJSON(anki_json string) (AnkiQuestions, error) {
+	anki_json = stripCodeFence(anki_json)
+
+	decoder := json.NewDecoder(strings.NewReader(anki_json))
+	decoder.DisallowUnknownFields()
+	var reply jsonCards
+	if err := decoder.Decode(&reply); err != nil {
+		return AnkiQuestions{}, fmt.Errorf("%w: %v", ErrInvalidCards, err)
+	}
+	if reply.Cards == nil {
+		return AnkiQuestions{}, fmt.Errorf(`%w: missing "cards" array`, ErrInvalidCards)
+	}
+
+	anki_cards := AnkiQuestions{}
+	for i, card := range reply.Cards {
+		if card.Question == nil || card.Answer == nil || strings.TrimSpace(*card.Question) == "" || strings.TrimSpace(*card.Answer) == "" {
+			log.Printf("Skipping card %d: it needs a non-empty question and answer.", i+1)
+			continue
+		}
+		anki_cards.Questions = append(anki_cards.Questions, AnkiQuestion{
+			Question: strings.TrimSpace(*card.Question),
+			Answer:   strings.TrimSpace(*card.Answer),
+		})
+	}
+	if len(reply.Cards) > 0 && len(anki_cards.Questions) == 0 {
+		return AnkiQuestions{}, fmt.Errorf("%w: none of the %d cards has both a question and an answer", ErrInvalidCards, len(reply.Cards))
+	}
+	return anki_cards, nil
+}
+
+// stripCodeFence removes a Markdown code fence some models wrap JSON in.
+func stripCodeFence(text string) string {
+	text = strings.TrimSpace(text)
+	if !strings.HasPrefix(text, "```") {
+		return text
+	}
+	text = strings.TrimPrefix(text, "```")
+	if newline := strings.Index(text, "\n"); newline >= 0 {
+		text = text[newline+1:]
+	}
+	return strings.TrimSpace(strings.TrimSuffix(strings.TrimSpace(text), "```"))
+}
+
+// isStructuredOutputUnsupported reports whether err means the provider cannot
+// produce structured output, either by design or because the server rejected
+// the request's response format.
+func isStructuredOutputUnsupported(err error) bool {
+	if errors.Is(err, ErrStructuredOutputUnsupported) {
+		return true
+	}
+	var api_error *APIError
+	return errors.As(err, &api_error) &&
+		(api_error.StatusCode == http.StatusBadRequest || api_error.StatusCode == http.StatusUnprocessableEntity) &&
+		strings.Contains(strings.ToLower(api_error.Body), "response_format")
+}
+
+// completeJSON sends a single user prompt constrained to schema and records its usage.
+func (a *Ankifier) completeJSON(ctx context.Context, prompt string, schema Schema) (string, error) {
+	structured, ok := a.Provider.(StructuredProvider)
+	if !ok {
+		return "", ErrStructuredOutputUnsupported
+	}
+	message := RequestMessage{
+		Role:    "user",
+		Content: prompt,
+	}
+	if err := a.acquire(ctx); err != nil {
+		return "", err
+	}
+	response, usage, err := structured.CompleteJSON(ctx, []RequestMessage{message}, schema)
+	a.release()
+	a.addUsage(usage)
+	if err != nil {
+		return "", err
+	}
+	return response, nil
+}
+
+// textOnly reports whether the provider turned out not to support structured output.
+func (a *Ankifier) textOnly() bool {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return a.text_only
+}
+
+func (a *Ankifier) setTextOnly() {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.text_only = true
+}
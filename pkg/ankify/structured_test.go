@@ -0,0 +1,137 @@
+package ankify
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestParseAnkiJSON(t *testing.T) {
+	tests := []struct {
+		name    string
+		reply   string
+		want    []AnkiQuestion
+		invalid bool
+	}{
+		{
+			name:  "cards",
+			reply: `{"cards":[{"question":"What is Go?","answer":"A language"},{"question":" Who wrote it? ","answer":"Google\n"}]}`,
+			want:  []AnkiQuestion{{Question: "What is Go?", Answer: "A language"}, {Question: "Who wrote it?", Answer: "Google"}},
+		},
+		{
+			name:  "code fence",
+			reply: "```json\n{\"cards\":[{\"question\":\"Q1\",\"answer\":\"A1\"}]}\n```",
+			want:  []AnkiQuestion{{Question: "Q1", Answer: "A1"}},
+		},
+		{
+			name:  "skips incomplete cards",
+			reply: `{"cards":[{"question":"Q1","answer":""},{"question":"Q2","answer":"A2"},{"answer":"A3"}]}`,
+			want:  []AnkiQuestion{{Question: "Q2", Answer: "A2"}},
+		},
+		{name: "no cards", reply: `{"cards":[]}`},
+		{name: "text reply", reply: "Q: What is Go?\nA: A language", invalid: true},
+		{name: "missing cards", reply: `{"questions":[]}`, invalid: true},
+		{name: "only incomplete cards", reply: `{"cards":[{"question":"Q1"}]}`, invalid: true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			res, err := ParseAnkiJSON(test.reply)
+			if test.invalid {
+				if !errors.Is(err, ErrInvalidCards) {
+					t.Errorf("Expected ErrInvalidCards, got %v", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(res.Questions) != len(test.want) {
+				t.Fatalf("Expected %d cards, got %+v", len(test.want), res.Questions)
+			}
+			for i, card := range test.want {
+				if res.Questions[i] != card {
+					t.Errorf("Card %d: expected %+v, got %+v", i, card, res.Questions[i])
+				}
+			}
+		})
+	}
+}
+
+func TestAnkifyRequestsStructuredCards(t *testing.T) {
+
+	// Arrange
+	var received OpenAIRequest
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		json.NewDecoder(r.Body).Decode(&received)
+		w.Write([]byte(`{"choices":[{"message":{"role":"assistant","content":"{\"cards\":[{\"question\":\"What is Berlin?\",\"answer\":\"The capital of Germany\"}]}"}}]}`))
+	}))
+	defer server.Close()
+
+	provider, err := NewProvider(ProviderConfig{BaseURL: server.URL})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ankifier := NewAnkifier(provider)
+
+	// Act
+	res, err := ankifier.Ankify(context.Background(), map[int]string{1: "The capital of Germany is Berlin."}, 1)
+
+	// Assert
+	if err != nil {
+		t.Fatal(err)
+	}
+	format := received.ResponseFormat
+	if format == nil || format.Type != "json_schema" || format.JSONSchema.Name != CardSchema.Name || !format.JSONSchema.Strict {
+		t.Errorf("Expected a strict json_schema response format, got %+v", format)
+	}
+	if !strings.Contains(received.Messages[0].Content, `"cards"`) {
+		t.Error("Expected the prompt to describe the JSON format")
+	}
+	if len(res.Questions) != 1 || res.Questions[0].Question != "What is Berlin?" {
+		t.Errorf("Unexpected questions: %+v", res.Questions)
+	}
+}
+
+func TestAnkifyFallsBackToTextCards(t *testing.T) {
+
+	// Arrange
+	requests := 0
+	text_requests := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var received OpenAIRequest
+		json.NewDecoder(r.Body).Decode(&received)
+		requests++
+		if received.ResponseFormat != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write([]byte(`{"error":{"message":"Invalid parameter: 'response_format' is not supported with this model."}}`))
+			return
+		}
+		text_requests++
+		w.Write([]byte(`{"choices":[{"message":{"role":"assistant","content":"Q: What is Berlin?\nA: The capital of Germany"}}]}`))
+	}))
+	defer server.Close()
+
+	provider, err := NewProvider(ProviderConfig{BaseURL: server.URL})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ankifier := NewAnkifier(provider)
+
+	// Act
+	res, err := ankifier.Ankify(context.Background(), map[int]string{1: "The capital of Germany is Berlin.", 2: "Paris is in France."}, 1)
+
+	// Assert
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(res.Questions) != 2 || res.Questions[0].Answer != "The capital of Germany" {
+		t.Errorf("Unexpected questions: %+v", res.Questions)
+	}
+	if requests != 3 || text_requests != 2 {
+		t.Errorf("Expected one structured request then only text requests, got %d requests, %d as text", requests, text_requests)
+	}
+}
@@ -0,0 +1,235 @@
+// Package chunker splits documents into chunks that fit a token budget,
+// cutting on paragraph, then sentence, then word boundaries.
+package chunker
+
+import (
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/acrucetta/anki-builder/pkg/tokenizer"
+)
+
+// Options controls how text is chunked.
+type Options struct {
+	// MaxTokens is the token budget of a chunk, including its overlap.
+	MaxTokens int
+	// Overlap is the number of tokens from the end of a chunk repeated at the
+	// start of the next one, so facts cut at a boundary keep their context.
+	Overlap int
+	// Tokenizer counts tokens (default is tokenizer.ForModel("")).
+	Tokenizer tokenizer.Tokenizer
+}
+
+// Split returns the chunks of text. Chunks are trimmed of surrounding
+// whitespace and never exceed MaxTokens; empty text gives no chunks.
+func Split(text string, options Options) []string {
+	if options.Tokenizer == nil {
+		options.Tokenizer = tokenizer.ForModel("")
+	}
+	if options.MaxTokens <= 0 {
+		options.MaxTokens = 1
+	}
+	if options.Overlap >= options.MaxTokens {
+		options.Overlap = options.MaxTokens / 2
+	}
+	if strings.TrimSpace(text) == "" {
+		return nil
+	}
+
+	segments := segment(text, options, paragraphLevel)
+	return pack(segments, options)
+}
+
+type level int
+
+const (
+	paragraphLevel level = iota
+	sentenceLevel
+	wordLevel
+	tokenLevel
+)
+
+// segment cuts text at the given level and recursively cuts any piece over
+// the budget at the next finer level. Joining the segments gives back text.
+func segment(text string, options Options, at level) []string {
+	var pieces []string
+	switch at {
+	case paragraphLevel:
+		pieces = splitParagraphs(text)
+	case sentenceLevel:
+		pieces = splitSentences(text)
+	case wordLevel:
+		pieces = splitWords(text)
+	default:
+		return splitTokens(text, options)
+	}
+
+	var segments []string
+	for _, piece := range pieces {
+		if options.Tokenizer.Count(piece) <= options.MaxTokens {
+			segments = append(segments, piece)
+			continue
+		}
+		segments = append(segments, segment(piece, options, at+1)...)
+	}
+	return segments
+}
+
+// pack greedily joins consecutive segments into chunks within the budget,
+// starting each chunk after the first with up to Overlap tokens of the previous one.
+func pack(segments []string, options Options) []string {
+	var chunks []string
+	var current []string
+	current_tokens := 0
+	fresh := 0 // segments in current that are not overlap
+
+	for _, segment := range segments {
+		tokens := options.Tokenizer.Count(segment)
+		if fresh > 0 && current_tokens+tokens > options.MaxTokens {
+			chunks = appendChunk(chunks, current)
+			current = overlap(current, options, options.MaxTokens-tokens)
+			current_tokens = countAll(current, options)
+			fresh = 0
+		}
+		current = append(current, segment)
+		current_tokens += tokens
+		fresh++
+	}
+	if fresh > 0 {
+		chunks = appendChunk(chunks, current)
+	}
+	return chunks
+}
+
+// overlap returns the trailing segments of a finished chunk to repeat in the
+// next one: at most Overlap tokens, and no more than room.
+func overlap(previous []string, options Options, room int) []string {
+	budget := options.Overlap
+	if room < budget {
+		budget = room
+	}
+	tokens := 0
+	start := len(previous)
+	for start > 0 {
+		count := options.Tokenizer.Count(previous[start-1])
+		if tokens+count > budget {
+			break
+		}
+		tokens += count
+		start--
+	}
+	return append([]string(nil), previous[start:]...)
+}
+
+func countAll(segments []string, options Options) int {
+	count := 0
+	for _, segment := range segments {
+		count += options.Tokenizer.Count(segment)
+	}
+	return count
+}
+
+func appendChunk(chunks []string, segments []string) []string {
+	chunk := strings.TrimSpace(strings.Join(segments, ""))
+	if chunk == "" {
+		return chunks
+	}
+	return append(chunks, chunk)
+}
+
+// splitParagraphs cuts after each run of blank lines.
+func splitParagraphs(text string) []string {
+	var paragraphs []string
+	for len(text) > 0 {
+		index := strings.Index(text, "\n\n")
+		if index < 0 {
+			paragraphs = append(paragraphs, text)
+			break
+		}
+		end := index + 2
+		for end < len(text) && (text[end] == '\n' || text[end] == '\r') {
+			end++
+		}
+		paragraphs = append(paragraphs, text[:end])
+		text = text[end:]
+	}
+	return paragraphs
+}
+
+// splitSentences cuts after sentence-ending punctuation followed by
+// whitespace, keeping closing quotes and brackets with their sentence.
+// CJK full stops end a sentence even without whitespace.
+func splitSentences(text string) []string {
+	var sentences []string
+	start := 0
+	for i := 0; i < len(text); {
+		r, size := utf8.DecodeRuneInString(text[i:])
+		i += size
+		switch r {
+		case '。', '！', '？':
+		case '.', '!', '?', '…':
+			for i < len(text) {
+				closing, closing_size := utf8.DecodeRuneInString(text[i:])
+				if !strings.ContainsRune(`"')]”’»`, closing) {
+					break
+				}
+				i += closing_size
+			}
+			next, _ := utf8.DecodeRuneInString(text[i:])
+			if i < len(text) && !unicode.IsSpace(next) {
+				continue
+			}
+		default:
+			continue
+		}
+		for i < len(text) {
+			next, next_size := utf8.DecodeRuneInString(text[i:])
+			if !unicode.IsSpace(next) {
+				break
+			}
+			i += next_size
+		}
+		sentences = append(sentences, text[start:i])
+		start = i
+	}
+	if start < len(text) {
+		sentences = append(sentences, text[start:])
+	}
+	return sentences
+}
+
+// splitWords cuts after each run of whitespace.
+func splitWords(text string) []string {
+	var words []string
+	start := 0
+	in_space := false
+	for i, r := range text {
+		space := unicode.IsSpace(r)
+		if in_space && !space {
+			words = append(words, text[start:i])
+			start = i
+		}
+		in_space = space
+	}
+	if start < len(text) {
+		words = append(words, text[start:])
+	}
+	return words
+}
+
+// splitTokens cuts a single word longer than the budget into runs of tokens.
+func splitTokens(text string, options Options) []string {
+	var pieces []string
+	for len(text) > 0 {
+		piece := tokenizer.Truncate(options.Tokenizer, text, options.MaxTokens)
+		if piece == "" {
+			// The budget is smaller than a single character; emit it anyway.
+			_, size := utf8.DecodeRuneInString(text)
+			piece = text[:size]
+		}
+		pieces = append(pieces, piece)
+		text = text[len(piece):]
+	}
+	return pieces
+}
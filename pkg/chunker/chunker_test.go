@@ -0,0 +1,175 @@
+package chunker
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"unicode/utf8"
+
+	"github.com/acrucetta/anki-builder/pkg/tokenizer"
+)
+
+// words counts the tokens of the test tokenizer: one per whitespace-separated word.
+type words struct{}
+
+func (words) Name() string { return "words" }
+
+func (words) Count(text string) int { return len(splitWordsForTest(text)) }
+
+func (words) Split(text string) []string { return splitWordsForTest(text) }
+
+func splitWordsForTest(text string) []string {
+	var tokens []string
+	for _, word := range splitWords(text) {
+		if strings.TrimSpace(word) != "" || len(tokens) == 0 {
+			tokens = append(tokens, word)
+		} else {
+			tokens[len(tokens)-1] += word
+		}
+	}
+	if len(tokens) == 1 && strings.TrimSpace(tokens[0]) == "" {
+		return nil
+	}
+	return tokens
+}
+
+func TestSplit(t *testing.T) {
+	tests := []struct {
+		name     string
+		text     string
+		options  Options
+		expected []string
+	}{
+		{
+			name:     "empty",
+			text:     "",
+			options:  Options{MaxTokens: 10},
+			expected: nil,
+		},
+		{
+			name:     "whitespace only",
+			text:     " \n\n\t ",
+			options:  Options{MaxTokens: 10},
+			expected: nil,
+		},
+		{
+			name:     "single word",
+			text:     "Hi",
+			options:  Options{MaxTokens: 10},
+			expected: []string{"Hi"},
+		},
+		{
+			name:     "fits in one chunk",
+			text:     "One two three.\n\nFour five.",
+			options:  Options{MaxTokens: 10},
+			expected: []string{"One two three.\n\nFour five."},
+		},
+		{
+			name:     "paragraphs are packed whole",
+			text:     "One two three.\n\nFour five six.\n\nSeven eight.",
+			options:  Options{MaxTokens: 6},
+			expected: []string{"One two three.\n\nFour five six.", "Seven eight."},
+		},
+		{
+			name:     "long paragraph is cut into sentences",
+			text:     "One two three. Four five six! Seven eight nine? Ten.",
+			options:  Options{MaxTokens: 4},
+			expected: []string{"One two three.", "Four five six!", "Seven eight nine? Ten."},
+		},
+		{
+			name:     "very long sentence is cut into words",
+			text:     "one two three four five six seven eight nine ten",
+			options:  Options{MaxTokens: 4},
+			expected: []string{"one two three four", "five six seven eight", "nine ten"},
+		},
+		{
+			name:     "decimal points do not end sentences",
+			text:     "Pi is 3.14 roughly. It is irrational.",
+			options:  Options{MaxTokens: 4},
+			expected: []string{"Pi is 3.14 roughly.", "It is irrational."},
+		},
+		{
+			name:     "quotes stay with their sentence",
+			text:     `He said "stop." Then he left.`,
+			options:  Options{MaxTokens: 3},
+			expected: []string{`He said "stop."`, "Then he left."},
+		},
+		{
+			name:     "overlap repeats trailing sentences",
+			text:     "A b. C d. E f. G h.",
+			options:  Options{MaxTokens: 4, Overlap: 2},
+			expected: []string{"A b. C d.", "C d. E f.", "E f. G h."},
+		},
+		{
+			name:     "overlap never exceeds the budget",
+			text:     "A b c. D e f g.",
+			options:  Options{MaxTokens: 4, Overlap: 3},
+			expected: []string{"A b c.", "D e f g."},
+		},
+		{
+			name:     "CJK full stops end sentences without spaces",
+			text:     "東京は日本の首都です。大阪は商業の中心です。",
+			options:  Options{MaxTokens: 5, Tokenizer: tokenizer.Approximate{}},
+			expected: []string{"東京は日本の首都です。", "大阪は商業の中心です。"},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if test.options.Tokenizer == nil {
+				test.options.Tokenizer = words{}
+			}
+			got := Split(test.text, test.options)
+			if !reflect.DeepEqual(got, test.expected) {
+				t.Errorf("Split(%q) = %q, expected %q", test.text, got, test.expected)
+			}
+		})
+	}
+}
+
+func TestSplitLongWordKeepsRunesWhole(t *testing.T) {
+
+	// Arrange
+	text := strings.Repeat("ü", 30) + " 🙂🙂🙂🙂🙂🙂🙂🙂"
+	options := Options{MaxTokens: 3, Tokenizer: tokenizer.Approximate{}}
+
+	// Act
+	chunks := Split(text, options)
+
+	// Assert
+	if len(chunks) < 4 {
+		t.Fatalf("Expected the long word to be cut, got %q", chunks)
+	}
+	for _, chunk := range chunks {
+		if !utf8.ValidString(chunk) {
+			t.Errorf("Chunk %q is not valid UTF-8", chunk)
+		}
+		if count := options.Tokenizer.Count(chunk); count > options.MaxTokens {
+			t.Errorf("Chunk %q has %d tokens, expected at most %d", chunk, count, options.MaxTokens)
+		}
+	}
+	if strings.ReplaceAll(strings.Join(chunks, ""), " ", "") != strings.ReplaceAll(text, " ", "") {
+		t.Error("Expected the chunks to cover the whole text")
+	}
+}
+
+func TestSplitRespectsBudget(t *testing.T) {
+
+	// Arrange
+	text := strings.Repeat("The mitochondria is the powerhouse of the cell. ", 40) + "\n\n" +
+		strings.Repeat("Ĉu vi parolas Esperanton? ", 30)
+	options := Options{MaxTokens: 50, Overlap: 10, Tokenizer: tokenizer.Approximate{}}
+
+	// Act
+	chunks := Split(text, options)
+
+	// Assert
+	for i, chunk := range chunks {
+		if count := options.Tokenizer.Count(chunk); count > options.MaxTokens {
+			t.Errorf("Chunk %d has %d tokens, expected at most %d", i, count, options.MaxTokens)
+		}
+	}
+	if !strings.HasSuffix(chunks[len(chunks)-1], "Esperanton?") {
+		t.Errorf("Expected the last chunk to keep the end of the text, got %q", chunks[len(chunks)-1])
+	}
+}
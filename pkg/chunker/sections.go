@@ -0,0 +1,68 @@
+package chunker
+
+import (
+	"regexp"
+	"strings"
+)
+
+// Section is the part of a document under a heading.
+type Section struct {
+	// Title is the innermost heading, empty for text before the first heading.
+	Title string
+	// Path lists the headings from the outermost one down to Title.
+	Path  []string
+	Level int
+	// Text is the body of the section, without its heading line.
+	Text string
+}
+
+// atxHeading matches Markdown headings such as "## Results ##".
+var atxHeading = regexp.MustCompile(`^ {0,3}(#{1,6})[ \t]+(.*?)[ \t#]*$`)
+
+// SplitSections splits Markdown text on its ATX headings ("#" to "######"),
+// ignoring lines inside fenced code blocks. Sections without any text are
+// dropped; their titles still appear in the Path of nested sections.
+func SplitSections(text string) []Section {
+	var sections []Section
+	var path []string
+	var levels []int
+	current := Section{}
+	var body strings.Builder
+	in_fence := false
+
+	flush := func() {
+		current.Text = strings.TrimSpace(body.String())
+		if current.Text != "" {
+			sections = append(sections, current)
+		}
+		body.Reset()
+	}
+
+	for _, line := range strings.SplitAfter(text, "\n") {
+		trimmed := strings.TrimSpace(line)
+		if strings.HasPrefix(trimmed, "```") || strings.HasPrefix(trimmed, "~~~") {
+			in_fence = !in_fence
+		}
+		match := atxHeading.FindStringSubmatch(strings.TrimRight(line, "\r\n"))
+		if in_fence || match == nil {
+			body.WriteString(line)
+			continue
+		}
+
+		flush()
+		level := len(match[1])
+		for len(levels) > 0 && levels[len(levels)-1] >= level {
+			levels = levels[:len(levels)-1]
+			path = path[:len(path)-1]
+		}
+		levels = append(levels, level)
+		path = append(path, match[2])
+		current = Section{
+			Title: match[2],
+			Path:  append([]string(nil), path...),
+			Level: level,
+		}
+	}
+	flush()
+	return sections
+}
@@ -0,0 +1,42 @@
+package chunker
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestSplitSections(t *testing.T) {
+
+	// Arrange
+	text := "Preface text.\n\n" +
+		"# Chapter 1 #\n\n" +
+		"## Background\n\nSome background.\n\n" +
+		"```sh\n# not a heading\n```\n\n" +
+		"## Method\n\nThe method.\n\n" +
+		"# Chapter 2\n\nThe end.\n"
+
+	// Act
+	sections := SplitSections(text)
+
+	// Assert
+	expected := []Section{
+		{Title: "", Path: nil, Level: 0, Text: "Preface text."},
+		{Title: "Background", Path: []string{"Chapter 1", "Background"}, Level: 2, Text: "Some background.\n\n```sh\n# not a heading\n```"},
+		{Title: "Method", Path: []string{"Chapter 1", "Method"}, Level: 2, Text: "The method."},
+		{Title: "Chapter 2", Path: []string{"Chapter 2"}, Level: 1, Text: "The end."},
+	}
+	if !reflect.DeepEqual(sections, expected) {
+		t.Errorf("Expected %+v, got %+v", expected, sections)
+	}
+}
+
+func TestSplitSectionsWithoutHeadings(t *testing.T) {
+
+	// Act
+	sections := SplitSections("Just a paragraph.\n#hashtag is not a heading")
+
+	// Assert
+	if len(sections) != 1 || sections[0].Title != "" || sections[0].Text != "Just a paragraph.\n#hashtag is not a heading" {
+		t.Errorf("Expected a single untitled section, got %+v", sections)
+	}
+}
@@ -0,0 +1,201 @@
+// Package dedupe finds cards that repeat earlier ones, within a run or across
+// runs, by comparing their normalized text with MinHash signatures of
+// character shingles.
+package dedupe
+
+import (
+	"fmt"
+	"hash/fnv"
+	"strings"
+	"unicode"
+
+	"github.com/acrucetta/anki-builder/pkg/ankify"
+)
+
+// DEFAULT_THRESHOLD is the similarity from which a card is a duplicate.
+const DEFAULT_THRESHOLD = 0.8
+
+// SHINGLE_SIZE is the length in characters of the shingles compared.
+const SHINGLE_SIZE = 4
+
+// NUM_HASHES is the length of a MinHash signature; the similarity of two
+// signatures estimates the Jaccard similarity of the shingles within about
+// 1/sqrt(NUM_HASHES).
+const NUM_HASHES = 128
+
+// Normalize lowercases text, shows cloze deletions as their text, and keeps
+// only letters and digits separated by single spaces, so cards that differ
+// in case, punctuation or spacing compare equal.
+func Normalize(text string) string {
+	text = ankify.ClozeText(text)
+	words := strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+	return strings.Join(words, " ")
+}
+
+// Signature is the MinHash signature of a text.
+type Signature [NUM_HASHES]uint64
+
+// NewSignature returns the signature of the SHINGLE_SIZE character shingles
+// of text, which should be normalized.
+func NewSignature(text string) Signature {
+	var signature Signature
+	for i := range signature {
+		signature[i] = ^uint64(0)
+	}
+	runes := []rune(text)
+	last := len(runes) - SHINGLE_SIZE
+	if last < 0 {
+		last = 0
+	}
+	for start := 0; start <= last; start++ {
+		end := start + SHINGLE_SIZE
+		if end > len(runes) {
+			end = len(runes)
+		}
+		hash := fnv.New64a()
+		hash.Write([]byte(string(runes[start:end])))
+		shingle := hash.Sum64()
+		for i := range signature {
+			if value := mix(shingle ^ seeds[i]); value < signature[i] {
+				signature[i] = value
+			}
+		}
+	}
+	return signature
+}
+
+// Similarity estimates the Jaccard similarity of the shingles of two texts.
+func (s Signature) Similarity(other Signature) float64 {
+	equal := 0
+	for i := range s {
+		if s[i] == other[i] {
+			equal++
+		}
+	}
+	return float64(equal) / NUM_HASHES
+}
+
+// seeds make NUM_HASHES hash functions out of mix.
+var seeds = func() [NUM_HASHES]uint64 {
+	var seeds [NUM_HASHES]uint64
+	state := uint64(0x6a09e667f3bcc908)
+	for i := range seeds {
+		state += 0x9e3779b97f4a7c15
+		seeds[i] = mix(state)
+	}
+	return seeds
+}()
+
+// mix is the splitmix64 finalizer.
+func mix(x uint64) uint64 {
+	x ^= x >> 30
+	x *= 0xbf58476d1ce4e5b9
+	x ^= x >> 27
+	x *= 0x94d049bb133111eb
+	x ^= x >> 31
+	return x
+}
+
+// Duplicate is a card dropped for repeating an earlier one.
+type Duplicate struct {
+	Card ankify.AnkiQuestion
+	// Of is the card kept in its place, and OfID its id in the store, or 0
+	// if it was written in the same run.
+	Of         ankify.AnkiQuestion
+	OfID       int64
+	Similarity float64
+}
+
+func (d Duplicate) String() string {
+	of := "another card of this run"
+	if d.OfID != 0 {
+		of = fmt.Sprintf("stored card #%d", d.OfID)
+	}
+	return fmt.Sprintf("%q duplicates %s %q (%.0f%% similar)", d.Card.Question, of, d.Of.Question, d.Similarity*100)
+}
+
+type seenCard struct {
+	id        int64
+	card      ankify.AnkiQuestion
+	text      string
+	signature Signature
+}
+
+// Deduper remembers cards and drops new ones too similar to them. Cards are
+// compared by their question and answer, and only with cards of the same type.
+type Deduper struct {
+	// Threshold is the similarity from which a card is a duplicate, between
+	// 0 and 1; 1 drops exact duplicates after normalization only.
+	Threshold float64
+	seen      []seenCard
+}
+
+// NewDeduper returns a Deduper with the threshold, or DEFAULT_THRESHOLD if it
+// is not positive.
+func NewDeduper(threshold float64) *Deduper {
+	if threshold <= 0 {
+		threshold = DEFAULT_THRESHOLD
+	}
+	return &Deduper{Threshold: threshold}
+}
+
+// Add remembers a card written before, with its id in the store.
+func (d *Deduper) Add(id int64, card ankify.AnkiQuestion) {
+	text := cardText(card)
+	d.seen = append(d.seen, seenCard{id: id, card: card, text: text, signature: NewSignature(text)})
+}
+
+// Match returns the remembered card most similar to card, if its similarity
+// reaches the threshold.
+func (d *Deduper) Match(card ankify.AnkiQuestion) (Duplicate, bool) {
+	text := cardText(card)
+	signature := NewSignature(text)
+	best := Duplicate{Card: card}
+	for _, seen := range d.seen {
+		if cardType(seen.card) != cardType(card) {
+			continue
+		}
+		similarity := 1.0
+		if seen.text != text {
+			similarity = signature.Similarity(seen.signature)
+			// Only identical texts count as duplicates at a threshold of 1
+			if similarity >= 1 {
+				similarity = 0.99
+			}
+		}
+		if similarity > best.Similarity {
+			best.Of, best.OfID, best.Similarity = seen.card, seen.id, similarity
+		}
+	}
+	return best, best.Similarity >= d.Threshold
+}
+
+// Filter returns the cards that do not duplicate a remembered card or an
+// earlier card of the list, and the duplicates it dropped. Kept cards are
+// remembered.
+func (d *Deduper) Filter(cards []ankify.AnkiQuestion) ([]ankify.AnkiQuestion, []Duplicate) {
+	kept := []ankify.AnkiQuestion{}
+	duplicates := []Duplicate{}
+	for _, card := range cards {
+		if duplicate, ok := d.Match(card); ok {
+			duplicates = append(duplicates, duplicate)
+			continue
+		}
+		kept = append(kept, card)
+		d.Add(0, card)
+	}
+	return kept, duplicates
+}
+
+func cardText(card ankify.AnkiQuestion) string {
+	return Normalize(card.Question + " " + card.Answer)
+}
+
+func cardType(card ankify.AnkiQuestion) ankify.CardType {
+	if card.Type == "" {
+		return ankify.CARD_TYPE_BASIC
+	}
+	return card.Type
+}
@@ -0,0 +1,80 @@
+package dedupe
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/acrucetta/anki-builder/pkg/ankify"
+)
+
+func TestNormalize(t *testing.T) {
+
+	// Arrange
+	text := "  {{c1::Paris::city}} is the Capital\nof FRANCE, isn't it?"
+
+	// Act
+	normalized := Normalize(text)
+
+	// Assert
+	if normalized != "paris is the capital of france isn t it" {
+		t.Errorf("Unexpected normalized text %q", normalized)
+	}
+}
+
+func TestSignatureSimilarity(t *testing.T) {
+
+	// Arrange
+	a := NewSignature(Normalize("What does a goroutine share with other goroutines? The address space."))
+	b := NewSignature(Normalize("What does a goroutine share with the other goroutines? The address space"))
+	c := NewSignature(Normalize("Which keyword defers a call until the function returns? defer"))
+
+	// Act
+	near, far := a.Similarity(b), a.Similarity(c)
+
+	// Assert
+	if a.Similarity(a) != 1 {
+		t.Errorf("Expected a signature to equal itself, got %v", a.Similarity(a))
+	}
+	if near < 0.8 || far > 0.2 {
+		t.Errorf("Expected a high and a low similarity, got %v and %v", near, far)
+	}
+}
+
+func TestDeduperFilter(t *testing.T) {
+
+	// Arrange
+	deduper := NewDeduper(0)
+	deduper.Add(7, ankify.AnkiQuestion{Question: "What is a goroutine?", Answer: "A lightweight thread managed by the Go runtime.", Type: ankify.CARD_TYPE_BASIC})
+	cards := []ankify.AnkiQuestion{
+		{Question: "What is a goroutine ?", Answer: "A lightweight thread managed by the Go runtime"},
+		{Question: "What does the select statement do?", Answer: "It waits on several channel operations."},
+		{Question: "What does a select statement do?", Answer: "It waits on several channel operations."},
+		{Question: "{{c1::Goroutines}} are lightweight threads managed by the Go runtime.", Type: ankify.CARD_TYPE_CLOZE},
+	}
+
+	// Act
+	kept, duplicates := deduper.Filter(cards)
+
+	// Assert
+	if len(kept) != 2 || kept[0].Question != cards[1].Question || kept[1].Type != ankify.CARD_TYPE_CLOZE {
+		t.Errorf("Unexpected kept cards %v", kept)
+	}
+	if len(duplicates) != 2 {
+		t.Fatalf("Expected 2 duplicates, got %v", duplicates)
+	}
+	if duplicates[0].OfID != 7 || duplicates[0].Similarity != 1 {
+		t.Errorf("Expected an exact duplicate of stored card #7, got %v", duplicates[0])
+	}
+	if duplicates[1].OfID != 0 || duplicates[1].Of.Question != cards[1].Question || duplicates[1].Similarity < DEFAULT_THRESHOLD {
+		t.Errorf("Expected a near duplicate of the second card, got %v", duplicates[1])
+	}
+	if !strings.Contains(duplicates[0].String(), "stored card #7") {
+		t.Errorf("Unexpected report %q", duplicates[0])
+	}
+
+	strict := NewDeduper(1)
+	strict.Add(1, cards[1])
+	if _, ok := strict.Match(cards[2]); ok {
+		t.Error("Expected a threshold of 1 to keep near duplicates")
+	}
+}
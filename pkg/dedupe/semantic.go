@@ -0,0 +1,203 @@
+package dedupe
+
+import (
+	"context"
+	"math"
+	"strings"
+
+	"github.com/acrucetta/anki-builder/pkg/ankify"
+)
+
+// DEFAULT_SEMANTIC_THRESHOLD is the cosine similarity of card embeddings from
+// which cards mean the same thing.
+const DEFAULT_SEMANTIC_THRESHOLD = 0.9
+
+// EMBEDDING_BATCH_SIZE is the number of cards embedded per request.
+const EMBEDDING_BATCH_SIZE = 64
+
+// EmbeddingText is the text of a card sent to the embedding model: its
+// question and answer, with cloze deletions shown as their text.
+func EmbeddingText(card ankify.AnkiQuestion) string {
+	question := ankify.ClozeText(card.Question)
+	return strings.TrimSpace(question + "\n" + card.Answer)
+}
+
+// Embed returns the embedding of each card, EMBEDDING_BATCH_SIZE cards per
+// request.
+func Embed(ctx context.Context, embedder ankify.EmbeddingProvider, cards []ankify.AnkiQuestion) ([][]float64, ankify.Usage, error) {
+	vectors := [][]float64{}
+	var total ankify.Usage
+	for start := 0; start < len(cards); start += EMBEDDING_BATCH_SIZE {
+		end := start + EMBEDDING_BATCH_SIZE
+		if end > len(cards) {
+			end = len(cards)
+		}
+		texts := []string{}
+		for _, card := range cards[start:end] {
+			texts = append(texts, EmbeddingText(card))
+		}
+		batch, usage, err := embedder.Embed(ctx, texts)
+		total.PromptTokens += usage.PromptTokens
+		total.TotalTokens += usage.TotalTokens
+		if err != nil {
+			return nil, total, err
+		}
+		vectors = append(vectors, batch...)
+	}
+	return vectors, total, nil
+}
+
+// Cosine returns the cosine similarity of two vectors, or 0 if either is
+// zero or their lengths differ.
+func Cosine(a []float64, b []float64) float64 {
+	if len(a) != len(b) {
+		return 0
+	}
+	var dot, norm_a, norm_b float64
+	for i := range a {
+		dot += a[i] * b[i]
+		norm_a += a[i] * a[i]
+		norm_b += b[i] * b[i]
+	}
+	if norm_a == 0 || norm_b == 0 {
+		return 0
+	}
+	return dot / math.Sqrt(norm_a*norm_b)
+}
+
+// Cluster is a group of cards that mean the same thing.
+type Cluster struct {
+	// Members index the clustered cards in their original order, and Best
+	// is the member most similar to the others.
+	Members []int
+	Best    int
+	// Similarity is the cosine similarity of each member to Best.
+	Similarity []float64
+}
+
+// Clusters groups cards of the same type whose embeddings are at least
+// threshold similar. Each card joins the cluster whose centroid it is most
+// similar to, or starts a new one, so the result depends only on the order of
+// the cards. Every card is in exactly one cluster, most of them alone.
+func Clusters(cards []ankify.AnkiQuestion, vectors [][]float64, threshold float64) []Cluster {
+	if threshold <= 0 {
+		threshold = DEFAULT_SEMANTIC_THRESHOLD
+	}
+	clusters := []Cluster{}
+	centroids := [][]float64{}
+	for i, card := range cards {
+		best, best_similarity := -1, threshold
+		for c, cluster := range clusters {
+			if cardType(cards[cluster.Members[0]]) != cardType(card) {
+				continue
+			}
+			if similarity := Cosine(vectors[i], centroids[c]); similarity >= best_similarity {
+				best, best_similarity = c, similarity
+			}
+		}
+		if best < 0 {
+			clusters = append(clusters, Cluster{Members: []int{i}})
+			centroids = append(centroids, unit(vectors[i]))
+			continue
+		}
+		clusters[best].Members = append(clusters[best].Members, i)
+		centroid := centroids[best]
+		for d, value := range unit(vectors[i]) {
+			centroid[d] += value
+		}
+	}
+
+	for c := range clusters {
+		clusters[c].Best = medoid(clusters[c].Members, vectors)
+		for _, member := range clusters[c].Members {
+			clusters[c].Similarity = append(clusters[c].Similarity, Cosine(vectors[member], vectors[clusters[c].Best]))
+		}
+	}
+	return clusters
+}
+
+// medoid returns the member with the highest total similarity to the others,
+// the first one on ties.
+func medoid(members []int, vectors [][]float64) int {
+	best, best_total := members[0], math.Inf(-1)
+	for _, member := range members {
+		total := 0.0
+		for _, other := range members {
+			if other != member {
+				total += Cosine(vectors[member], vectors[other])
+			}
+		}
+		if total > best_total {
+			best, best_total = member, total
+		}
+	}
+	return best
+}
+
+// unit returns a copy of vector scaled to length 1, so every card weighs the
+// same in a centroid.
+func unit(vector []float64) []float64 {
+	norm := 0.0
+	for _, value := range vector {
+		norm += value * value
+	}
+	scaled := make([]float64, len(vector))
+	if norm == 0 {
+		return scaled
+	}
+	norm = math.Sqrt(norm)
+	for i, value := range vector {
+		scaled[i] = value / norm
+	}
+	return scaled
+}
+
+// SemanticFilter clusters the stored cards with the new ones and keeps one
+// card per cluster: a new card in the same cluster as a stored card is
+// dropped as a duplicate of the stored card closest to it, and of the new
+// cards alone in a cluster only the best is kept. stored_ids are the store
+// ids of the stored cards. It returns the indexes of the new cards kept, in
+// order, and the duplicates dropped.
+func SemanticFilter(stored []ankify.AnkiQuestion, stored_ids []int64, stored_vectors [][]float64, cards []ankify.AnkiQuestion, vectors [][]float64, threshold float64) ([]int, []Duplicate) {
+	all := append(append([]ankify.AnkiQuestion{}, stored...), cards...)
+	all_vectors := append(append([][]float64{}, stored_vectors...), vectors...)
+	is_stored := func(i int) bool { return i < len(stored) }
+
+	dropped := map[int]Duplicate{}
+	for _, cluster := range Clusters(all, all_vectors, threshold) {
+		keep := cluster.Best
+		for _, member := range cluster.Members {
+			if is_stored(member) && !is_stored(keep) {
+				keep = member
+			}
+		}
+		for _, member := range cluster.Members {
+			if is_stored(member) || member == keep {
+				continue
+			}
+			of := keep
+			// Report the stored card the new one is closest to
+			for _, other := range cluster.Members {
+				if is_stored(other) && Cosine(all_vectors[member], all_vectors[other]) > Cosine(all_vectors[member], all_vectors[of]) {
+					of = other
+				}
+			}
+			duplicate := Duplicate{Card: all[member], Of: all[of], Similarity: Cosine(all_vectors[member], all_vectors[of])}
+			if is_stored(of) {
+				duplicate.OfID = stored_ids[of]
+			}
+			dropped[member-len(stored)] = duplicate
+		}
+	}
+
+	kept := []int{}
+	duplicates := []Duplicate{}
+	for i := range cards {
+		if duplicate, ok := dropped[i]; ok {
+			duplicates = append(duplicates, duplicate)
+			continue
+		}
+		kept = append(kept, i)
+	}
+	return kept, duplicates
+}
@@ -0,0 +1,128 @@
+package dedupe
+
+import (
+	"context"
+	"testing"
+
+	"github.com/acrucetta/anki-builder/pkg/ankify"
+)
+
+// fakeEmbedder embeds each text as the vector given for it.
+type fakeEmbedder struct {
+	vectors map[string][]float64
+	calls   int
+}
+
+func (f *fakeEmbedder) Name() string {
+	return "fake"
+}
+
+func (f *fakeEmbedder) Complete(ctx context.Context, messages []ankify.RequestMessage) (string, ankify.Usage, error) {
+	return "", ankify.Usage{}, nil
+}
+
+func (f *fakeEmbedder) Embed(ctx context.Context, texts []string) ([][]float64, ankify.Usage, error) {
+	f.calls++
+	vectors := [][]float64{}
+	for _, text := range texts {
+		vectors = append(vectors, f.vectors[text])
+	}
+	return vectors, ankify.Usage{PromptTokens: len(texts), TotalTokens: len(texts)}, nil
+}
+
+func TestEmbed(t *testing.T) {
+
+	// Arrange
+	embedder := &fakeEmbedder{vectors: map[string][]float64{"Paris is the capital.\nSince 508.": {1, 0}}}
+	cards := []ankify.AnkiQuestion{}
+	for i := 0; i < EMBEDDING_BATCH_SIZE+1; i++ {
+		cards = append(cards, ankify.AnkiQuestion{Question: "{{c1::Paris}} is the capital.", Answer: "Since 508.", Type: ankify.CARD_TYPE_CLOZE})
+	}
+
+	// Act
+	vectors, usage, err := Embed(context.Background(), embedder, cards)
+
+	// Assert
+	if err != nil {
+		t.Fatal(err)
+	}
+	if embedder.calls != 2 || usage.TotalTokens != len(cards) {
+		t.Errorf("Expected 2 requests for %d cards, got %d and usage %+v", len(cards), embedder.calls, usage)
+	}
+	if len(vectors) != len(cards) || vectors[len(cards)-1][0] != 1 {
+		t.Errorf("Unexpected vectors %v", vectors)
+	}
+}
+
+func TestClusters(t *testing.T) {
+
+	// Arrange
+	cards := []ankify.AnkiQuestion{
+		{Question: "What is a goroutine?"},
+		{Question: "What does defer do?"},
+		{Question: "What's a goroutine in Go?"},
+		{Question: "Goroutines are lightweight threads."},
+		{Question: "{{c1::Goroutines}} are lightweight threads.", Type: ankify.CARD_TYPE_CLOZE},
+	}
+	vectors := [][]float64{
+		{1, 0.1, 0},
+		{0, 0, 1},
+		{1, 0, 0},
+		{1, 0.2, 0},
+		{1, 0.1, 0},
+	}
+
+	// Act
+	clusters := Clusters(cards, vectors, 0.95)
+
+	// Assert
+	if len(clusters) != 3 {
+		t.Fatalf("Expected 3 clusters, got %+v", clusters)
+	}
+	goroutines := clusters[0]
+	if len(goroutines.Members) != 3 || goroutines.Members[1] != 2 || goroutines.Members[2] != 3 {
+		t.Errorf("Expected cards 0, 2 and 3 together, got %+v", goroutines)
+	}
+	if goroutines.Best != 0 || goroutines.Similarity[0] != 1 || goroutines.Similarity[1] < 0.95 {
+		t.Errorf("Expected card 0 as the best, got %+v", goroutines)
+	}
+	if len(clusters[2].Members) != 1 || clusters[2].Members[0] != 4 {
+		t.Errorf("Expected the cloze card alone, got %+v", clusters[2])
+	}
+}
+
+func TestSemanticFilter(t *testing.T) {
+
+	// Arrange
+	stored := []ankify.AnkiQuestion{{Question: "What is a goroutine?"}}
+	stored_vectors := [][]float64{{1, 0, 0}}
+	cards := []ankify.AnkiQuestion{
+		{Question: "What's a goroutine in Go?"},
+		{Question: "What does defer do?"},
+		{Question: "What does the defer keyword do?"},
+		{Question: "When do deferred calls run?"},
+	}
+	vectors := [][]float64{
+		{0.98, 0.2, 0},
+		{0, 1, 0},
+		{0, 0.99, 0.1},
+		{0, 0.3, 1},
+	}
+
+	// Act
+	kept, duplicates := SemanticFilter(stored, []int64{42}, stored_vectors, cards, vectors, 0.9)
+
+	// Assert
+	if len(kept) != 2 || kept[0] != 1 || kept[1] != 3 {
+		t.Errorf("Expected cards 1 and 3 to be kept, got %v", kept)
+	}
+	if len(duplicates) != 2 {
+		t.Fatalf("Expected 2 duplicates, got %v", duplicates)
+	}
+	if duplicates[0].OfID != 42 || duplicates[0].Of.Question != stored[0].Question {
+		t.Errorf("Expected a duplicate of stored card 42, got %v", duplicates[0])
+	}
+	if duplicates[1].OfID != 0 || duplicates[1].Card.Question != cards[2].Question || duplicates[1].Similarity < 0.9 {
+		t.Errorf("Expected card 2 to duplicate card 1, got %v", duplicates[1])
+	}
+}
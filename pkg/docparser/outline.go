@@ -0,0 +1,86 @@
+package docparser
+
+import (
+	"context"
+	"encoding/xml"
+	"fmt"
+	"os/exec"
+	"sort"
+	"strings"
+)
+
+// Bookmark is an entry of a PDF outline.
+type Bookmark struct {
+	Title string
+	Level int
+	// Page is the 1-based page the bookmark points to, or 0 if unknown.
+	Page int
+}
+
+type outlineXML struct {
+	Outlines []struct {
+		Level int    `xml:"level,attr"`
+		Title string `xml:"title,attr"`
+		Page  int    `xml:"pageno"`
+	} `xml:"outline"`
+}
+
+// ParsePdfOutline returns the bookmarks of a PDF file. We are using
+// dumppdf.py, installed with pdfminer next to pdf2txt.py, to read the outline.
+// A PDF without an outline returns no bookmarks and no error.
+func ParsePdfOutline(ctx context.Context, pdf_path string) ([]Bookmark, error) {
+	cmd := exec.CommandContext(ctx, "pipenv", "run", "dumppdf.py", "-T", pdf_path)
+	out, err := cmd.Output()
+	if err != nil {
+		if exit_error, ok := err.(*exec.ExitError); ok && strings.Contains(string(exit_error.Stderr), "PDFNoOutlines") {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("reading the outline of %s: %w", pdf_path, err)
+	}
+	return parseOutlineXML(out)
+}
+
+func parseOutlineXML(data []byte) ([]Bookmark, error) {
+	var outline outlineXML
+	if err := xml.Unmarshal(data, &outline); err != nil {
+		return nil, err
+	}
+	bookmarks := make([]Bookmark, 0, len(outline.Outlines))
+	for _, entry := range outline.Outlines {
+		bookmarks = append(bookmarks, Bookmark{
+			Title: strings.TrimSpace(entry.Title),
+			Level: entry.Level,
+			Page:  entry.Page,
+		})
+	}
+	return bookmarks, nil
+}
+
+// PageSections returns, for each of the given pages, the title of the
+// deepest bookmark that starts on or before it. Pages before the first
+// bookmark are left out.
+func PageSections(bookmarks []Bookmark, pages []int) map[int]string {
+	sorted := make([]Bookmark, 0, len(bookmarks))
+	for _, bookmark := range bookmarks {
+		if bookmark.Page > 0 {
+			sorted = append(sorted, bookmark)
+		}
+	}
+	sort.SliceStable(sorted, func(i, j int) bool {
+		if sorted[i].Page != sorted[j].Page {
+			return sorted[i].Page < sorted[j].Page
+		}
+		return sorted[i].Level < sorted[j].Level
+	})
+
+	sections := make(map[int]string)
+	for _, page := range pages {
+		for _, bookmark := range sorted {
+			if bookmark.Page > page {
+				break
+			}
+			sections[page] = bookmark.Title
+		}
+	}
+	return sections
+}
@@ -0,0 +1,59 @@
+package docparser
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseOutlineXML(t *testing.T) {
+
+	// Arrange
+	const dump = `<outlines>
+<outline level="1" title="Introduction">
+<dest><list size="2"><ref id="12" /><literal>Fit</literal></list></dest>
+<pageno>1</pageno>
+</outline>
+<outline level="2" title="Programming Model &amp; Types">
+<pageno>2</pageno>
+</outline>
+<outline level="1" title="Implementation">
+<pageno>3</pageno>
+</outline>
+</outlines>`
+
+	// Act
+	bookmarks, err := parseOutlineXML([]byte(dump))
+
+	// Assert
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []Bookmark{
+		{Title: "Introduction", Level: 1, Page: 1},
+		{Title: "Programming Model & Types", Level: 2, Page: 2},
+		{Title: "Implementation", Level: 1, Page: 3},
+	}
+	if !reflect.DeepEqual(bookmarks, expected) {
+		t.Errorf("Expected %+v, got %+v", expected, bookmarks)
+	}
+}
+
+func TestPageSections(t *testing.T) {
+
+	// Arrange
+	bookmarks := []Bookmark{
+		{Title: "Implementation", Level: 1, Page: 5},
+		{Title: "Introduction", Level: 1, Page: 2},
+		{Title: "Execution Overview", Level: 2, Page: 5},
+		{Title: "No page", Level: 1, Page: 0},
+	}
+
+	// Act
+	sections := PageSections(bookmarks, []int{1, 2, 4, 5, 9})
+
+	// Assert
+	expected := map[int]string{2: "Introduction", 4: "Introduction", 5: "Execution Overview", 9: "Execution Overview"}
+	if !reflect.DeepEqual(sections, expected) {
+		t.Errorf("Expected %v, got %v", expected, sections)
+	}
+}
@@ -2,17 +2,21 @@ package docparser
 
 import (
 	"bufio"
+	"context"
 	"fmt"
-	"log"
 	"net/http"
 	"os"
 	"os/exec"
 	"strconv"
 	"strings"
+	"time"
 
 	"golang.org/x/net/html"
 )
 
+// httpClient fetches URLs; the timeout bounds each fetch on top of the caller's context.
+var httpClient = &http.Client{Timeout: 30 * time.Second}
+
 func ParseTxt(txt_path string) (map[int]string, error) {
 
 	// Load the text file
@@ -40,22 +44,14 @@ func ParseTxt(txt_path string) (map[int]string, error) {
 }
 
 // This function is used to extract the raw text from a URL.
-func ParseUrl(url string) (map[int]string, error) {
+func ParseUrl(ctx context.Context, url string) (map[int]string, error) {
 	// Ensure that the URL starts with http:// or https://
 	if !strings.HasPrefix(url, "http://") && !strings.HasPrefix(url, "https://") {
 		url = "http://" + url
 	}
 
-	// Check if the URL is valid, return loggin error if not
-	_, err := http.Get(url)
-	if err != nil {
-		log.Fatal(err)
-		return nil, err
-	}
-
-	bodyText, err := getBodyTextFromURL(url)
+	bodyText, err := getBodyTextFromURL(ctx, url)
 	if err != nil {
-		log.Fatal(err)
 		return nil, err
 	}
 
@@ -66,7 +62,7 @@ func ParseUrl(url string) (map[int]string, error) {
 }
 
 // This function is used to parse a PDF file and return the text on a specific page.
-func ParsePdfPage(pdf_path string, page_number int) (string, error) {
+func ParsePdfPage(ctx context.Context, pdf_path string, page_number int) (string, error) {
 
 	// Print current path
 	dir, _ := os.Getwd()
@@ -74,7 +70,7 @@ func ParsePdfPage(pdf_path string, page_number int) (string, error) {
 
 	// Call pdf2text.py to parse the PDF file on the given page
 	command := "pipenv run pdf2txt.py -p " + strconv.Itoa(page_number) + " " + pdf_path
-	cmd := exec.Command("bash", "-c", command)
+	cmd := exec.CommandContext(ctx, "bash", "-c", command)
 
 	// Run the command
 	out, err := cmd.Output()
@@ -90,7 +86,7 @@ func ParsePdfPage(pdf_path string, page_number int) (string, error) {
 // This function is used to parse a PDF file and return the text on a specific page.
 // We are using pdf2text.py to parse the PDF file. We will call it from the command line.
 // The function returns the text on the page as a string.
-func ParsePdf(pdf_path string, pages []int) (map[int]string, error) {
+func ParsePdf(ctx context.Context, pdf_path string, pages []int) (map[int]string, error) {
 
 	// Check the pages that were requested are valid
 	for _, page := range pages {
@@ -104,7 +100,10 @@ func ParsePdf(pdf_path string, pages []int) (map[int]string, error) {
 	var parsed_pages map[int]string = make(map[int]string)
 
 	for _, page := range pages {
-		parsed_page, err := ParsePdfPage(pdf_path, page)
+		parsed_page, err := ParsePdfPage(ctx, pdf_path, page)
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
 		if err != nil {
 			fmt.Printf("Error: %v", err)
 			return nil, err
@@ -115,28 +114,45 @@ func ParsePdf(pdf_path string, pages []int) (map[int]string, error) {
 	return parsed_pages, nil
 }
 
-func getBodyTextFromURL(url string) (string, error) {
+func getBodyTextFromURL(ctx context.Context, url string) (string, error) {
 	// Fetch the HTML document from the URL.
-	resp, err := http.Get(url)
+	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
 	if err != nil {
-		panic(err)
+		return "", err
+	}
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return "", err
 	}
 	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return "", fmt.Errorf("fetching %s: %s", url, resp.Status)
+	}
 
 	// Parse the HTML document.
 	doc, err := html.Parse(resp.Body)
 	if err != nil {
-		panic(err)
+		return "", err
 	}
 
 	// Extract the text from the content elements in the HTML document.
+	// Headings are written as Markdown headings on their own lines and
+	// paragraphs are separated by blank lines, so the chunker can follow
+	// the outline of the page.
 	var text string
 	var extractText func(*html.Node)
 	extractText = func(n *html.Node) {
 		if n.Type == html.ElementNode {
 			switch n.Data {
-			case "p", "h1", "h2", "h3", "h4", "h5", "h6", "li", "em", "ul", "ol", "pre", "td", "br",
-				"tbody":
+			case "h1", "h2", "h3", "h4", "h5", "h6":
+				level := int(n.Data[1] - '0')
+				title := strings.Join(strings.Fields(extractAllText(n)), " ")
+				if title != "" {
+					text += "\n\n" + strings.Repeat("#", level) + " " + title + "\n\n"
+				}
+			case "p":
+				text += "\n\n" + extractNodeText(n)
+			case "li", "em", "ul", "ol", "pre", "td", "br", "tbody":
 				text += " " + extractNodeText(n)
 			}
 		}
@@ -158,3 +174,15 @@ func extractNodeText(n *html.Node) string {
 	}
 	return text
 }
+
+// extractAllText returns the text of n and all its descendants, e.g. a heading wrapping a link.
+func extractAllText(n *html.Node) string {
+	if n.Type == html.TextNode {
+		return n.Data
+	}
+	var text string
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		text += extractAllText(c)
+	}
+	return text
+}
@@ -1,7 +1,10 @@
 package docparser
 
 import (
+	"context"
 	"fmt"
+	"net/http"
+	"net/http/httptest"
 	"os"
 	"testing"
 )
@@ -16,7 +19,7 @@ func TestParsePdfPage(t *testing.T) {
 	const pdfPath string = "../../data/test.pdf"
 
 	// Act
-	res, err := ParsePdfPage(pdfPath, 1)
+	res, err := ParsePdfPage(context.Background(), pdfPath, 1)
 
 	// Assert
 	if err != nil {
@@ -33,7 +36,7 @@ func TestParsePdf(t *testing.T) {
 	const pdfPath string = "../../data/test.pdf"
 
 	// Act
-	res, err := ParsePdf(pdfPath, []int{1, 2})
+	res, err := ParsePdf(context.Background(), pdfPath, []int{1, 2})
 
 	// Assert
 	if err != nil {
@@ -50,7 +53,7 @@ func TestParseUrl(t *testing.T) {
 	const url string = "https://hagakure.substack.com/p/twh45-against-overwhelm"
 
 	// Act
-	res, err := ParseUrl(url)
+	res, err := ParseUrl(context.Background(), url)
 
 	// Assert
 	if err != nil {
@@ -69,7 +72,7 @@ func TestParseUrlv2(t *testing.T) {
 	const url string = "https://hagakure.substack.com/p/twh45-against-overwhelm"
 
 	// Act
-	res, err := getBodyTextFromURL(url)
+	res, err := getBodyTextFromURL(context.Background(), url)
 
 	// Assert
 	if err != nil {
@@ -81,3 +84,29 @@ func TestParseUrlv2(t *testing.T) {
 	fmt.Println(res)
 	fmt.Print(len(res))
 }
+
+func TestParseUrlHeadings(t *testing.T) {
+
+	// Arrange
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`<html><body>
+			<h1>Against <a href="#">overwhelm</a></h1>
+			<p>First paragraph.</p>
+			<h2>Why it happens</h2>
+			<p>Second paragraph.</p>
+		</body></html>`))
+	}))
+	defer server.Close()
+
+	// Act
+	res, err := ParseUrl(context.Background(), server.URL)
+
+	// Assert
+	if err != nil {
+		t.Fatal(err)
+	}
+	const expected = "\n\n# Against overwhelm\n\n\n\nFirst paragraph.\n\n## Why it happens\n\n\n\nSecond paragraph."
+	if res[1] != expected {
+		t.Errorf("Expected %q, got %q", expected, res[1])
+	}
+}
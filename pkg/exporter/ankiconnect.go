@@ -0,0 +1,288 @@
+package exporter
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"html"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/acrucetta/anki-builder/pkg/ankify"
+)
+
+// DEFAULT_ANKICONNECT_URL is where the AnkiConnect add-on listens by default.
+const DEFAULT_ANKICONNECT_URL = "http://127.0.0.1:8765"
+
+// ANKICONNECT_VERSION is the version of the AnkiConnect API the requests follow.
+const ANKICONNECT_VERSION = 6
+
+// Anki's built-in note types, used when AnkiConnect.NoteType is empty.
+const (
+	DEFAULT_BASIC_NOTE_TYPE = "Basic"
+	DEFAULT_CLOZE_NOTE_TYPE = "Cloze"
+)
+
+// AnkiConnect adds cards to a running Anki through the AnkiConnect add-on.
+type AnkiConnect struct {
+	URL string
+	// Key is the add-on's optional API key.
+	Key    string
+	Client *http.Client
+	// Deck receives the cards; it is created if missing.
+	Deck string
+	// NoteType is the note type of every card. When empty, cloze cards use
+	// "Cloze" and the others "Basic". The card's front goes in the first
+	// field of the note type and its back in the second, and its source in
+	// a field named "Source" if there is one.
+	NoteType string
+}
+
+// NewAnkiConnect returns an AnkiConnect for the deck, using ANKICONNECT_URL
+// and ANKICONNECT_KEY if they are set.
+func NewAnkiConnect(deck string) *AnkiConnect {
+	url := os.Getenv("ANKICONNECT_URL")
+	if url == "" {
+		url = DEFAULT_ANKICONNECT_URL
+	}
+	return &AnkiConnect{
+		URL:    url,
+		Key:    os.Getenv("ANKICONNECT_KEY"),
+		Client: &http.Client{Timeout: 30 * time.Second},
+		Deck:   deck,
+	}
+}
+
+// AnkiNote is a note in the form AnkiConnect's addNotes and canAddNotes take.
+type AnkiNote struct {
+	DeckName  string            `json:"deckName"`
+	ModelName string            `json:"modelName"`
+	Fields    map[string]string `json:"fields"`
+	Tags      []string          `json:"tags"`
+	Options   AnkiNoteOptions   `json:"options"`
+}
+
+type AnkiNoteOptions struct {
+	AllowDuplicate bool   `json:"allowDuplicate"`
+	DuplicateScope string `json:"duplicateScope"`
+}
+
+// PushResult reports what Push did with each card.
+type PushResult struct {
+	// Added holds the Anki note ids of the cards that were added.
+	Added []int64
+	// Indexes holds the positions of the added cards among those pushed, in
+	// the order of Added.
+	Indexes []int
+	// Duplicates are the cards Anki already has, which were skipped.
+	Duplicates []ankify.AnkiQuestion
+	// Failed are the cards Anki refused to add for another reason.
+	Failed []ankify.AnkiQuestion
+}
+
+type ankiConnectRequest struct {
+	Action  string      `json:"action"`
+	Version int         `json:"version"`
+	Key     string      `json:"key,omitempty"`
+	Params  interface{} `json:"params,omitempty"`
+}
+
+type ankiConnectResponse struct {
+	Result json.RawMessage `json:"result"`
+	Error  *string         `json:"error"`
+}
+
+// Invoke calls an AnkiConnect action and decodes its result into result.
+func (a *AnkiConnect) Invoke(ctx context.Context, action string, params interface{}, result interface{}) error {
+	json_data, err := json.Marshal(ankiConnectRequest{
+		Action:  action,
+		Version: ANKICONNECT_VERSION,
+		Key:     a.Key,
+		Params:  params,
+	})
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "POST", a.URL, bytes.NewBuffer(json_data))
+	if err != nil {
+		return err
+	}
+	req.Header.Add("Content-Type", "application/json")
+
+	resp, err := a.Client.Do(req)
+	if err != nil {
+		return fmt.Errorf("calling AnkiConnect at %s, is Anki running with the add-on installed? %w", a.URL, err)
+	}
+	defer resp.Body.Close()
+
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("AnkiConnect %s returned %s: %s", action, resp.Status, body)
+	}
+
+	var response ankiConnectResponse
+	if err := json.Unmarshal(body, &response); err != nil {
+		return fmt.Errorf("decoding AnkiConnect %s response: %w", action, err)
+	}
+	if response.Error != nil {
+		return fmt.Errorf("AnkiConnect %s: %s", action, *response.Error)
+	}
+	if result == nil || len(response.Result) == 0 {
+		return nil
+	}
+	return json.Unmarshal(response.Result, result)
+}
+
+func (a *AnkiConnect) Name() string {
+	return "ankiconnect"
+}
+
+func (a *AnkiConnect) Extension() string {
+	return ""
+}
+
+// Export pushes the cards to the deck and note type of options, if set, and
+// logs how many were added.
+func (a *AnkiConnect) Export(ctx context.Context, cards []ankify.AnkiQuestion, options Options) error {
+	_, err := a.ExportSome(ctx, cards, options)
+	return err
+}
+
+// ExportSome exports like Export and returns the indexes of the cards Anki
+// added, leaving out duplicates and failures.
+func (a *AnkiConnect) ExportSome(ctx context.Context, cards []ankify.AnkiQuestion, options Options) ([]int, error) {
+	if options.Deck != "" {
+		a.Deck = options.Deck
+	}
+	if options.NoteType != "" {
+		a.NoteType = options.NoteType
+	}
+	result, err := a.Push(ctx, cards)
+	if err != nil {
+		return nil, err
+	}
+	log.Printf("Added %d cards to the %q deck, skipped %d duplicates, %d failed.", len(result.Added), a.Deck, len(result.Duplicates), len(result.Failed))
+	return result.Indexes, nil
+}
+
+// Push creates the deck if needed and adds the cards Anki does not have yet.
+// Cards Anki reports as duplicates within the deck are skipped.
+func (a *AnkiConnect) Push(ctx context.Context, cards []ankify.AnkiQuestion) (PushResult, error) {
+	result := PushResult{}
+	if len(cards) == 0 {
+		return result, nil
+	}
+	deck := a.Deck
+	if deck == "" {
+		deck = DEFAULT_DECK_NAME
+	}
+	if err := a.Invoke(ctx, "createDeck", map[string]string{"deck": deck}, nil); err != nil {
+		return result, err
+	}
+
+	notes := []AnkiNote{}
+	fields := map[string][]string{}
+	for _, card := range cards {
+		note_type := a.noteType(card)
+		if _, ok := fields[note_type]; !ok {
+			var names []string
+			if err := a.Invoke(ctx, "modelFieldNames", map[string]string{"modelName": note_type}, &names); err != nil {
+				return result, err
+			}
+			if len(names) == 0 {
+				return result, fmt.Errorf("note type %q not found in Anki", note_type)
+			}
+			fields[note_type] = names
+		}
+		notes = append(notes, newAnkiNote(card, deck, note_type, fields[note_type]))
+	}
+
+	// Ask Anki which notes it would accept, so duplicates are not sent
+	var can_add []bool
+	if err := a.Invoke(ctx, "canAddNotes", map[string]interface{}{"notes": notes}, &can_add); err != nil {
+		return result, err
+	}
+	if len(can_add) != len(notes) {
+		return result, fmt.Errorf("AnkiConnect canAddNotes answered for %d of %d notes", len(can_add), len(notes))
+	}
+	to_add := []AnkiNote{}
+	to_add_indexes := []int{}
+	for i, ok := range can_add {
+		if !ok {
+			result.Duplicates = append(result.Duplicates, cards[i])
+			continue
+		}
+		to_add = append(to_add, notes[i])
+		to_add_indexes = append(to_add_indexes, i)
+	}
+	if len(to_add) == 0 {
+		return result, nil
+	}
+
+	var ids []*int64
+	if err := a.Invoke(ctx, "addNotes", map[string]interface{}{"notes": to_add}, &ids); err != nil {
+		return result, err
+	}
+	if len(ids) != len(to_add) {
+		return result, fmt.Errorf("AnkiConnect addNotes answered for %d of %d notes", len(ids), len(to_add))
+	}
+	for i, id := range ids {
+		card := cards[to_add_indexes[i]]
+		if id == nil {
+			log.Printf("Anki did not add the card %q.", card.Question)
+			result.Failed = append(result.Failed, card)
+			continue
+		}
+		result.Added = append(result.Added, *id)
+		result.Indexes = append(result.Indexes, to_add_indexes[i])
+	}
+	return result, nil
+}
+
+func (a *AnkiConnect) noteType(card ankify.AnkiQuestion) string {
+	if a.NoteType != "" {
+		return a.NoteType
+	}
+	if card.Type == ankify.CARD_TYPE_CLOZE {
+		return DEFAULT_CLOZE_NOTE_TYPE
+	}
+	return DEFAULT_BASIC_NOTE_TYPE
+}
+
+// newAnkiNote fills the first two fields of the note type with the card's
+// front and back, and a "Source" field with where the card came from.
+func newAnkiNote(card ankify.AnkiQuestion, deck string, note_type string, field_names []string) AnkiNote {
+	front, back := toHTML(card.Question), toHTML(card.Answer)
+	if card.Type == ankify.CARD_TYPE_MULTIPLE_CHOICE {
+		front, back = ankify.ChoiceHTML(card)
+	}
+
+	fields := map[string]string{field_names[0]: front}
+	if len(field_names) > 1 {
+		fields[field_names[1]] = back
+	}
+	for i, name := range field_names {
+		if i >= 2 && strings.EqualFold(name, "Source") {
+			fields[name] = html.EscapeString(sourceLabel(card.Source))
+		}
+	}
+	return AnkiNote{
+		DeckName:  deck,
+		ModelName: note_type,
+		Fields:    fields,
+		Tags:      append([]string{}, strings.Fields(card.Tag)...),
+		Options: AnkiNoteOptions{
+			AllowDuplicate: false,
+			DuplicateScope: "deck",
+		},
+	}
+}
@@ -0,0 +1,200 @@
+package exporter
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/acrucetta/anki-builder/pkg/ankify"
+)
+
+// fakeAnki stands in for Anki with the AnkiConnect add-on, holding one
+// existing note whose first field is "What is Go?".
+// Notes whose front is "Rejected" are not added, and short drops the last
+// id of the addNotes answer.
+type fakeAnki struct {
+	decks   []string
+	added   []AnkiNote
+	actions []string
+	key     string
+	short   bool
+}
+
+func (f *fakeAnki) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	var request struct {
+		Action  string          `json:"action"`
+		Version int             `json:"version"`
+		Key     string          `json:"key"`
+		Params  json.RawMessage `json:"params"`
+	}
+	json.NewDecoder(r.Body).Decode(&request)
+	f.actions = append(f.actions, request.Action)
+	f.key = request.Key
+
+	var result interface{}
+	switch request.Action {
+	case "createDeck":
+		var params struct{ Deck string }
+		json.Unmarshal(request.Params, &params)
+		f.decks = append(f.decks, params.Deck)
+		result = 1
+	case "modelFieldNames":
+		var params struct{ ModelName string }
+		json.Unmarshal(request.Params, &params)
+		switch params.ModelName {
+		case "Basic":
+			result = []string{"Front", "Back"}
+		case "Cloze":
+			result = []string{"Text", "Back Extra", "Source"}
+		default:
+			w.Write([]byte(`{"result":null,"error":"model was not found: ` + params.ModelName + `"}`))
+			return
+		}
+	case "canAddNotes":
+		var params struct{ Notes []AnkiNote }
+		json.Unmarshal(request.Params, &params)
+		can_add := []bool{}
+		for _, note := range params.Notes {
+			can_add = append(can_add, note.Fields["Front"] != "What is Go?")
+		}
+		result = can_add
+	case "addNotes":
+		var params struct{ Notes []AnkiNote }
+		json.Unmarshal(request.Params, &params)
+		ids := []interface{}{}
+		for i, note := range params.Notes {
+			if note.Fields["Front"] == "Rejected" {
+				ids = append(ids, nil)
+				continue
+			}
+			f.added = append(f.added, note)
+			ids = append(ids, 1000+i)
+		}
+		if f.short {
+			ids = ids[:len(ids)-1]
+		}
+		result = ids
+	default:
+		w.Write([]byte(`{"result":null,"error":"unsupported action"}`))
+		return
+	}
+	json.NewEncoder(w).Encode(map[string]interface{}{"result": result, "error": nil})
+}
+
+func TestAnkiConnectPush(t *testing.T) {
+
+	// Arrange
+	anki := &fakeAnki{}
+	server := httptest.NewServer(anki)
+	defer server.Close()
+
+	connect := NewAnkiConnect("Books::Go")
+	connect.URL = server.URL
+	connect.Key = "secret"
+	cards := []ankify.AnkiQuestion{
+		{Question: "What is Go?", Answer: "A language"},
+		{Question: "Who wrote Go?", Answer: "Griesemer, Pike & Thompson", Tag: "go history"},
+		{Question: "{{c1::Go}} has goroutines.", Type: ankify.CARD_TYPE_CLOZE, Source: ankify.Source{Document: "go.pdf", Page: 4}},
+	}
+
+	// Act
+	result, err := connect.Push(context.Background(), cards)
+
+	// Assert
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(result.Added) != 2 || len(result.Duplicates) != 1 || result.Duplicates[0].Question != "What is Go?" || fmt.Sprint(result.Indexes) != "[1 2]" {
+		t.Errorf("Expected 2 added and 1 duplicate, got %+v", result)
+	}
+	if len(anki.decks) != 1 || anki.decks[0] != "Books::Go" || anki.key != "secret" {
+		t.Errorf("Expected the Books::Go deck to be created with the key, got %v", anki.decks)
+	}
+	if len(anki.added) != 2 {
+		t.Fatalf("Expected 2 notes sent to addNotes, got %d", len(anki.added))
+	}
+	basic := anki.added[0]
+	if basic.ModelName != "Basic" || basic.DeckName != "Books::Go" || basic.Fields["Back"] != "Griesemer, Pike &amp; Thompson" || strings.Join(basic.Tags, ",") != "go,history" {
+		t.Errorf("Unexpected basic note: %+v", basic)
+	}
+	if basic.Options.AllowDuplicate || basic.Options.DuplicateScope != "deck" {
+		t.Errorf("Expected duplicates to be refused within the deck, got %+v", basic.Options)
+	}
+	cloze := anki.added[1]
+	if cloze.ModelName != "Cloze" || cloze.Fields["Text"] != "{{c1::Go}} has goroutines." || cloze.Fields["Source"] != "go.pdf, page 4" {
+		t.Errorf("Unexpected cloze note: %+v", cloze)
+	}
+}
+
+func TestAnkiConnectExportSome(t *testing.T) {
+
+	// Arrange
+	anki := &fakeAnki{}
+	server := httptest.NewServer(anki)
+	defer server.Close()
+
+	connect := NewAnkiConnect("Books")
+	connect.URL = server.URL
+	cards := []ankify.AnkiQuestion{
+		{Question: "What is Go?", Answer: "A language"},
+		{Question: "Rejected", Answer: "No"},
+		{Question: "Who wrote Go?", Answer: "Pike"},
+	}
+
+	// Act
+	exported, err := connect.ExportSome(context.Background(), cards, Options{})
+
+	// Assert
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(exported) != 1 || exported[0] != 2 {
+		t.Errorf("Expected only the third card to be exported, got %v", exported)
+	}
+}
+
+func TestAnkiConnectShortAddNotesAnswer(t *testing.T) {
+
+	// Arrange
+	anki := &fakeAnki{short: true}
+	server := httptest.NewServer(anki)
+	defer server.Close()
+
+	connect := NewAnkiConnect("Books")
+	connect.URL = server.URL
+
+	// Act
+	_, err := connect.Push(context.Background(), []ankify.AnkiQuestion{{Question: "Q1", Answer: "A"}, {Question: "Q2", Answer: "A"}})
+
+	// Assert
+	if err == nil || !strings.Contains(err.Error(), "addNotes answered for 1 of 2 notes") {
+		t.Errorf("Expected a short answer error, got %v", err)
+	}
+}
+
+func TestAnkiConnectUnknownNoteType(t *testing.T) {
+
+	// Arrange
+	anki := &fakeAnki{}
+	server := httptest.NewServer(anki)
+	defer server.Close()
+
+	connect := NewAnkiConnect("Books")
+	connect.URL = server.URL
+	connect.NoteType = "Missing"
+
+	// Act
+	_, err := connect.Push(context.Background(), []ankify.AnkiQuestion{{Question: "Q", Answer: "A"}})
+
+	// Assert
+	if err == nil || !strings.Contains(err.Error(), "model was not found") {
+		t.Errorf("Expected a model not found error, got %v", err)
+	}
+	if len(anki.added) != 0 {
+		t.Errorf("Expected no notes to be added, got %+v", anki.added)
+	}
+}
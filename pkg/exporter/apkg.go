@@ -0,0 +1,426 @@
+package exporter
+
+import (
+	"archive/zip"
+	"context"
+	"crypto/sha1"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"html"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/acrucetta/anki-builder/pkg/ankify"
+	_ "github.com/mattn/go-sqlite3"
+)
+
+// Note type ids are fixed so notes exported by different runs share their
+// note type in Anki instead of creating "Ankify Basic-1a2b3" copies.
+const (
+	BASIC_MODEL_ID = 1691425900001
+	CLOZE_MODEL_ID = 1691425900002
+)
+
+const (
+	BASIC_MODEL_NAME = "Ankify Basic"
+	CLOZE_MODEL_NAME = "Ankify Cloze"
+)
+
+// DEFAULT_DECK_NAME is used when no deck name is given.
+const DEFAULT_DECK_NAME = "Ankify"
+
+const APKG_CSS = `.card {
+  font-family: arial;
+  font-size: 20px;
+  text-align: center;
+  color: black;
+  background-color: white;
+}
+.cloze {
+  font-weight: bold;
+  color: blue;
+}
+.source {
+  font-size: 12px;
+  color: grey;
+}
+`
+
+// apkgSchema is the schema of an Anki 2.1 collection (version 11), which
+// every Anki release since 2.1 imports.
+const apkgSchema = `
+CREATE TABLE col (id integer primary key, crt integer not null, mod integer not null, scm integer not null, ver integer not null, dty integer not null, usn integer not null, ls integer not null, conf text not null, models text not null, decks text not null, dconf text not null, tags text not null);
+CREATE TABLE notes (id integer primary key, guid text not null, mid integer not null, mod integer not null, usn integer not null, tags text not null, flds text not null, sfld integer not null, csum integer not null, flags integer not null, data text not null);
+CREATE TABLE cards (id integer primary key, nid integer not null, did integer not null, ord integer not null, mod integer not null, usn integer not null, type integer not null, queue integer not null, due integer not null, ivl integer not null, factor integer not null, reps integer not null, lapses integer not null, left integer not null, odue integer not null, odid integer not null, flags integer not null, data text not null);
+CREATE TABLE revlog (id integer primary key, cid integer not null, usn integer not null, ease integer not null, ivl integer not null, lastIvl integer not null, factor integer not null, time integer not null, type integer not null);
+CREATE TABLE graves (usn integer not null, oid integer not null, type integer not null);
+CREATE INDEX ix_notes_usn on notes (usn);
+CREATE INDEX ix_cards_usn on cards (usn);
+CREATE INDEX ix_revlog_usn on revlog (usn);
+CREATE INDEX ix_cards_nid on cards (nid);
+CREATE INDEX ix_cards_sched on cards (did, queue, due);
+CREATE INDEX ix_revlog_cid on revlog (cid);
+CREATE INDEX ix_notes_csum on notes (csum);
+`
+
+// ApkgExporter writes cards to an Anki package with WriteApkg.
+type ApkgExporter struct{}
+
+func (e *ApkgExporter) Name() string {
+	return "apkg"
+}
+
+func (e *ApkgExporter) Extension() string {
+	return ".apkg"
+}
+
+func (e *ApkgExporter) Export(ctx context.Context, cards []ankify.AnkiQuestion, options Options) error {
+	return WriteApkg(options.Path, options.Deck, cards)
+}
+
+// WriteApkg writes the cards to path as an Anki package holding a single
+// deck, which Anki imports when the file is opened. Basic and multiple-choice
+// cards use the "Ankify Basic" note type and cloze cards "Ankify Cloze". Note
+// GUIDs are derived from the note type and front of each card, so importing
+// the package of a later run updates the notes instead of duplicating them;
+// see noteGUIDs for cards sharing a front.
+func WriteApkg(path string, deck_name string, cards []ankify.AnkiQuestion) error {
+	dir, err := os.MkdirTemp("", "ankify-apkg")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(dir)
+
+	collection := filepath.Join(dir, "collection.anki2")
+	if err := writeCollection(collection, deck_name, cards, time.Now()); err != nil {
+		return fmt.Errorf("writing collection: %w", err)
+	}
+	return zipPackage(path, collection)
+}
+
+func writeCollection(path string, deck_name string, cards []ankify.AnkiQuestion, now time.Time) error {
+	if deck_name == "" {
+		deck_name = DEFAULT_DECK_NAME
+	}
+	deck_id := DeckID(deck_name)
+
+	db, err := sql.Open("sqlite3", path)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec(apkgSchema); err != nil {
+		return err
+	}
+
+	conf, models, decks, dconf, err := collectionJSON(deck_id, deck_name, now)
+	if err != nil {
+		return err
+	}
+	_, err = tx.Exec(`INSERT INTO col VALUES (1, ?, ?, ?, 11, 0, 0, 0, ?, ?, ?, ?, '{}')`,
+		now.Unix(), now.UnixMilli(), now.UnixMilli(), conf, models, decks, dconf)
+	if err != nil {
+		return err
+	}
+
+	// Note and card ids are creation times in milliseconds, one apart
+	base_id := now.UnixMilli()
+	card_id := base_id
+	guids := noteGUIDs(cards)
+	for i, card := range cards {
+		note := newApkgNote(card)
+		note_id := base_id + int64(i)
+		_, err := tx.Exec(`INSERT INTO notes VALUES (?, ?, ?, ?, -1, ?, ?, ?, ?, 0, '')`,
+			note_id, guids[i], note.model_id, now.Unix(), note.tags, strings.Join(note.fields, "\x1f"), note.sort_field, note.checksum)
+		if err != nil {
+			return err
+		}
+		for _, ord := range note.ords {
+			// New cards are shown in the order of their "due" position
+			_, err := tx.Exec(`INSERT INTO cards VALUES (?, ?, ?, ?, ?, -1, 0, 0, ?, 0, 0, 0, 0, 0, 0, 0, 0, '')`,
+				card_id, note_id, deck_id, ord, now.Unix(), i+1)
+			if err != nil {
+				return err
+			}
+			card_id++
+		}
+	}
+	return tx.Commit()
+}
+
+type apkgNote struct {
+	guid       string
+	model_id   int64
+	fields     []string
+	sort_field string
+	checksum   int64
+	tags       string
+	ords       []int
+}
+
+func newApkgNote(card ankify.AnkiQuestion) apkgNote {
+	note := apkgNote{model_id: BASIC_MODEL_ID, ords: []int{0}}
+	source := html.EscapeString(sourceLabel(card.Source))
+	switch card.Type {
+	case ankify.CARD_TYPE_CLOZE:
+		note.model_id = CLOZE_MODEL_ID
+		note.fields = []string{toHTML(card.Question), toHTML(card.Answer), source}
+		note.ords = []int{}
+		for _, number := range ankify.ClozeNumbers(card.Question) {
+			note.ords = append(note.ords, number-1)
+		}
+	case ankify.CARD_TYPE_MULTIPLE_CHOICE:
+		front, back := ankify.ChoiceHTML(card)
+		note.fields = []string{front, back, source}
+	default:
+		note.fields = []string{toHTML(card.Question), toHTML(card.Answer), source}
+	}
+
+	note.guid = NoteGUID(note.model_id, card.Question)
+	note.sort_field = stripHTML(note.fields[0])
+	hash := sha1.Sum([]byte(note.sort_field))
+	note.checksum, _ = strconv.ParseInt(hex.EncodeToString(hash[:4]), 16, 64)
+	if tags := strings.Fields(card.Tag); len(tags) > 0 {
+		note.tags = " " + strings.Join(tags, " ") + " "
+	}
+	return note
+}
+
+// sourceLabel describes where a card came from, e.g. "paper.pdf, page 3, Introduction".
+func sourceLabel(source ankify.Source) string {
+	parts := []string{}
+	if source.Document != "" {
+		parts = append(parts, source.Document)
+	}
+	if source.Page > 0 {
+		parts = append(parts, fmt.Sprintf("page %d", source.Page))
+	}
+	if source.Section != "" {
+		parts = append(parts, source.Section)
+	}
+	return strings.Join(parts, ", ")
+}
+
+// sourceComment is sourceLabel as the text of an XML comment, which may
+// neither contain "--" nor end with "-", or "" for a card without a source.
+func sourceComment(source ankify.Source) string {
+	label := sourceLabel(source)
+	if label == "" {
+		return ""
+	}
+	for strings.Contains(label, "--") {
+		label = strings.ReplaceAll(label, "--", "- -")
+	}
+	return " Source: " + label + " "
+}
+
+// toHTML escapes plain text for an Anki field, which holds HTML.
+func toHTML(text string) string {
+	return strings.ReplaceAll(html.EscapeString(text), "\n", "<br>")
+}
+
+var htmlTag = regexp.MustCompile(`<[^>]*>`)
+
+// stripHTML returns the text of a field, as Anki stores in the sort field.
+func stripHTML(field string) string {
+	return strings.TrimSpace(html.UnescapeString(htmlTag.ReplaceAllString(field, " ")))
+}
+
+// noteGUIDs returns the GUID of each card's note. A card whose front repeats
+// an earlier card's gets a GUID from its front and back instead, so Anki
+// imports both rather than merging them.
+func noteGUIDs(cards []ankify.AnkiQuestion) []string {
+	guids := make([]string, len(cards))
+	seen := make(map[string]bool)
+	for i, card := range cards {
+		note := newApkgNote(card)
+		guid := note.guid
+		if seen[guid] {
+			guid = NoteGUID(note.model_id, card.Question+"\x1f"+card.Answer)
+		}
+		for n := 2; seen[guid]; n++ {
+			guid = NoteGUID(note.model_id, fmt.Sprintf("%s\x1f%s\x1f%d", card.Question, card.Answer, n))
+		}
+		seen[guid] = true
+		guids[i] = guid
+	}
+	return guids
+}
+
+// NoteGUID returns a stable GUID for a note, in the base91 form Anki uses.
+func NoteGUID(model_id int64, front string) string {
+	hash := sha256.Sum256([]byte(strconv.FormatInt(model_id, 10) + "\x1f" + front))
+	return base91(binary.BigEndian.Uint64(hash[:8]))
+}
+
+const base91Table = "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789!#$%&()*+,-./:;<=>?@[]^_`{|}~"
+
+func base91(value uint64) string {
+	if value == 0 {
+		return string(base91Table[0])
+	}
+	digits := []byte{}
+	for value > 0 {
+		digits = append([]byte{base91Table[value%91]}, digits...)
+		value /= 91
+	}
+	return string(digits)
+}
+
+// DeckID returns a stable id for a deck name, so every export of the same
+// deck lands in the same Anki deck.
+func DeckID(name string) int64 {
+	hash := sha256.Sum256([]byte(name))
+	return int64(binary.BigEndian.Uint32(hash[:4])>>1) + 1<<31
+}
+
+func collectionJSON(deck_id int64, deck_name string, now time.Time) (string, string, string, string, error) {
+	conf := map[string]interface{}{
+		"activeDecks":   []int64{deck_id},
+		"addToCur":      true,
+		"collapseTime":  1200,
+		"curDeck":       deck_id,
+		"curModel":      strconv.Itoa(BASIC_MODEL_ID),
+		"dueCounts":     true,
+		"estTimes":      true,
+		"newBury":       true,
+		"newSpread":     0,
+		"nextPos":       1,
+		"sortBackwards": false,
+		"sortType":      "noteFld",
+		"timeLim":       0,
+	}
+	models := map[string]interface{}{
+		strconv.Itoa(BASIC_MODEL_ID): model(BASIC_MODEL_ID, BASIC_MODEL_NAME, 0, deck_id, now,
+			[]string{"Front", "Back", "Source"},
+			"{{Front}}",
+			`{{FrontSide}}<hr id=answer>{{Back}}{{#Source}}<div class=source>{{Source}}</div>{{/Source}}`),
+		strconv.Itoa(CLOZE_MODEL_ID): model(CLOZE_MODEL_ID, CLOZE_MODEL_NAME, 1, deck_id, now,
+			[]string{"Text", "Back Extra", "Source"},
+			"{{cloze:Text}}",
+			`{{cloze:Text}}<br>{{Back Extra}}{{#Source}}<div class=source>{{Source}}</div>{{/Source}}`),
+	}
+	decks := map[string]interface{}{
+		"1":                            deck(1, "Default", now),
+		strconv.FormatInt(deck_id, 10): deck(deck_id, deck_name, now),
+	}
+	dconf := map[string]interface{}{
+		"1": map[string]interface{}{
+			"id": 1, "name": "Default", "mod": 0, "usn": 0,
+			"maxTaken": 60, "autoplay": true, "timer": 0, "replayq": true, "dyn": false,
+			"new": map[string]interface{}{
+				"bury": true, "delays": []int{1, 10}, "initialFactor": 2500,
+				"ints": []int{1, 4, 7}, "order": 1, "perDay": 20, "separate": true,
+			},
+			"rev": map[string]interface{}{
+				"bury": true, "ease4": 1.3, "fuzz": 0.05, "ivlFct": 1,
+				"maxIvl": 36500, "minSpace": 1, "perDay": 200,
+			},
+			"lapse": map[string]interface{}{
+				"delays": []int{10}, "leechAction": 0, "leechFails": 8, "minInt": 1, "mult": 0,
+			},
+		},
+	}
+
+	values := []string{}
+	for _, value := range []interface{}{conf, models, decks, dconf} {
+		data, err := json.Marshal(value)
+		if err != nil {
+			return "", "", "", "", err
+		}
+		values = append(values, string(data))
+	}
+	return values[0], values[1], values[2], values[3], nil
+}
+
+func model(id int64, name string, model_type int, deck_id int64, now time.Time, field_names []string, qfmt string, afmt string) map[string]interface{} {
+	fields := []map[string]interface{}{}
+	for i, field := range field_names {
+		fields = append(fields, map[string]interface{}{
+			"name": field, "ord": i, "sticky": false, "rtl": false,
+			"font": "Arial", "size": 20, "media": []string{},
+		})
+	}
+	return map[string]interface{}{
+		"id":    id,
+		"name":  name,
+		"type":  model_type,
+		"mod":   now.Unix(),
+		"usn":   -1,
+		"sortf": 0,
+		"did":   deck_id,
+		"tmpls": []map[string]interface{}{{
+			"name": "Card 1", "ord": 0, "qfmt": qfmt, "afmt": afmt,
+			"did": nil, "bqfmt": "", "bafmt": "",
+		}},
+		"flds":      fields,
+		"css":       APKG_CSS,
+		"latexPre":  "\\documentclass[12pt]{article}\n\\special{papersize=3in,5in}\n\\usepackage[utf8]{inputenc}\n\\usepackage{amssymb,amsmath}\n\\pagestyle{empty}\n\\setlength{\\parindent}{0in}\n\\begin{document}\n",
+		"latexPost": "\\end{document}",
+		"latexsvg":  false,
+		"tags":      []string{},
+		"vers":      []int{},
+		"req":       []interface{}{[]interface{}{0, "any", []int{0}}},
+	}
+}
+
+func deck(id int64, name string, now time.Time) map[string]interface{} {
+	return map[string]interface{}{
+		"id": id, "name": name, "desc": "", "mod": now.Unix(), "usn": -1,
+		"collapsed": false, "browserCollapsed": false, "conf": 1, "dyn": 0,
+		"extendNew": 10, "extendRev": 50,
+		"newToday": []int{0, 0}, "revToday": []int{0, 0},
+		"lrnToday": []int{0, 0}, "timeToday": []int{0, 0},
+	}
+}
+
+// zipPackage writes the collection and an empty media map to an .apkg file.
+func zipPackage(path string, collection string) error {
+	file, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	archive := zip.NewWriter(file)
+	writer, err := archive.Create("collection.anki2")
+	if err != nil {
+		return err
+	}
+	data, err := os.Open(collection)
+	if err != nil {
+		return err
+	}
+	defer data.Close()
+	if _, err := io.Copy(writer, data); err != nil {
+		return err
+	}
+
+	media, err := archive.Create("media")
+	if err != nil {
+		return err
+	}
+	if _, err := media.Write([]byte("{}")); err != nil {
+		return err
+	}
+	if err := archive.Close(); err != nil {
+		return err
+	}
+	return file.Close()
+}
@@ -0,0 +1,152 @@
+package exporter
+
+import (
+	"archive/zip"
+	"database/sql"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/acrucetta/anki-builder/pkg/ankify"
+)
+
+// openApkg extracts the collection of an .apkg file and opens it.
+func openApkg(t *testing.T, path string) *sql.DB {
+	t.Helper()
+	archive, err := zip.OpenReader(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer archive.Close()
+
+	names := []string{}
+	collection := filepath.Join(t.TempDir(), "collection.anki2")
+	for _, file := range archive.File {
+		names = append(names, file.Name)
+		if file.Name != "collection.anki2" {
+			continue
+		}
+		reader, err := file.Open()
+		if err != nil {
+			t.Fatal(err)
+		}
+		data, _ := io.ReadAll(reader)
+		reader.Close()
+		os.WriteFile(collection, data, 0644)
+	}
+	if strings.Join(names, ",") != "collection.anki2,media" {
+		t.Fatalf("Unexpected package files: %v", names)
+	}
+
+	db, err := sql.Open("sqlite3", collection)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+	return db
+}
+
+func TestWriteApkg(t *testing.T) {
+
+	// Arrange
+	cards := []ankify.AnkiQuestion{
+		{Question: "What is <Go>?", Answer: "A language\nby Google", Tag: "go programming", Source: ankify.Source{Document: "go.pdf", Page: 2}},
+		{Question: "{{c1::Paris}} is the capital of {{c2::France}}.", Answer: "Since 508 AD.", Type: ankify.CARD_TYPE_CLOZE},
+	}
+	path := filepath.Join(t.TempDir(), "deck.apkg")
+
+	// Act
+	err := WriteApkg(path, "Books::Go", cards)
+
+	// Assert
+	if err != nil {
+		t.Fatal(err)
+	}
+	db := openApkg(t, path)
+
+	var models, decks string
+	if err := db.QueryRow("SELECT models, decks FROM col").Scan(&models, &decks); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(models, `"name":"Ankify Basic"`) || !strings.Contains(models, `"name":"Ankify Cloze"`) {
+		t.Errorf("Expected both note types, got %s", models)
+	}
+	if !strings.Contains(decks, `"name":"Books::Go"`) {
+		t.Errorf("Expected the Books::Go deck, got %s", decks)
+	}
+
+	rows, err := db.Query("SELECT mid, flds, sfld, tags, guid FROM notes ORDER BY id")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rows.Close()
+	type note struct {
+		model_id                 int64
+		fields, sort, tags, guid string
+	}
+	notes := []note{}
+	for rows.Next() {
+		var n note
+		rows.Scan(&n.model_id, &n.fields, &n.sort, &n.tags, &n.guid)
+		notes = append(notes, n)
+	}
+	if len(notes) != 2 {
+		t.Fatalf("Expected 2 notes, got %d", len(notes))
+	}
+	if notes[0].model_id != BASIC_MODEL_ID || notes[0].fields != "What is &lt;Go&gt;?\x1fA language<br>by Google\x1fgo.pdf, page 2" {
+		t.Errorf("Unexpected basic note: %+v", notes[0])
+	}
+	if notes[0].sort != "What is <Go>?" || notes[0].tags != " go programming " {
+		t.Errorf("Unexpected sort field or tags: %+v", notes[0])
+	}
+	if notes[1].model_id != CLOZE_MODEL_ID || notes[1].guid != NoteGUID(CLOZE_MODEL_ID, cards[1].Question) {
+		t.Errorf("Unexpected cloze note: %+v", notes[1])
+	}
+
+	var count int
+	db.QueryRow("SELECT count(*) FROM cards WHERE did = ?", DeckID("Books::Go")).Scan(&count)
+	if count != 3 {
+		t.Errorf("Expected 1 basic and 2 cloze cards in the deck, got %d", count)
+	}
+}
+
+func TestNoteGUIDIsStable(t *testing.T) {
+	first := NoteGUID(BASIC_MODEL_ID, "What is Go?")
+	if first != NoteGUID(BASIC_MODEL_ID, "What is Go?") {
+		t.Error("Expected the same GUID for the same note")
+	}
+	if first == NoteGUID(BASIC_MODEL_ID, "What is Rust?") || first == NoteGUID(CLOZE_MODEL_ID, "What is Go?") {
+		t.Error("Expected different GUIDs for different notes")
+	}
+	if DeckID("Books") != DeckID("Books") || DeckID("Books") == DeckID("Papers") {
+		t.Error("Expected deck ids to depend only on the name")
+	}
+}
+
+func TestWriteApkgSameFrontKeepsBothNotes(t *testing.T) {
+
+	// Arrange
+	path := filepath.Join(t.TempDir(), "deck.apkg")
+	cards := []ankify.AnkiQuestion{
+		{Question: "What is Go?", Answer: "A language"},
+		{Question: "What is Go?", Answer: "A board game"},
+		{Question: "What is Go?", Answer: "A board game"},
+	}
+
+	// Act
+	err := WriteApkg(path, "Go", cards)
+
+	// Assert
+	if err != nil {
+		t.Fatal(err)
+	}
+	var guids, first int
+	if err := openApkg(t, path).QueryRow(`SELECT COUNT(DISTINCT guid), SUM(guid = ?) FROM notes`, NoteGUID(BASIC_MODEL_ID, "What is Go?")).Scan(&guids, &first); err != nil {
+		t.Fatal(err)
+	}
+	if guids != 3 || first != 1 {
+		t.Errorf("Expected 3 distinct GUIDs, the first one from the front, got %d distinct and %d from the front", guids, first)
+	}
+}
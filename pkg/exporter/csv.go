@@ -0,0 +1,123 @@
+package exporter
+
+import (
+	"context"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/acrucetta/anki-builder/pkg/ankify"
+)
+
+// CSV_COLUMNS are the columns of WriteCSV for Basic notes, after the header directives.
+var CSV_COLUMNS = []string{"Front", "Back", "Tags", "Document", "Page", "Chunk", "Section", "GUID"}
+
+// CLOZE_CSV_COLUMNS are the columns of WriteCSV for Cloze notes, named after their fields.
+var CLOZE_CSV_COLUMNS = []string{"Text", "Back Extra", "Tags", "Document", "Page", "Chunk", "Section", "GUID"}
+
+// CSVOptions controls the file WriteCSV produces.
+type CSVOptions struct {
+	// Separator is ',' (the default) or '\t'.
+	Separator rune
+	// Deck is the deck Anki imports the cards into; empty lets the user choose.
+	Deck string
+}
+
+// CSVExporter writes cards to a CSV or TSV file with WriteCSV.
+type CSVExporter struct {
+	// Separator is ',' or '\t'.
+	Separator rune
+}
+
+func (e *CSVExporter) Name() string {
+	if e.Separator == '\t' {
+		return "tsv"
+	}
+	return "csv"
+}
+
+func (e *CSVExporter) Extension() string {
+	return "." + e.Name()
+}
+
+func (e *CSVExporter) Export(ctx context.Context, cards []ankify.AnkiQuestion, options Options) error {
+	return writeFile(options.Path, func(w io.Writer) error {
+		return WriteCSV(w, cards, CSVOptions{Separator: e.Separator, Deck: options.Deck})
+	})
+}
+
+// writeFile creates path and writes it with write.
+func writeFile(path string, write func(w io.Writer) error) error {
+	file, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	if err := write(file); err != nil {
+		return err
+	}
+	return file.Close()
+}
+
+// WriteCSV writes the cards as a text file Anki imports without any setup:
+// header directives name the separator, note type, deck and the tags and
+// GUID columns, and fields are HTML with newlines as <br>. Cloze cards are
+// imported as Cloze notes and the others as Basic notes. The document, page,
+// chunk and section columns are not imported but keep the cards' source.
+func WriteCSV(w io.Writer, cards []ankify.AnkiQuestion, options CSVOptions) error {
+	separator := options.Separator
+	if separator == 0 {
+		separator = ','
+	}
+	separator_name := "Comma"
+	if separator == '\t' {
+		separator_name = "Tab"
+	}
+
+	note_type, columns := DEFAULT_BASIC_NOTE_TYPE, CSV_COLUMNS
+	if len(cards) > 0 && cards[0].Type == ankify.CARD_TYPE_CLOZE {
+		note_type, columns = DEFAULT_CLOZE_NOTE_TYPE, CLOZE_CSV_COLUMNS
+	}
+
+	header := []string{
+		"#separator:" + separator_name,
+		"#html:true",
+		"#notetype:" + note_type,
+	}
+	if options.Deck != "" {
+		header = append(header, "#deck:"+options.Deck)
+	}
+	header = append(header,
+		"#columns:"+strings.Join(columns, string(separator)),
+		"#tags column:3",
+		fmt.Sprintf("#guid column:%d", len(columns)),
+	)
+	if _, err := io.WriteString(w, strings.Join(header, "\n")+"\n"); err != nil {
+		return err
+	}
+
+	writer := csv.NewWriter(w)
+	writer.Comma = separator
+	guids := noteGUIDs(cards)
+	for i, card := range cards {
+		if (card.Type == ankify.CARD_TYPE_CLOZE) != (note_type == DEFAULT_CLOZE_NOTE_TYPE) {
+			return fmt.Errorf("cannot write cloze and other cards to the same file")
+		}
+		note := newApkgNote(card)
+		writer.Write([]string{
+			note.fields[0],
+			note.fields[1],
+			strings.Join(strings.Fields(card.Tag), " "),
+			card.Source.Document,
+			strconv.Itoa(card.Source.Page),
+			strconv.Itoa(card.Source.Chunk),
+			card.Source.Section,
+			guids[i],
+		})
+	}
+	writer.Flush()
+	return writer.Error()
+}
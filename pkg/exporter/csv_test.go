@@ -0,0 +1,97 @@
+package exporter
+
+import (
+	"bytes"
+	"encoding/csv"
+	"strings"
+	"testing"
+
+	"github.com/acrucetta/anki-builder/pkg/ankify"
+)
+
+// readAnkiCSV splits a file written by WriteCSV into its header lines and rows.
+func readAnkiCSV(t *testing.T, data string, separator rune) ([]string, [][]string) {
+	t.Helper()
+	header := []string{}
+	lines := strings.SplitAfter(data, "\n")
+	for len(lines) > 0 && strings.HasPrefix(lines[0], "#") {
+		header = append(header, strings.TrimSuffix(lines[0], "\n"))
+		lines = lines[1:]
+	}
+	reader := csv.NewReader(strings.NewReader(strings.Join(lines, "")))
+	reader.Comma = separator
+	rows, err := reader.ReadAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return header, rows
+}
+
+func TestWriteCSV(t *testing.T) {
+
+	// Arrange
+	cards := []ankify.AnkiQuestion{
+		{Question: "What does <br> do?", Answer: "Breaks a line,\nlike \"this\" & that", Tag: "html  web", Source: ankify.Source{Document: "web.pdf", Page: 2, Chunk: 1, Section: "Tags"}},
+	}
+	var buffer bytes.Buffer
+
+	// Act
+	err := WriteCSV(&buffer, cards, CSVOptions{Deck: "Books::Web"})
+
+	// Assert
+	if err != nil {
+		t.Fatal(err)
+	}
+	header, rows := readAnkiCSV(t, buffer.String(), ',')
+	want_header := []string{
+		"#separator:Comma",
+		"#html:true",
+		"#notetype:Basic",
+		"#deck:Books::Web",
+		"#columns:Front,Back,Tags,Document,Page,Chunk,Section,GUID",
+		"#tags column:3",
+		"#guid column:8",
+	}
+	if strings.Join(header, "\n") != strings.Join(want_header, "\n") {
+		t.Errorf("Unexpected header:\n%s", strings.Join(header, "\n"))
+	}
+	want_row := []string{
+		"What does &lt;br&gt; do?",
+		"Breaks a line,<br>like &#34;this&#34; &amp; that",
+		"html web",
+		"web.pdf", "2", "1", "Tags",
+		NoteGUID(BASIC_MODEL_ID, cards[0].Question),
+	}
+	if len(rows) != 1 || strings.Join(rows[0], "|") != strings.Join(want_row, "|") {
+		t.Errorf("Expected %q, got %q", want_row, rows)
+	}
+}
+
+func TestWriteTSVCloze(t *testing.T) {
+
+	// Arrange
+	cards := []ankify.AnkiQuestion{
+		{Question: "{{c1::Paris}}\tis the capital of France.", Answer: "Since 508 AD.", Type: ankify.CARD_TYPE_CLOZE},
+	}
+	var buffer bytes.Buffer
+
+	// Act
+	err := WriteCSV(&buffer, cards, CSVOptions{Separator: '\t'})
+
+	// Assert
+	if err != nil {
+		t.Fatal(err)
+	}
+	header, rows := readAnkiCSV(t, buffer.String(), '\t')
+	if header[0] != "#separator:Tab" || header[2] != "#notetype:Cloze" || header[3] != "#columns:Text\tBack Extra\tTags\tDocument\tPage\tChunk\tSection\tGUID" {
+		t.Errorf("Unexpected header: %q", header)
+	}
+	if len(rows) != 1 || rows[0][0] != "{{c1::Paris}}\tis the capital of France." {
+		t.Errorf("Unexpected rows: %q", rows)
+	}
+
+	mixed := append(cards, ankify.AnkiQuestion{Question: "Q", Answer: "A"})
+	if err := WriteCSV(&bytes.Buffer{}, mixed, CSVOptions{}); err == nil {
+		t.Error("Expected an error for cloze and basic cards in one file")
+	}
+}
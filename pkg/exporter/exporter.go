@@ -0,0 +1,78 @@
+// Package exporter writes Anki cards to files and applications: Anki's own
+// text and package formats, a running Anki, and formats for other tools.
+package exporter
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/acrucetta/anki-builder/pkg/ankify"
+)
+
+// Exporter writes cards in one format.
+type Exporter interface {
+	// Name is the --format value that selects the exporter.
+	Name() string
+	// Extension is the extension of the file the exporter writes, e.g. ".csv",
+	// or "" if it writes no file.
+	Extension() string
+	// Export writes the cards, including where each card came from.
+	Export(ctx context.Context, cards []ankify.AnkiQuestion, options Options) error
+}
+
+// PartialExporter is an Exporter that may leave some cards out, such as one
+// adding them to an application that skips duplicates.
+type PartialExporter interface {
+	Exporter
+	// ExportSome exports the cards like Export and returns the indexes of
+	// those that were exported.
+	ExportSome(ctx context.Context, cards []ankify.AnkiQuestion, options Options) ([]int, error)
+}
+
+// Options are the settings shared by the exporters; each uses those that apply.
+type Options struct {
+	// Path is the file to write, ending in the exporter's Extension.
+	Path string
+	// Deck is the Anki deck the cards go to; other formats use it as a title.
+	Deck string
+	// NoteType is the Anki note type of the cards, where it can be chosen.
+	NoteType string
+}
+
+// FORMATS lists the names New accepts.
+var FORMATS = []string{"csv", "tsv", "apkg", "ankiconnect", "json", "jsonl", "markdown", "mochi", "supermemo", "mnemosyne", "gift", "moodle", "qti"}
+
+// New returns the exporter for a --format value.
+func New(format string) (Exporter, error) {
+	switch format {
+	case "", "csv":
+		return &CSVExporter{Separator: ','}, nil
+	case "tsv":
+		return &CSVExporter{Separator: '\t'}, nil
+	case "apkg":
+		return &ApkgExporter{}, nil
+	case "ankiconnect":
+		return NewAnkiConnect(""), nil
+	case "json":
+		return &JSONExporter{}, nil
+	case "jsonl":
+		return &JSONExporter{Lines: true}, nil
+	case "markdown", "md":
+		return &MarkdownExporter{}, nil
+	case "mochi":
+		return &MochiExporter{}, nil
+	case "supermemo", "remnote", "qa":
+		return &SuperMemoExporter{}, nil
+	case "mnemosyne":
+		return &MnemosyneExporter{}, nil
+	case "gift":
+		return &GIFTExporter{}, nil
+	case "moodle", "moodle-xml":
+		return &MoodleXMLExporter{}, nil
+	case "qti":
+		return &QTIExporter{}, nil
+	default:
+		return nil, fmt.Errorf("unknown format %q, expected one of %s", format, strings.Join(FORMATS, ", "))
+	}
+}
@@ -0,0 +1,113 @@
+package exporter
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"strings"
+
+	"github.com/acrucetta/anki-builder/pkg/ankify"
+)
+
+// JSONCard is a card as the JSON and JSONL exporters write it.
+type JSONCard struct {
+	// GUID is the id the card has in Anki packages and CSV files.
+	GUID     string          `json:"guid"`
+	Type     ankify.CardType `json:"type"`
+	Question string          `json:"question"`
+	Answer   string          `json:"answer"`
+	// Options, Distractors and Explanation are set on multiple-choice cards;
+	// Correct is the index of Answer in Options.
+	Options     []string      `json:"options,omitempty"`
+	Correct     *int          `json:"correct,omitempty"`
+	Distractors []string      `json:"distractors,omitempty"`
+	Explanation string        `json:"explanation,omitempty"`
+	Tags        []string      `json:"tags"`
+	Source      ankify.Source `json:"source"`
+}
+
+// NewJSONCard returns the JSON form of a card.
+func NewJSONCard(card ankify.AnkiQuestion) JSONCard {
+	card_type := card.Type
+	if card_type == "" {
+		card_type = ankify.CARD_TYPE_BASIC
+	}
+	json_card := JSONCard{
+		GUID:     newApkgNote(card).guid,
+		Type:     card_type,
+		Question: card.Question,
+		Answer:   card.Answer,
+		Tags:     append([]string{}, strings.Fields(card.Tag)...),
+		Source:   card.Source,
+	}
+	if card.Type == ankify.CARD_TYPE_MULTIPLE_CHOICE {
+		quiz := ankify.NewQuizQuestion(card)
+		json_card.Options = quiz.Options
+		json_card.Correct = &quiz.Answer
+		json_card.Distractors = quiz.Distractors
+		json_card.Explanation = quiz.Explanation
+	}
+	return json_card
+}
+
+// JSONDeck is the document the JSON exporter writes.
+type JSONDeck struct {
+	Deck  string     `json:"deck,omitempty"`
+	Cards []JSONCard `json:"cards"`
+}
+
+// JSONExporter writes cards as one indented JSON document, or with Lines as
+// JSON Lines: one compact JSONCard per line, without the deck.
+type JSONExporter struct {
+	Lines bool
+}
+
+func (e *JSONExporter) Name() string {
+	if e.Lines {
+		return "jsonl"
+	}
+	return "json"
+}
+
+func (e *JSONExporter) Extension() string {
+	return "." + e.Name()
+}
+
+func (e *JSONExporter) Export(ctx context.Context, cards []ankify.AnkiQuestion, options Options) error {
+	return writeFile(options.Path, func(w io.Writer) error {
+		if e.Lines {
+			return WriteJSONL(w, cards)
+		}
+		return WriteJSON(w, options.Deck, cards)
+	})
+}
+
+// WriteJSON writes the cards as a JSONDeck.
+func WriteJSON(w io.Writer, deck string, cards []ankify.AnkiQuestion) error {
+	json_deck := JSONDeck{Deck: deck, Cards: []JSONCard{}}
+	guids := noteGUIDs(cards)
+	for i, card := range cards {
+		json_card := NewJSONCard(card)
+		json_card.GUID = guids[i]
+		json_deck.Cards = append(json_deck.Cards, json_card)
+	}
+	encoder := json.NewEncoder(w)
+	encoder.SetEscapeHTML(false)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(json_deck)
+}
+
+// WriteJSONL writes each card as a JSONCard on its own line.
+func WriteJSONL(w io.Writer, cards []ankify.AnkiQuestion) error {
+	encoder := json.NewEncoder(w)
+	encoder.SetEscapeHTML(false)
+	guids := noteGUIDs(cards)
+	for i, card := range cards {
+		json_card := NewJSONCard(card)
+		json_card.GUID = guids[i]
+		if err := encoder.Encode(json_card); err != nil {
+			return err
+		}
+	}
+	return nil
+}
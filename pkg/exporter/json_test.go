@@ -0,0 +1,109 @@
+package exporter
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/acrucetta/anki-builder/pkg/ankify"
+)
+
+func TestWriteJSON(t *testing.T) {
+
+	// Arrange
+	cards := []ankify.AnkiQuestion{
+		{Question: "What is Go?", Answer: "A language", Tag: "go  lang", Source: ankify.Source{Document: "go.pdf", Page: 3, Chunk: 1, Section: "Intro"}},
+		{Question: "Who wrote Go?", Answer: "Google", Type: ankify.CARD_TYPE_MULTIPLE_CHOICE, Choices: &ankify.MultipleChoice{Distractors: []string{"Apple", "IBM"}, Explanation: "In 2007."}},
+	}
+	var buffer bytes.Buffer
+
+	// Act
+	err := WriteJSON(&buffer, "Books::Go", cards)
+
+	// Assert
+	if err != nil {
+		t.Fatal(err)
+	}
+	var deck JSONDeck
+	if err := json.Unmarshal(buffer.Bytes(), &deck); err != nil {
+		t.Fatal(err)
+	}
+	if deck.Deck != "Books::Go" || len(deck.Cards) != 2 {
+		t.Fatalf("Unexpected deck: %+v", deck)
+	}
+	basic := deck.Cards[0]
+	if basic.Type != ankify.CARD_TYPE_BASIC || basic.GUID != NoteGUID(BASIC_MODEL_ID, "What is Go?") || strings.Join(basic.Tags, ",") != "go,lang" {
+		t.Errorf("Unexpected card: %+v", basic)
+	}
+	if basic.Source != cards[0].Source {
+		t.Errorf("Expected the source %+v, got %+v", cards[0].Source, basic.Source)
+	}
+	if basic.Options != nil || basic.Correct != nil {
+		t.Errorf("Expected no options on a basic card, got %+v", basic)
+	}
+	choice := deck.Cards[1]
+	if choice.Correct == nil || choice.Options[*choice.Correct] != "Google" || len(choice.Distractors) != 2 || choice.Explanation != "In 2007." {
+		t.Errorf("Unexpected multiple-choice card: %+v", choice)
+	}
+}
+
+func TestJSONLExporter(t *testing.T) {
+
+	// Arrange
+	cards := []ankify.AnkiQuestion{
+		{Question: "What is Go?", Answer: "A language", Source: ankify.Source{Document: "go.pdf", Page: 1}},
+		{Question: "{{c1::Go}} is compiled.", Type: ankify.CARD_TYPE_CLOZE, Source: ankify.Source{Document: "go.pdf", Page: 2}},
+	}
+	output, err := New("jsonl")
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(t.TempDir(), "cards"+output.Extension())
+
+	// Act
+	err = output.Export(context.Background(), cards, Options{Path: path})
+
+	// Assert
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSpace(string(data)), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("Expected 2 lines, got %q", data)
+	}
+	for i, line := range lines {
+		var card JSONCard
+		if err := json.Unmarshal([]byte(line), &card); err != nil {
+			t.Fatal(err)
+		}
+		if card.Question != cards[i].Question || card.Source.Page != i+1 {
+			t.Errorf("Line %d: unexpected card %+v", i, card)
+		}
+	}
+	if !strings.Contains(lines[1], `"type":"cloze"`) || !strings.Contains(lines[1], `"guid":"`+NoteGUID(CLOZE_MODEL_ID, cards[1].Question)+`"`) {
+		t.Errorf("Expected a cloze card with its GUID, got %s", lines[1])
+	}
+}
+
+func TestNewExporter(t *testing.T) {
+	for _, format := range FORMATS {
+		output, err := New(format)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if output.Name() != format {
+			t.Errorf("New(%q) returned the %q exporter", format, output.Name())
+		}
+	}
+	if _, err := New("docx"); err == nil {
+		t.Error("Expected an error for an unknown format")
+	}
+}
@@ -0,0 +1,101 @@
+package exporter
+
+import (
+	"context"
+	"io"
+	"strings"
+
+	"github.com/acrucetta/anki-builder/pkg/ankify"
+)
+
+// MARKDOWN_DECK_TAG is the tag the Obsidian spaced repetition plugin looks
+// for in notes with flashcards; the deck goes after a slash.
+const MARKDOWN_DECK_TAG = "#flashcards"
+
+// MarkdownExporter writes cards as an Obsidian note in the syntax of the
+// spaced repetition plugin.
+type MarkdownExporter struct{}
+
+func (e *MarkdownExporter) Name() string {
+	return "markdown"
+}
+
+func (e *MarkdownExporter) Extension() string {
+	return ".md"
+}
+
+func (e *MarkdownExporter) Export(ctx context.Context, cards []ankify.AnkiQuestion, options Options) error {
+	return writeFile(options.Path, func(w io.Writer) error {
+		return WriteMarkdown(w, options.Deck, cards)
+	})
+}
+
+// WriteMarkdown writes the cards as a note for the Obsidian spaced repetition
+// plugin. The note is tagged with the deck, cards come under a heading
+// naming their source, and are written as "Question::Answer" when both fit
+// on a line or as the question, a "?" line and the answer otherwise. Cloze
+// deletions become ==highlights== and multiple-choice cards list their
+// options in the question.
+func WriteMarkdown(w io.Writer, deck string, cards []ankify.AnkiQuestion) error {
+	var note strings.Builder
+	note.WriteString(markdownDeckTag(deck) + "\n")
+
+	for i, card := range cards {
+		if label := sourceLabel(card.Source); i == 0 || label != sourceLabel(cards[i-1].Source) {
+			if label == "" {
+				label = "Cards"
+			}
+			note.WriteString("\n## " + label + "\n")
+		}
+		note.WriteString("\n" + markdownCard(card) + "\n")
+	}
+	_, err := io.WriteString(w, note.String())
+	return err
+}
+
+// markdownDeckTag turns a deck like "Books::Go in Action" into
+// "#flashcards/Books/Go-in-Action".
+func markdownDeckTag(deck string) string {
+	parts := []string{}
+	for _, part := range strings.Split(deck, "::") {
+		if part = strings.Join(strings.Fields(part), "-"); part != "" {
+			parts = append(parts, part)
+		}
+	}
+	if len(parts) == 0 {
+		return MARKDOWN_DECK_TAG
+	}
+	return MARKDOWN_DECK_TAG + "/" + strings.Join(parts, "/")
+}
+
+func markdownCard(card ankify.AnkiQuestion) string {
+	question, answer := card.Question, card.Answer
+	switch card.Type {
+	case ankify.CARD_TYPE_CLOZE:
+		text := ankify.ClozeDeletion.ReplaceAllString(question, "==$2==")
+		if strings.TrimSpace(answer) != "" {
+			text += "\n" + answer
+		}
+		return markdownLines(text)
+	case ankify.CARD_TYPE_MULTIPLE_CHOICE:
+		question, answer = choiceText(card)
+	}
+
+	question, answer = markdownLines(question), markdownLines(answer)
+	if !strings.Contains(question+answer, "\n") && !strings.Contains(question+answer, "::") {
+		return question + "::" + answer
+	}
+	return question + "\n?\n" + answer
+}
+
+// markdownLines drops blank lines, which would end a card, and lines that
+// are only "?", which would split one.
+func markdownLines(text string) string {
+	lines := []string{}
+	for _, line := range strings.Split(strings.TrimSpace(text), "\n") {
+		if trimmed := strings.TrimSpace(line); trimmed != "" && trimmed != "?" {
+			lines = append(lines, strings.TrimRight(line, " \t"))
+		}
+	}
+	return strings.Join(lines, "\n")
+}
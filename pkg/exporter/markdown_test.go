@@ -0,0 +1,40 @@
+package exporter
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/acrucetta/anki-builder/pkg/ankify"
+)
+
+func TestWriteMarkdown(t *testing.T) {
+
+	// Arrange
+	intro := ankify.Source{Document: "go.pdf", Page: 1, Section: "Intro"}
+	cards := []ankify.AnkiQuestion{
+		{Question: "What is Go?", Answer: "A language", Source: intro},
+		{Question: "How do you print?", Answer: "With fmt:\n\nfmt.Println()", Source: intro},
+		{Question: "{{c1::Go}} was released in {{c2::2009::year}}.", Answer: "By Google.", Type: ankify.CARD_TYPE_CLOZE, Source: ankify.Source{Document: "go.pdf", Page: 2}},
+		{Question: "Who wrote Go?", Answer: "Google", Type: ankify.CARD_TYPE_MULTIPLE_CHOICE, Choices: &ankify.MultipleChoice{Distractors: []string{"Apple", "IBM"}}, Source: ankify.Source{Document: "go.pdf", Page: 2}},
+	}
+	options, correct := cards[3].Options()
+	var buffer bytes.Buffer
+
+	// Act
+	err := WriteMarkdown(&buffer, "Books::Go in Action", cards)
+
+	// Assert
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "#flashcards/Books/Go-in-Action\n" +
+		"\n## go.pdf, page 1, Intro\n" +
+		"\nWhat is Go?::A language\n" +
+		"\nHow do you print?\n?\nWith fmt:\nfmt.Println()\n" +
+		"\n## go.pdf, page 2\n" +
+		"\n==Go== was released in ==2009==.\nBy Google.\n" +
+		"\nWho wrote Go?\nA. " + options[0] + "\nB. " + options[1] + "\nC. " + options[2] + "\n?\n" + string(rune('A'+correct)) + ". Google\n"
+	if buffer.String() != want {
+		t.Errorf("Expected:\n%s\ngot:\n%s", want, buffer.String())
+	}
+}
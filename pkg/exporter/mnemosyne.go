@@ -0,0 +1,115 @@
+package exporter
+
+import (
+	"context"
+	"encoding/xml"
+	"io"
+	"strings"
+
+	"github.com/acrucetta/anki-builder/pkg/ankify"
+)
+
+// MnemosyneXML is a Mnemosyne 1.x XML file, which Mnemosyne 2 still imports.
+type MnemosyneXML struct {
+	XMLName     xml.Name            `xml:"mnemosyne"`
+	CoreVersion int                 `xml:"core_version,attr"`
+	Categories  []MnemosyneCategory `xml:"category"`
+	Items       []MnemosyneItem     `xml:"item"`
+}
+
+type MnemosyneCategory struct {
+	Active int    `xml:"active,attr"`
+	Name   string `xml:"name"`
+}
+
+// MnemosyneItem is a card. Its source is kept in an XML comment, which
+// Mnemosyne ignores.
+type MnemosyneItem struct {
+	ID       string `xml:"id,attr"`
+	Category string `xml:"cat"`
+	Question string `xml:"Q"`
+	Answer   string `xml:"A"`
+	Source   string `xml:",comment"`
+}
+
+// MnemosyneExporter writes cards to a Mnemosyne XML file with WriteMnemosyne.
+type MnemosyneExporter struct{}
+
+func (e *MnemosyneExporter) Name() string {
+	return "mnemosyne"
+}
+
+func (e *MnemosyneExporter) Extension() string {
+	return ".xml"
+}
+
+func (e *MnemosyneExporter) Export(ctx context.Context, cards []ankify.AnkiQuestion, options Options) error {
+	return writeFile(options.Path, func(w io.Writer) error {
+		return WriteMnemosyne(w, options.Deck, cards)
+	})
+}
+
+// WriteMnemosyne writes the cards as Mnemosyne XML, in a category named
+// after the deck. Cloze and multiple-choice cards become plain questions, see
+// plainCards.
+func WriteMnemosyne(w io.Writer, deck string, cards []ankify.AnkiQuestion) error {
+	if deck == "" {
+		deck = DEFAULT_DECK_NAME
+	}
+	file := MnemosyneXML{
+		CoreVersion: 1,
+		Categories:  []MnemosyneCategory{{Active: 1, Name: deck}},
+	}
+	var items []MnemosyneItem
+	var fronts []string
+	for _, card := range cards {
+		source := sourceComment(card.Source)
+		for _, plain := range plainCards(card) {
+			fronts = append(fronts, plain.Front)
+			items = append(items, MnemosyneItem{
+				Category: deck,
+				Question: strings.TrimSpace(plain.Front),
+				Answer:   strings.TrimSpace(plain.Back),
+				Source:   source,
+			})
+		}
+	}
+	for i, id := range shortIDs(fronts) {
+		items[i].ID = id
+	}
+	file.Items = items
+
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+	encoder := xml.NewEncoder(w)
+	encoder.Indent("", "  ")
+	if err := encoder.Encode(file); err != nil {
+		return err
+	}
+	_, err := io.WriteString(w, "\n")
+	return err
+}
+
+// ReadMnemosyne reads the category and cards of a file written by
+// WriteMnemosyne, as basic cards.
+func ReadMnemosyne(r io.Reader) (string, []ankify.AnkiQuestion, error) {
+	var file MnemosyneXML
+	if err := xml.NewDecoder(r).Decode(&file); err != nil {
+		return "", nil, err
+	}
+	deck := ""
+	if len(file.Categories) > 0 {
+		deck = file.Categories[0].Name
+	}
+	cards := []ankify.AnkiQuestion{}
+	for _, item := range file.Items {
+		cards = append(cards, ankify.AnkiQuestion{
+			Question: item.Question,
+			Answer:   item.Answer,
+			Type:     ankify.CARD_TYPE_BASIC,
+			Source:   parseSourceLabel(strings.TrimPrefix(strings.TrimSpace(item.Source), "Source:")),
+		})
+	}
+	return deck, cards, nil
+}
@@ -0,0 +1,98 @@
+package exporter
+
+import (
+	"bytes"
+	"encoding/xml"
+	"os"
+	"testing"
+
+	"github.com/acrucetta/anki-builder/pkg/ankify"
+)
+
+func TestMnemosyneRoundTrip(t *testing.T) {
+
+	// Arrange
+	sample, err := os.ReadFile("testdata/mnemosyne.xml")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Act
+	deck, cards, err := ReadMnemosyne(bytes.NewReader(sample))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var written bytes.Buffer
+	err = WriteMnemosyne(&written, deck, cards)
+
+	// Assert
+	if err != nil {
+		t.Fatal(err)
+	}
+	if deck != "Books::Go" || len(cards) != 4 {
+		t.Fatalf("Unexpected category %q with %+v", deck, cards)
+	}
+	want := ankify.AnkiQuestion{
+		Question: "What does a goroutine cost?",
+		Answer:   "A few kilobytes of stack,\nwhich grows as needed.",
+		Type:     ankify.CARD_TYPE_BASIC,
+		Source:   ankify.Source{Document: "go.pdf", Page: 12, Section: "Goroutines"},
+	}
+	if cards[0] != want {
+		t.Errorf("Expected %+v, got %+v", want, cards[0])
+	}
+	if written.String() != string(sample) {
+		t.Errorf("Writing the sample back changed it:\n%s", written.String())
+	}
+}
+
+func TestWriteMnemosyneDashedSource(t *testing.T) {
+
+	// Arrange
+	cards := []ankify.AnkiQuestion{{
+		Question: "What is a dash?",
+		Answer:   "A punctuation mark.",
+		Source:   ankify.Source{Document: "https://x.com/a---b-"},
+	}}
+
+	// Act
+	var written bytes.Buffer
+	err := WriteMnemosyne(&written, "Dashes", cards)
+
+	// Assert
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, read, err := ReadMnemosyne(&written)
+	if err != nil {
+		t.Fatalf("Expected well-formed XML, got %v", err)
+	}
+	if len(read) != 1 || read[0].Source.Document != "https://x.com/a- - -b-" {
+		t.Errorf("Unexpected cards read back %+v", read)
+	}
+}
+
+func TestWriteMnemosyneDistinctIDs(t *testing.T) {
+
+	// Arrange
+	cards := []ankify.AnkiQuestion{
+		{Question: "What is Go?", Answer: "A language"},
+		{Question: "What is Go?", Answer: "A board game"},
+	}
+	var written bytes.Buffer
+
+	// Act
+	err := WriteMnemosyne(&written, "Go", cards)
+
+	// Assert
+	if err != nil {
+		t.Fatal(err)
+	}
+	var file MnemosyneXML
+	if err := xml.Unmarshal(written.Bytes(), &file); err != nil {
+		t.Fatal(err)
+	}
+	if len(file.Items) != 2 || file.Items[0].ID == file.Items[1].ID {
+		t.Errorf("Expected 2 items with distinct ids, got %+v", file.Items)
+	}
+}
@@ -0,0 +1,224 @@
+package exporter
+
+import (
+	"archive/zip"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"regexp"
+	"strings"
+
+	"github.com/acrucetta/anki-builder/pkg/ankify"
+)
+
+// MOCHI_DATA_FILE is the file of a .mochi archive that holds the decks.
+const MOCHI_DATA_FILE = "data.json"
+
+// MOCHI_VERSION is the version of the .mochi format written.
+const MOCHI_VERSION = 2
+
+// MochiData is the content of a .mochi archive's data.json.
+type MochiData struct {
+	Version int         `json:"version"`
+	Decks   []MochiDeck `json:"decks"`
+}
+
+type MochiDeck struct {
+	ID       string      `json:"id"`
+	Name     string      `json:"name"`
+	ParentID string      `json:"parent-id,omitempty"`
+	Cards    []MochiCard `json:"cards,omitempty"`
+}
+
+// MochiCard is a Mochi card: Markdown content whose sides are separated by
+// a "---" line.
+type MochiCard struct {
+	ID      string   `json:"id"`
+	DeckID  string   `json:"deck-id"`
+	Content string   `json:"content"`
+	Tags    []string `json:"manual-tags,omitempty"`
+}
+
+// MOCHI_SIDE_SEPARATOR separates the front and back of a Mochi card.
+const MOCHI_SIDE_SEPARATOR = "\n---\n"
+
+var (
+	mochiDeletion = regexp.MustCompile(`(?s)\{\{(\d+)::(.*?)\}\}`)
+	mochiSource   = regexp.MustCompile(`\n*<!-- Source: (.*?) -->$`)
+)
+
+// MochiExporter writes cards to a .mochi archive with WriteMochi.
+type MochiExporter struct{}
+
+func (e *MochiExporter) Name() string {
+	return "mochi"
+}
+
+func (e *MochiExporter) Extension() string {
+	return ".mochi"
+}
+
+func (e *MochiExporter) Export(ctx context.Context, cards []ankify.AnkiQuestion, options Options) error {
+	return writeFile(options.Path, func(w io.Writer) error {
+		return WriteMochi(w, options.Deck, cards)
+	})
+}
+
+// WriteMochi writes the cards as a .mochi archive that Mochi imports into
+// the deck, with "::" separating subdecks. Cloze deletions keep their
+// numbers as {{1::...}}, and each card ends with its source in an HTML
+// comment, which Mochi does not show.
+func WriteMochi(w io.Writer, deck string, cards []ankify.AnkiQuestion) error {
+	archive := zip.NewWriter(w)
+	file, err := archive.Create(MOCHI_DATA_FILE)
+	if err != nil {
+		return err
+	}
+	encoder := json.NewEncoder(file)
+	encoder.SetEscapeHTML(false)
+	encoder.SetIndent("", "  ")
+	if err := encoder.Encode(NewMochiData(deck, cards)); err != nil {
+		return err
+	}
+	return archive.Close()
+}
+
+// NewMochiData returns the data.json of a .mochi archive with the cards in
+// the deck.
+func NewMochiData(deck string, cards []ankify.AnkiQuestion) MochiData {
+	if deck == "" {
+		deck = DEFAULT_DECK_NAME
+	}
+	data := MochiData{Version: MOCHI_VERSION}
+	parent_id, path := "", ""
+	for _, name := range strings.Split(deck, "::") {
+		path += "::" + name
+		id := shortID("deck" + path)
+		data.Decks = append(data.Decks, MochiDeck{ID: id, Name: name, ParentID: parent_id})
+		parent_id = id
+	}
+
+	contents := make([]string, len(cards))
+	for i, card := range cards {
+		contents[i] = mochiContent(card)
+	}
+	ids := shortIDs(contents)
+	mochi_cards := []MochiCard{}
+	for i, card := range cards {
+		content := contents[i]
+		mochi_cards = append(mochi_cards, MochiCard{
+			ID:      ids[i],
+			DeckID:  parent_id,
+			Content: content,
+			Tags:    strings.Fields(card.Tag),
+		})
+	}
+	data.Decks[len(data.Decks)-1].Cards = mochi_cards
+	return data
+}
+
+func mochiContent(card ankify.AnkiQuestion) string {
+	front, back := card.Question, card.Answer
+	switch card.Type {
+	case ankify.CARD_TYPE_CLOZE:
+		front = ankify.ClozeDeletion.ReplaceAllString(front, "{{$1::$2}}")
+	case ankify.CARD_TYPE_MULTIPLE_CHOICE:
+		front, back = choiceText(card)
+	}
+	content := strings.TrimSpace(front)
+	if strings.TrimSpace(back) != "" {
+		content += MOCHI_SIDE_SEPARATOR + strings.TrimSpace(back)
+	}
+	if comment := sourceComment(card.Source); comment != "" {
+		content += "\n\n<!--" + comment + "-->"
+	}
+	return content
+}
+
+// ReadMochi reads the deck and cards of a .mochi archive written by
+// WriteMochi. Cards with cloze deletions are read as cloze cards and the
+// others as basic cards.
+func ReadMochi(r io.ReaderAt, size int64) (string, []ankify.AnkiQuestion, error) {
+	archive, err := zip.NewReader(r, size)
+	if err != nil {
+		return "", nil, err
+	}
+	file, err := archive.Open(MOCHI_DATA_FILE)
+	if err != nil {
+		return "", nil, fmt.Errorf("reading the Mochi archive: %w", err)
+	}
+	defer file.Close()
+	var data MochiData
+	if err := json.NewDecoder(file).Decode(&data); err != nil {
+		return "", nil, fmt.Errorf("decoding %s: %w", MOCHI_DATA_FILE, err)
+	}
+	deck, cards := data.Cards()
+	return deck, cards, nil
+}
+
+// Cards returns the cards of the last deck that has any, and that deck's
+// full name with "::" separating its parents.
+func (data MochiData) Cards() (string, []ankify.AnkiQuestion) {
+	decks := map[string]MochiDeck{}
+	for _, deck := range data.Decks {
+		decks[deck.ID] = deck
+	}
+	cards := []ankify.AnkiQuestion{}
+	name := ""
+	for _, deck := range data.Decks {
+		if len(deck.Cards) == 0 {
+			continue
+		}
+		name = deck.Name
+		for parent, ok := decks[deck.ParentID]; ok; parent, ok = decks[parent.ParentID] {
+			name = parent.Name + "::" + name
+		}
+		cards = cards[:0]
+		for _, mochi_card := range deck.Cards {
+			cards = append(cards, mochiCard(mochi_card))
+		}
+	}
+	return name, cards
+}
+
+func mochiCard(mochi_card MochiCard) ankify.AnkiQuestion {
+	content := mochi_card.Content
+	card := ankify.AnkiQuestion{Tag: strings.Join(mochi_card.Tags, " "), Type: ankify.CARD_TYPE_BASIC}
+	if match := mochiSource.FindStringSubmatch(content); match != nil {
+		card.Source = parseSourceLabel(match[1])
+		content = content[:len(content)-len(match[0])]
+	}
+	front, back, _ := strings.Cut(content, MOCHI_SIDE_SEPARATOR)
+	if mochiDeletion.MatchString(front) {
+		card.Type = ankify.CARD_TYPE_CLOZE
+		front = mochiDeletion.ReplaceAllString(front, "{{c$1::$2}}")
+	}
+	card.Question, card.Answer = front, back
+	return card
+}
+
+// shortID returns an 8 character id derived from text, so exports of the
+// same cards get the same ids.
+func shortID(text string) string {
+	hash := sha256.Sum256([]byte(text))
+	return hex.EncodeToString(hash[:4])
+}
+
+// shortIDs returns the shortID of each text. A text that repeats an earlier
+// one gets an id mixing in a counter, so no two cards share an id.
+func shortIDs(texts []string) []string {
+	ids := make([]string, len(texts))
+	seen := make(map[string]bool)
+	for i, text := range texts {
+		id := shortID(text)
+		for n := 2; seen[id]; n++ {
+			id = shortID(fmt.Sprintf("%s\x1f%d", text, n))
+		}
+		seen[id] = true
+		ids[i] = id
+	}
+	return ids
+}
@@ -0,0 +1,95 @@
+package exporter
+
+import (
+	"archive/zip"
+	"bytes"
+	"io"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/acrucetta/anki-builder/pkg/ankify"
+)
+
+// zipFile returns the content of a file in a zip archive.
+func zipFile(t *testing.T, data []byte, name string) []byte {
+	t.Helper()
+	archive, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	file, err := archive.Open(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+	content, err := io.ReadAll(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return content
+}
+
+func TestMochiRoundTrip(t *testing.T) {
+
+	// Arrange
+	sample, err := os.ReadFile("testdata/mochi_data.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var archive bytes.Buffer
+	writer := zip.NewWriter(&archive)
+	file, _ := writer.Create(MOCHI_DATA_FILE)
+	file.Write(sample)
+	writer.Close()
+
+	// Act
+	deck, cards, err := ReadMochi(bytes.NewReader(archive.Bytes()), int64(archive.Len()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var written bytes.Buffer
+	err = WriteMochi(&written, deck, cards)
+
+	// Assert
+	if err != nil {
+		t.Fatal(err)
+	}
+	if deck != "Books::Go" || len(cards) != 3 {
+		t.Fatalf("Unexpected deck %q with %+v", deck, cards)
+	}
+	want := ankify.AnkiQuestion{
+		Question: "What does a goroutine cost?",
+		Answer:   "A few kilobytes of stack,\nwhich grows as needed.",
+		Tag:      "go concurrency",
+		Type:     ankify.CARD_TYPE_BASIC,
+		Source:   ankify.Source{Document: "go.pdf", Page: 12, Section: "Goroutines"},
+	}
+	if cards[0] != want {
+		t.Errorf("Expected %+v, got %+v", want, cards[0])
+	}
+	if cards[1].Type != ankify.CARD_TYPE_CLOZE || cards[1].Question != "{{c1::Channels}} connect {{c2::goroutines}}." {
+		t.Errorf("Expected a cloze card, got %+v", cards[1])
+	}
+	if got := zipFile(t, written.Bytes(), MOCHI_DATA_FILE); string(got) != string(sample) {
+		t.Errorf("Writing the sample back changed it:\n%s", got)
+	}
+}
+
+func TestNewMochiDataDistinctIDs(t *testing.T) {
+
+	// Arrange
+	card := ankify.AnkiQuestion{Question: "What is Go?", Answer: "A language", Source: ankify.Source{Document: "notes-->draft.md"}}
+
+	// Act
+	data := NewMochiData("Go", []ankify.AnkiQuestion{card, card})
+
+	// Assert
+	cards := data.Decks[0].Cards
+	if len(cards) != 2 || cards[0].ID == cards[1].ID {
+		t.Fatalf("Expected 2 cards with distinct ids, got %+v", cards)
+	}
+	if strings.Count(cards[0].Content, "-->") != 1 || !strings.HasSuffix(cards[0].Content, " -->") {
+		t.Errorf("Expected a single closed source comment, got %q", cards[0].Content)
+	}
+}
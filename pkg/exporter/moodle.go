@@ -0,0 +1,311 @@
+package exporter
+
+import (
+	"context"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/acrucetta/anki-builder/pkg/ankify"
+)
+
+// moodleCategory returns the question bank category of a document's cards,
+// under the course's top category and the deck, e.g.
+// "$course$/top/Books/Go/go.pdf". A "/" inside a name is doubled, as Moodle
+// expects.
+func moodleCategory(deck string, document string) string {
+	path := []string{"$course$", "top"}
+	for _, name := range append(strings.Split(deck, "::"), document) {
+		if name = strings.TrimSpace(name); name != "" {
+			path = append(path, strings.ReplaceAll(name, "/", "//"))
+		}
+	}
+	return strings.Join(path, "/")
+}
+
+// GIFTExporter writes cards as Moodle GIFT text with WriteGIFT.
+type GIFTExporter struct{}
+
+func (e *GIFTExporter) Name() string {
+	return "gift"
+}
+
+func (e *GIFTExporter) Extension() string {
+	return ".txt"
+}
+
+func (e *GIFTExporter) Export(ctx context.Context, cards []ankify.AnkiQuestion, options Options) error {
+	return writeFile(options.Path, func(w io.Writer) error {
+		return WriteGIFT(w, options.Deck, cards)
+	})
+}
+
+// WriteGIFT writes the cards as Moodle GIFT questions, in one category per
+// source document under the deck. Basic cards become essay questions with the
+// answer as general feedback, multiple-choice cards become multiple-choice
+// questions, and each deletion number of a cloze card becomes a missing word
+// question, or an essay question if it hides several parts. Each question is
+// preceded by comments naming its source and tags.
+func WriteGIFT(w io.Writer, deck string, cards []ankify.AnkiQuestion) error {
+	var text strings.Builder
+	for _, group := range groupByDocument(cards) {
+		text.WriteString("$CATEGORY: " + moodleCategory(deck, group.Document) + "\n\n")
+		for _, card := range group.Cards {
+			for _, question := range giftQuestions(card) {
+				if label := sourceLabel(card.Source); label != "" {
+					text.WriteString("// Source: " + label + "\n")
+				}
+				for _, tag := range strings.Fields(card.Tag) {
+					text.WriteString("// [tag:" + tag + "]\n")
+				}
+				text.WriteString(question + "\n\n")
+			}
+		}
+	}
+	_, err := io.WriteString(w, text.String())
+	return err
+}
+
+func giftQuestions(card ankify.AnkiQuestion) []string {
+	title := "::" + giftEscape(questionName(card.Question)) + "::"
+	text := strings.TrimSpace(card.Question)
+	switch card.Type {
+	case ankify.CARD_TYPE_MULTIPLE_CHOICE:
+		question := title + giftEscape(text) + " {\n\t=" + giftEscape(strings.TrimSpace(card.Answer))
+		explanation := ""
+		if card.Choices != nil {
+			for _, distractor := range card.Choices.Distractors {
+				question += "\n\t~" + giftEscape(strings.TrimSpace(distractor))
+			}
+			explanation = card.Choices.Explanation
+		}
+		if feedback := giftFeedback(explanation); feedback != "" {
+			question += "\n\t" + feedback
+		}
+		return []string{question + "\n}"}
+	case ankify.CARD_TYPE_CLOZE:
+		numbers := ankify.ClozeNumbers(card.Question)
+		plain := plainCards(card)
+		questions := []string{}
+		for i, number := range numbers {
+			numbered := title
+			if len(numbers) > 1 {
+				numbered = "::" + giftEscape(fmt.Sprintf("%s (c%d)", questionName(card.Question), number)) + "::"
+			}
+			if missing, ok := giftMissingWord(card, number); ok {
+				questions = append(questions, numbered+missing)
+				continue
+			}
+			questions = append(questions, numbered+giftEscape(strings.TrimSpace(plain[i].Front))+" {"+giftFeedback(plain[i].Back)+"}")
+		}
+		return questions
+	default:
+		return []string{title + giftEscape(text) + " {" + giftFeedback(card.Answer) + "}"}
+	}
+}
+
+// giftMissingWord writes the deletion numbered number of a cloze card as the
+// answer of a missing word question, if it is the only one with the number.
+func giftMissingWord(card ankify.AnkiQuestion, number int) (string, bool) {
+	text := strings.TrimSpace(card.Question)
+	matches := ankify.ClozeDeletion.FindAllStringSubmatchIndex(text, -1)
+	hidden := 0
+	for _, match := range matches {
+		if text[match[2]:match[3]] == strconv.Itoa(number) {
+			hidden++
+		}
+	}
+	if hidden != 1 {
+		return "", false
+	}
+
+	var question strings.Builder
+	last := 0
+	for _, match := range matches {
+		question.WriteString(giftEscape(text[last:match[0]]))
+		deleted := giftEscape(text[match[4]:match[5]])
+		if text[match[2]:match[3]] == strconv.Itoa(number) {
+			deleted = "{=" + deleted + giftFeedback(card.Answer) + "}"
+		}
+		question.WriteString(deleted)
+		last = match[1]
+	}
+	question.WriteString(giftEscape(text[last:]))
+	return question.String(), true
+}
+
+func giftFeedback(feedback string) string {
+	if feedback = strings.TrimSpace(feedback); feedback == "" {
+		return ""
+	}
+	return "####" + giftEscape(feedback)
+}
+
+// giftEscape escapes the characters GIFT gives a meaning to, and newlines.
+func giftEscape(text string) string {
+	var escaped strings.Builder
+	for _, r := range text {
+		switch r {
+		case '\\', '~', '=', '#', '{', '}', ':':
+			escaped.WriteRune('\\')
+			escaped.WriteRune(r)
+		case '\n':
+			escaped.WriteString(`\n`)
+		case '\r':
+		default:
+			escaped.WriteRune(r)
+		}
+	}
+	return escaped.String()
+}
+
+// MoodleQuiz is a Moodle XML question file.
+type MoodleQuiz struct {
+	XMLName   xml.Name         `xml:"quiz"`
+	Questions []MoodleQuestion `xml:"question"`
+}
+
+// MoodleQuestion is a question, or with type "category" the category of the
+// questions that follow it. Its source is kept in an XML comment.
+type MoodleQuestion struct {
+	Type            string         `xml:"type,attr"`
+	Source          string         `xml:",comment"`
+	Category        *MoodleText    `xml:"category,omitempty"`
+	Name            *MoodleText    `xml:"name,omitempty"`
+	QuestionText    *MoodleText    `xml:"questiontext,omitempty"`
+	GeneralFeedback *MoodleText    `xml:"generalfeedback,omitempty"`
+	DefaultGrade    string         `xml:"defaultgrade,omitempty"`
+	ResponseFormat  string         `xml:"responseformat,omitempty"`
+	GraderInfo      *MoodleText    `xml:"graderinfo,omitempty"`
+	Single          string         `xml:"single,omitempty"`
+	ShuffleAnswers  string         `xml:"shuffleanswers,omitempty"`
+	AnswerNumbering string         `xml:"answernumbering,omitempty"`
+	Answers         []MoodleAnswer `xml:"answer"`
+	Tags            *MoodleTags    `xml:"tags,omitempty"`
+}
+
+type MoodleText struct {
+	Format string `xml:"format,attr,omitempty"`
+	Text   string `xml:"text"`
+}
+
+type MoodleTags struct {
+	Tags []MoodleText `xml:"tag"`
+}
+
+type MoodleAnswer struct {
+	Fraction int    `xml:"fraction,attr"`
+	Format   string `xml:"format,attr"`
+	Text     string `xml:"text"`
+}
+
+// MoodleXMLExporter writes cards as Moodle XML with WriteMoodleXML.
+type MoodleXMLExporter struct{}
+
+func (e *MoodleXMLExporter) Name() string {
+	return "moodle"
+}
+
+func (e *MoodleXMLExporter) Extension() string {
+	return ".xml"
+}
+
+func (e *MoodleXMLExporter) Export(ctx context.Context, cards []ankify.AnkiQuestion, options Options) error {
+	return writeFile(options.Path, func(w io.Writer) error {
+		return WriteMoodleXML(w, options.Deck, cards)
+	})
+}
+
+// WriteMoodleXML writes the cards as Moodle XML questions, in one category per
+// source document under the deck. Basic cards become essay questions with
+// the answer as general feedback and grader information, multiple-choice
+// cards become single answer multiple-choice questions, and cloze cards
+// become embedded answers (Cloze) questions with a short answer per deletion.
+func WriteMoodleXML(w io.Writer, deck string, cards []ankify.AnkiQuestion) error {
+	quiz := MoodleQuiz{}
+	for _, group := range groupByDocument(cards) {
+		quiz.Questions = append(quiz.Questions, MoodleQuestion{
+			Type:     "category",
+			Category: &MoodleText{Text: moodleCategory(deck, group.Document)},
+		})
+		for _, card := range group.Cards {
+			quiz.Questions = append(quiz.Questions, newMoodleQuestion(card))
+		}
+	}
+
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+	encoder := xml.NewEncoder(w)
+	encoder.Indent("", "  ")
+	if err := encoder.Encode(quiz); err != nil {
+		return err
+	}
+	_, err := io.WriteString(w, "\n")
+	return err
+}
+
+func newMoodleQuestion(card ankify.AnkiQuestion) MoodleQuestion {
+	question := MoodleQuestion{
+		Name:         &MoodleText{Text: questionName(card.Question)},
+		QuestionText: &MoodleText{Format: "html", Text: toHTML(card.Question)},
+		DefaultGrade: "1",
+		Source:       sourceComment(card.Source),
+	}
+	if tags := strings.Fields(card.Tag); len(tags) > 0 {
+		question.Tags = &MoodleTags{}
+		for _, tag := range tags {
+			question.Tags.Tags = append(question.Tags.Tags, MoodleText{Text: tag})
+		}
+	}
+
+	switch card.Type {
+	case ankify.CARD_TYPE_MULTIPLE_CHOICE:
+		question.Type = "multichoice"
+		question.Single = "true"
+		question.ShuffleAnswers = "true"
+		question.AnswerNumbering = "ABCD"
+		question.Answers = []MoodleAnswer{{Fraction: 100, Format: "html", Text: toHTML(card.Answer)}}
+		if card.Choices != nil {
+			for _, distractor := range card.Choices.Distractors {
+				question.Answers = append(question.Answers, MoodleAnswer{Fraction: 0, Format: "html", Text: toHTML(distractor)})
+			}
+			question.GeneralFeedback = &MoodleText{Format: "html", Text: toHTML(card.Choices.Explanation)}
+		}
+	case ankify.CARD_TYPE_CLOZE:
+		question.Type = "cloze"
+		question.QuestionText.Text = moodleCloze(card.Question)
+		question.GeneralFeedback = &MoodleText{Format: "html", Text: toHTML(card.Answer)}
+		question.DefaultGrade = ""
+	default:
+		question.Type = "essay"
+		question.GeneralFeedback = &MoodleText{Format: "html", Text: toHTML(card.Answer)}
+		question.ResponseFormat = "editor"
+		question.GraderInfo = &MoodleText{Format: "html", Text: toHTML(card.Answer)}
+	}
+	return question
+}
+
+// moodleHTML escapes the HTML of an embedded answer, whose quotes are
+// escaped with a backslash instead.
+var moodleHTML = strings.NewReplacer("&", "&amp;", "<", "&lt;", ">", "&gt;")
+
+// moodleCloze turns cloze deletions into Moodle's embedded short answers,
+// e.g. {{c1::Paris}} into {1:SHORTANSWER:=Paris}.
+func moodleCloze(text string) string {
+	var question strings.Builder
+	last := 0
+	for _, match := range ankify.ClozeDeletion.FindAllStringSubmatchIndex(text, -1) {
+		question.WriteString(toHTML(text[last:match[0]]))
+		answer := text[match[4]:match[5]]
+		for _, special := range []string{`\`, "}", "#", "~", "/", `"`} {
+			answer = strings.ReplaceAll(answer, special, `\`+special)
+		}
+		question.WriteString("{1:SHORTANSWER:=" + moodleHTML.Replace(answer) + "}")
+		last = match[1]
+	}
+	question.WriteString(toHTML(text[last:]))
+	return question.String()
+}
@@ -0,0 +1,127 @@
+package exporter
+
+import (
+	"bytes"
+	"encoding/xml"
+	"strings"
+	"testing"
+
+	"github.com/acrucetta/anki-builder/pkg/ankify"
+)
+
+// quizCards has a card of each type, from two documents.
+var quizCards = []ankify.AnkiQuestion{
+	{Question: "What does a goroutine cost?", Answer: "A few kilobytes: 2 KB", Tag: "go", Source: ankify.Source{Document: "go.pdf", Page: 12, Section: "Goroutines"}},
+	{Question: "{{c1::Paris}} is the capital of {{c2::France}}, {{c2::Spain}}'s neighbour.", Answer: "Since 508.", Type: ankify.CARD_TYPE_CLOZE, Source: ankify.Source{Document: "https://example.org/paris"}},
+	{Question: "Which keyword starts a goroutine?", Answer: "go", Type: ankify.CARD_TYPE_MULTIPLE_CHOICE, Choices: &ankify.MultipleChoice{Distractors: []string{"async", "spawn"}, Explanation: "Prefix a call with it."}, Source: ankify.Source{Document: "go.pdf", Page: 13}},
+}
+
+func TestWriteGIFT(t *testing.T) {
+
+	// Arrange
+	var buffer bytes.Buffer
+
+	// Act
+	err := WriteGIFT(&buffer, "Books::Go", quizCards)
+
+	// Assert
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `$CATEGORY: $course$/top/Books/Go/go.pdf
+
+// Source: go.pdf, page 12, Goroutines
+// [tag:go]
+::What does a goroutine cost?::What does a goroutine cost? {####A few kilobytes\: 2 KB}
+
+// Source: go.pdf, page 13
+::Which keyword starts a goroutine?::Which keyword starts a goroutine? {
+	=go
+	~async
+	~spawn
+	####Prefix a call with it.
+}
+
+$CATEGORY: $course$/top/Books/Go/https:////example.org//paris
+
+// Source: https://example.org/paris
+::Paris is the capital of France, Spain's neighbour. (c1)::{=Paris####Since 508.} is the capital of France, Spain's neighbour.
+
+// Source: https://example.org/paris
+::Paris is the capital of France, Spain's neighbour. (c2)::Paris is the capital of [...], [...]'s neighbour. {####France, Spain\nSince 508.}
+
+`
+	if buffer.String() != want {
+		t.Errorf("Expected:\n%s\ngot:\n%s", want, buffer.String())
+	}
+}
+
+func TestWriteMoodleXML(t *testing.T) {
+
+	// Arrange
+	var buffer bytes.Buffer
+
+	// Act
+	err := WriteMoodleXML(&buffer, "Books::Go", quizCards)
+
+	// Assert
+	if err != nil {
+		t.Fatal(err)
+	}
+	var quiz MoodleQuiz
+	if err := xml.Unmarshal(buffer.Bytes(), &quiz); err != nil {
+		t.Fatal(err)
+	}
+	types := []string{}
+	for _, question := range quiz.Questions {
+		types = append(types, question.Type)
+	}
+	if strings.Join(types, ",") != "category,essay,multichoice,category,cloze" {
+		t.Fatalf("Unexpected questions %q", types)
+	}
+	if category := quiz.Questions[0].Category.Text; category != "$course$/top/Books/Go/go.pdf" {
+		t.Errorf("Unexpected category %q", category)
+	}
+	essay := quiz.Questions[1]
+	if essay.GraderInfo.Text != "A few kilobytes: 2 KB" || essay.Source != " Source: go.pdf, page 12, Goroutines " || essay.Tags.Tags[0].Text != "go" {
+		t.Errorf("Unexpected essay question %+v", essay)
+	}
+	choice := quiz.Questions[2]
+	if len(choice.Answers) != 3 || choice.Answers[0].Fraction != 100 || choice.Answers[0].Text != "go" || choice.Answers[1].Fraction != 0 {
+		t.Errorf("Unexpected answers %+v", choice.Answers)
+	}
+	want := "{1:SHORTANSWER:=Paris} is the capital of {1:SHORTANSWER:=France}, {1:SHORTANSWER:=Spain}&#39;s neighbour."
+	if cloze := quiz.Questions[4].QuestionText.Text; cloze != want {
+		t.Errorf("Expected %q, got %q", want, cloze)
+	}
+}
+
+func TestWriteMoodleXMLDashedSource(t *testing.T) {
+
+	// Arrange
+	var buffer bytes.Buffer
+	cards := []ankify.AnkiQuestion{{Question: "What is a dash?", Answer: "A punctuation mark.", Source: ankify.Source{Document: "https://x.com/a---b-"}}}
+
+	// Act
+	err := WriteMoodleXML(&buffer, "Dashes", cards)
+
+	// Assert
+	if err != nil {
+		t.Fatal(err)
+	}
+	var quiz MoodleQuiz
+	if err := xml.Unmarshal(buffer.Bytes(), &quiz); err != nil {
+		t.Fatalf("Expected well-formed XML, got %v", err)
+	}
+	if source := quiz.Questions[1].Source; source != " Source: https://x.com/a- - -b- " {
+		t.Errorf("Unexpected source comment %q", source)
+	}
+}
+
+func TestMoodleCloze(t *testing.T) {
+	got := moodleCloze(`{{c1::a/b "c" & d}} < e`)
+	want := `{1:SHORTANSWER:=a\/b \"c\" &amp; d} &lt; e`
+	if got != want {
+		t.Errorf("Expected %q, got %q", want, got)
+	}
+}
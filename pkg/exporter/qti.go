@@ -0,0 +1,273 @@
+package exporter
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/acrucetta/anki-builder/pkg/ankify"
+)
+
+// Namespaces, schemas and resource types of an IMS QTI 2.1 content package.
+const (
+	QTI_NAMESPACE       = "http://www.imsglobal.org/xsd/imsqti_v2p1"
+	QTI_SCHEMA_LOCATION = "http://www.imsglobal.org/xsd/imsqti_v2p1 http://www.imsglobal.org/xsd/qti/qtiv2p1/imsqti_v2p1.xsd"
+	QTI_MATCH_CORRECT   = "http://www.imsglobal.org/question/qti_v2p1/rptemplates/match_correct"
+	IMSCP_NAMESPACE     = "http://www.imsglobal.org/xsd/imscp_v1p1"
+	XSI_NAMESPACE       = "http://www.w3.org/2001/XMLSchema-instance"
+	QTI_ITEM_RESOURCE   = "imsqti_item_xmlv2p1"
+	QTI_TEST_RESOURCE   = "imsqti_test_xmlv2p1"
+)
+
+// QTI_MANIFEST_FILE lists the files of a QTI package.
+const QTI_MANIFEST_FILE = "imsmanifest.xml"
+
+// QTI_RESPONSE identifies the response of an item.
+const QTI_RESPONSE = "RESPONSE"
+
+type QTIItem struct {
+	XMLName        xml.Name             `xml:"assessmentItem"`
+	Namespace      string               `xml:"xmlns,attr"`
+	XSI            string               `xml:"xmlns:xsi,attr"`
+	SchemaLocation string               `xml:"xsi:schemaLocation,attr"`
+	Identifier     string               `xml:"identifier,attr"`
+	Title          string               `xml:"title,attr"`
+	Label          string               `xml:"label,attr,omitempty"`
+	Adaptive       bool                 `xml:"adaptive,attr"`
+	TimeDependent  bool                 `xml:"timeDependent,attr"`
+	Responses      []QTIResponse        `xml:"responseDeclaration"`
+	Outcomes       []QTIOutcome         `xml:"outcomeDeclaration"`
+	Body           QTIBody              `xml:"itemBody"`
+	Processing     *QTIResponseTemplate `xml:"responseProcessing,omitempty"`
+}
+
+type QTIResponse struct {
+	Identifier  string   `xml:"identifier,attr"`
+	Cardinality string   `xml:"cardinality,attr"`
+	BaseType    string   `xml:"baseType,attr"`
+	Correct     []string `xml:"correctResponse>value"`
+}
+
+type QTIOutcome struct {
+	Identifier  string `xml:"identifier,attr"`
+	Cardinality string `xml:"cardinality,attr"`
+	BaseType    string `xml:"baseType,attr"`
+}
+
+// QTIBody is the XHTML content of an item, with its interactions.
+type QTIBody struct {
+	Content string `xml:",innerxml"`
+}
+
+type QTIResponseTemplate struct {
+	Template string `xml:"template,attr"`
+}
+
+type QTITest struct {
+	XMLName    xml.Name    `xml:"assessmentTest"`
+	Namespace  string      `xml:"xmlns,attr"`
+	Identifier string      `xml:"identifier,attr"`
+	Title      string      `xml:"title,attr"`
+	Part       QTITestPart `xml:"testPart"`
+}
+
+type QTITestPart struct {
+	Identifier     string     `xml:"identifier,attr"`
+	NavigationMode string     `xml:"navigationMode,attr"`
+	SubmissionMode string     `xml:"submissionMode,attr"`
+	Section        QTISection `xml:"assessmentSection"`
+}
+
+type QTISection struct {
+	Identifier string       `xml:"identifier,attr"`
+	Title      string       `xml:"title,attr"`
+	Visible    bool         `xml:"visible,attr"`
+	Items      []QTIItemRef `xml:"assessmentItemRef"`
+}
+
+type QTIItemRef struct {
+	Identifier string `xml:"identifier,attr"`
+	Href       string `xml:"href,attr"`
+}
+
+// QTIManifest is the imsmanifest.xml listing the files of a package.
+type QTIManifest struct {
+	XMLName       xml.Name      `xml:"manifest"`
+	Namespace     string        `xml:"xmlns,attr"`
+	Identifier    string        `xml:"identifier,attr"`
+	Schema        string        `xml:"metadata>schema"`
+	SchemaVersion string        `xml:"metadata>schemaversion"`
+	Organizations string        `xml:"organizations"`
+	Resources     []QTIResource `xml:"resources>resource"`
+}
+
+type QTIResource struct {
+	Identifier   string          `xml:"identifier,attr"`
+	Type         string          `xml:"type,attr"`
+	Href         string          `xml:"href,attr"`
+	Files        []QTIFile       `xml:"file"`
+	Dependencies []QTIDependency `xml:"dependency"`
+}
+
+type QTIFile struct {
+	Href string `xml:"href,attr"`
+}
+
+type QTIDependency struct {
+	Identifier string `xml:"identifierref,attr"`
+}
+
+// QTIExporter writes cards to an IMS QTI 2.1 package with WriteQTI.
+type QTIExporter struct{}
+
+func (e *QTIExporter) Name() string {
+	return "qti"
+}
+
+func (e *QTIExporter) Extension() string {
+	return ".zip"
+}
+
+func (e *QTIExporter) Export(ctx context.Context, cards []ankify.AnkiQuestion, options Options) error {
+	return writeFile(options.Path, func(w io.Writer) error {
+		return WriteQTI(w, options.Deck, cards)
+	})
+}
+
+// WriteQTI writes the cards as an IMS QTI 2.1 content package: a zip with an
+// assessment item per card and an assessment test per source document,
+// titled with the deck and the document. Basic cards become extended text
+// items with the answer as their correct response, multiple-choice cards
+// become choice items scored with match_correct, and cloze cards become text
+// entry items with a blank per deletion. The item label holds the card's
+// source.
+func WriteQTI(w io.Writer, deck string, cards []ankify.AnkiQuestion) error {
+	if deck == "" {
+		deck = DEFAULT_DECK_NAME
+	}
+	archive := zip.NewWriter(w)
+	manifest := QTIManifest{
+		Namespace:     IMSCP_NAMESPACE,
+		Identifier:    "MANIFEST-" + shortID(deck),
+		Schema:        "QTIv2.1 Package",
+		SchemaVersion: "1.0.0",
+	}
+	items := []QTIResource{}
+	seen := map[string]int{}
+	for _, group := range groupByDocument(cards) {
+		document := group.Document
+		if document == "" {
+			document = deck
+		}
+		test := QTITest{
+			Namespace:  QTI_NAMESPACE,
+			Identifier: "test-" + shortID(deck+"\x1f"+document),
+			Title:      deck + ": " + document,
+			Part: QTITestPart{
+				Identifier:     "part-1",
+				NavigationMode: "nonlinear",
+				SubmissionMode: "simultaneous",
+				Section:        QTISection{Identifier: "section-1", Title: document, Visible: true},
+			},
+		}
+		test_resource := QTIResource{Identifier: test.Identifier, Type: QTI_TEST_RESOURCE, Href: test.Identifier + ".xml"}
+
+		for _, card := range group.Cards {
+			item := newQTIItem(card)
+			// Repeated questions would get the same identifier
+			seen[item.Identifier]++
+			if count := seen[item.Identifier]; count > 1 {
+				item.Identifier = fmt.Sprintf("%s-%d", item.Identifier, count)
+			}
+			href := "items/" + item.Identifier + ".xml"
+			if err := writeXMLFile(archive, href, item); err != nil {
+				return err
+			}
+			test.Part.Section.Items = append(test.Part.Section.Items, QTIItemRef{Identifier: item.Identifier, Href: href})
+			test_resource.Dependencies = append(test_resource.Dependencies, QTIDependency{Identifier: item.Identifier})
+			items = append(items, QTIResource{Identifier: item.Identifier, Type: QTI_ITEM_RESOURCE, Href: href, Files: []QTIFile{{Href: href}}})
+		}
+
+		if err := writeXMLFile(archive, test_resource.Href, test); err != nil {
+			return err
+		}
+		test_resource.Files = []QTIFile{{Href: test_resource.Href}}
+		manifest.Resources = append(manifest.Resources, test_resource)
+	}
+	manifest.Resources = append(manifest.Resources, items...)
+	if err := writeXMLFile(archive, QTI_MANIFEST_FILE, manifest); err != nil {
+		return err
+	}
+	return archive.Close()
+}
+
+func newQTIItem(card ankify.AnkiQuestion) QTIItem {
+	item := QTIItem{
+		Namespace:      QTI_NAMESPACE,
+		XSI:            XSI_NAMESPACE,
+		SchemaLocation: QTI_SCHEMA_LOCATION,
+		Identifier:     "item-" + shortID(card.Question),
+		Title:          questionName(card.Question),
+		Label:          sourceLabel(card.Source),
+		Outcomes:       []QTIOutcome{{Identifier: "SCORE", Cardinality: "single", BaseType: "float"}},
+	}
+
+	var body strings.Builder
+	switch card.Type {
+	case ankify.CARD_TYPE_MULTIPLE_CHOICE:
+		item.Responses = []QTIResponse{{Identifier: QTI_RESPONSE, Cardinality: "single", BaseType: "identifier", Correct: []string{"CHOICE_1"}}}
+		item.Processing = &QTIResponseTemplate{Template: QTI_MATCH_CORRECT}
+		options := []string{card.Answer}
+		if card.Choices != nil {
+			options = append(options, card.Choices.Distractors...)
+		}
+		body.WriteString(fmt.Sprintf(`<choiceInteraction responseIdentifier="%s" shuffle="true" maxChoices="1">`, QTI_RESPONSE))
+		body.WriteString("<prompt>" + xhtml(card.Question) + "</prompt>")
+		for i, option := range options {
+			body.WriteString(fmt.Sprintf(`<simpleChoice identifier="CHOICE_%d">%s</simpleChoice>`, i+1, xhtml(option)))
+		}
+		body.WriteString("</choiceInteraction>")
+	case ankify.CARD_TYPE_CLOZE:
+		body.WriteString("<p>")
+		last := 0
+		for i, match := range ankify.ClozeDeletion.FindAllStringSubmatchIndex(card.Question, -1) {
+			identifier := fmt.Sprintf("%s_%d", QTI_RESPONSE, i+1)
+			deleted := card.Question[match[4]:match[5]]
+			item.Responses = append(item.Responses, QTIResponse{Identifier: identifier, Cardinality: "single", BaseType: "string", Correct: []string{deleted}})
+			body.WriteString(xhtml(card.Question[last:match[0]]))
+			body.WriteString(fmt.Sprintf(`<textEntryInteraction responseIdentifier="%s" expectedLength="%d"/>`, identifier, len([]rune(deleted))))
+			last = match[1]
+		}
+		body.WriteString(xhtml(card.Question[last:]) + "</p>")
+	default:
+		item.Responses = []QTIResponse{{Identifier: QTI_RESPONSE, Cardinality: "single", BaseType: "string", Correct: []string{card.Answer}}}
+		body.WriteString("<p>" + xhtml(card.Question) + "</p>")
+		body.WriteString(fmt.Sprintf(`<extendedTextInteraction responseIdentifier="%s" expectedLines="5"/>`, QTI_RESPONSE))
+	}
+	item.Body.Content = body.String()
+	return item
+}
+
+// xhtml escapes text for an XHTML element, with newlines as <br/>.
+func xhtml(text string) string {
+	var escaped bytes.Buffer
+	xml.EscapeText(&escaped, []byte(text))
+	return strings.ReplaceAll(escaped.String(), "&#xA;", "<br/>")
+}
+
+func writeXMLFile(archive *zip.Writer, name string, value interface{}) error {
+	file, err := archive.Create(name)
+	if err != nil {
+		return err
+	}
+	if _, err := io.WriteString(file, xml.Header); err != nil {
+		return err
+	}
+	encoder := xml.NewEncoder(file)
+	encoder.Indent("", "  ")
+	return encoder.Encode(value)
+}
@@ -0,0 +1,61 @@
+package exporter
+
+import (
+	"bytes"
+	"encoding/xml"
+	"strings"
+	"testing"
+)
+
+func TestWriteQTI(t *testing.T) {
+
+	// Arrange
+	var buffer bytes.Buffer
+
+	// Act
+	err := WriteQTI(&buffer, "Books::Go", quizCards)
+
+	// Assert
+	if err != nil {
+		t.Fatal(err)
+	}
+	var manifest QTIManifest
+	if err := xml.Unmarshal(zipFile(t, buffer.Bytes(), QTI_MANIFEST_FILE), &manifest); err != nil {
+		t.Fatal(err)
+	}
+	if len(manifest.Resources) != 5 {
+		t.Fatalf("Expected 2 tests and 3 items, got %+v", manifest.Resources)
+	}
+
+	// One test per document, holding that document's items
+	var test QTITest
+	if err := xml.Unmarshal(zipFile(t, buffer.Bytes(), manifest.Resources[0].Href), &test); err != nil {
+		t.Fatal(err)
+	}
+	section := test.Part.Section
+	if test.Title != "Books::Go: go.pdf" || section.Title != "go.pdf" || len(section.Items) != 2 {
+		t.Fatalf("Unexpected test %+v", test)
+	}
+
+	items := []QTIItem{}
+	for _, ref := range append(section.Items, QTIItemRef{Href: manifest.Resources[4].Href}) {
+		var item QTIItem
+		if err := xml.Unmarshal(zipFile(t, buffer.Bytes(), ref.Href), &item); err != nil {
+			t.Fatal(err)
+		}
+		items = append(items, item)
+	}
+	essay, choice, cloze := items[0], items[1], items[2]
+	if essay.Label != "go.pdf, page 12, Goroutines" || essay.Responses[0].Correct[0] != "A few kilobytes: 2 KB" || !strings.Contains(essay.Body.Content, "<extendedTextInteraction") {
+		t.Errorf("Unexpected essay item %+v", essay)
+	}
+	if choice.Processing == nil || choice.Processing.Template != QTI_MATCH_CORRECT || strings.Count(choice.Body.Content, "<simpleChoice") != 3 {
+		t.Errorf("Unexpected choice item %+v", choice)
+	}
+	if !strings.Contains(choice.Body.Content, `<simpleChoice identifier="`+choice.Responses[0].Correct[0]+`">go</simpleChoice>`) {
+		t.Errorf("Expected the correct response to be the 'go' choice, got %s", choice.Body.Content)
+	}
+	if len(cloze.Responses) != 3 || cloze.Responses[2].Correct[0] != "Spain" || strings.Count(cloze.Body.Content, "<textEntryInteraction") != 3 {
+		t.Errorf("Unexpected cloze item %+v", cloze)
+	}
+}
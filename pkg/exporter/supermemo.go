@@ -0,0 +1,105 @@
+package exporter
+
+import (
+	"bufio"
+	"context"
+	"io"
+	"strings"
+
+	"github.com/acrucetta/anki-builder/pkg/ankify"
+)
+
+// Line labels of the Q&A text format SuperMemo and RemNote import.
+const (
+	QA_QUESTION_LABEL = "Q:"
+	QA_ANSWER_LABEL   = "A:"
+	QA_SOURCE_LABEL   = "Source:"
+)
+
+// SuperMemoExporter writes cards as Q&A text with WriteQA.
+type SuperMemoExporter struct{}
+
+func (e *SuperMemoExporter) Name() string {
+	return "supermemo"
+}
+
+func (e *SuperMemoExporter) Extension() string {
+	return ".txt"
+}
+
+func (e *SuperMemoExporter) Export(ctx context.Context, cards []ankify.AnkiQuestion, options Options) error {
+	return writeFile(options.Path, func(w io.Writer) error {
+		return WriteQA(w, cards)
+	})
+}
+
+// WriteQA writes the cards as Q&A text, the plain format SuperMemo and
+// RemNote import: every line of a question starts with "Q: ", every line of
+// its answer with "A: ", and cards are separated by a blank line. The last
+// answer line names the card's source. Cloze cards become one question per
+// deletion number, see plainCards.
+func WriteQA(w io.Writer, cards []ankify.AnkiQuestion) error {
+	var text strings.Builder
+	for _, card := range cards {
+		label := sourceLabel(card.Source)
+		for _, plain := range plainCards(card) {
+			if text.Len() > 0 {
+				text.WriteString("\n")
+			}
+			writeLabeled(&text, QA_QUESTION_LABEL, plain.Front)
+			writeLabeled(&text, QA_ANSWER_LABEL, plain.Back)
+			if label != "" {
+				text.WriteString(QA_ANSWER_LABEL + " " + QA_SOURCE_LABEL + " " + label + "\n")
+			}
+		}
+	}
+	_, err := io.WriteString(w, text.String())
+	return err
+}
+
+// writeLabeled writes each non-blank line of lines after the label.
+func writeLabeled(text *strings.Builder, label string, lines string) {
+	for _, line := range strings.Split(strings.TrimSpace(lines), "\n") {
+		if line = strings.TrimSpace(line); line != "" {
+			text.WriteString(label + " " + line + "\n")
+		}
+	}
+}
+
+// ReadQA reads Q&A text written by WriteQA back into basic cards. An answer
+// line starting with "Source: " at the end of a card is read as its source.
+func ReadQA(r io.Reader) ([]ankify.AnkiQuestion, error) {
+	cards := []ankify.AnkiQuestion{}
+	var question, answer []string
+	flush := func() {
+		if len(question) == 0 {
+			return
+		}
+		card := ankify.AnkiQuestion{Question: strings.Join(question, "\n"), Type: ankify.CARD_TYPE_BASIC}
+		if last := len(answer) - 1; last >= 0 && strings.HasPrefix(answer[last], QA_SOURCE_LABEL) {
+			card.Source = parseSourceLabel(strings.TrimPrefix(answer[last], QA_SOURCE_LABEL))
+			answer = answer[:last]
+		}
+		card.Answer = strings.Join(answer, "\n")
+		cards = append(cards, card)
+		question, answer = nil, nil
+	}
+
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := strings.TrimRight(scanner.Text(), " \t\r")
+		switch {
+		case strings.HasPrefix(line, QA_QUESTION_LABEL):
+			if len(answer) > 0 {
+				flush()
+			}
+			question = append(question, strings.TrimSpace(strings.TrimPrefix(line, QA_QUESTION_LABEL)))
+		case strings.HasPrefix(line, QA_ANSWER_LABEL):
+			answer = append(answer, strings.TrimSpace(strings.TrimPrefix(line, QA_ANSWER_LABEL)))
+		case line == "":
+			flush()
+		}
+	}
+	flush()
+	return cards, scanner.Err()
+}
@@ -0,0 +1,61 @@
+package exporter
+
+import (
+	"bytes"
+	"os"
+	"testing"
+
+	"github.com/acrucetta/anki-builder/pkg/ankify"
+)
+
+func TestQARoundTrip(t *testing.T) {
+
+	// Arrange
+	sample, err := os.ReadFile("testdata/qa.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Act
+	cards, err := ReadQA(bytes.NewReader(sample))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var written bytes.Buffer
+	err = WriteQA(&written, cards)
+
+	// Assert
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(cards) != 4 {
+		t.Fatalf("Expected 4 cards, got %+v", cards)
+	}
+	want := ankify.AnkiQuestion{
+		Question: "[...] connect goroutines.",
+		Answer:   "Channels\nShare memory by communicating.",
+		Type:     ankify.CARD_TYPE_BASIC,
+		Source:   ankify.Source{Document: "go.pdf", Page: 13},
+	}
+	if cards[1] != want {
+		t.Errorf("Expected %+v, got %+v", want, cards[1])
+	}
+	if written.String() != string(sample) {
+		t.Errorf("Writing the sample back changed it:\n%s", written.String())
+	}
+}
+
+func TestWriteQACloze(t *testing.T) {
+	cards := []ankify.AnkiQuestion{
+		{Question: "{{c1::Paris::city}} is the capital of {{c2::France}}, {{c1::Berlin}} of Germany.", Type: ankify.CARD_TYPE_CLOZE},
+	}
+	var written bytes.Buffer
+	if err := WriteQA(&written, cards); err != nil {
+		t.Fatal(err)
+	}
+	want := "Q: [city] is the capital of France, [...] of Germany.\nA: Paris, Berlin\n\n" +
+		"Q: Paris is the capital of [...], Berlin of Germany.\nA: France\n"
+	if written.String() != want {
+		t.Errorf("Expected:\n%s\ngot:\n%s", want, written.String())
+	}
+}
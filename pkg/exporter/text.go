@@ -0,0 +1,127 @@
+package exporter
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/acrucetta/anki-builder/pkg/ankify"
+)
+
+// plainCard is one side pair of a card for formats that only know questions
+// and answers.
+type plainCard struct {
+	Front string
+	Back  string
+}
+
+// plainCards renders a card as plain questions and answers. Multiple-choice
+// cards list their lettered options in the front and give the correct letter
+// and the explanation in the back. A cloze card becomes one card per
+// deletion number, with those deletions shown as [...] (or their hint) in the
+// front and their text in the back.
+func plainCards(card ankify.AnkiQuestion) []plainCard {
+	switch card.Type {
+	case ankify.CARD_TYPE_MULTIPLE_CHOICE:
+		front, back := choiceText(card)
+		return []plainCard{{Front: front, Back: back}}
+	case ankify.CARD_TYPE_CLOZE:
+		cards := []plainCard{}
+		for _, number := range ankify.ClozeNumbers(card.Question) {
+			hidden := []string{}
+			front := ankify.ClozeDeletion.ReplaceAllStringFunc(card.Question, func(deletion string) string {
+				match := ankify.ClozeDeletion.FindStringSubmatch(deletion)
+				if match[1] != strconv.Itoa(number) {
+					return match[2]
+				}
+				hidden = append(hidden, match[2])
+				if match[3] != "" {
+					return "[" + match[3] + "]"
+				}
+				return "[...]"
+			})
+			back := strings.Join(hidden, ", ")
+			if strings.TrimSpace(card.Answer) != "" {
+				back += "\n" + card.Answer
+			}
+			cards = append(cards, plainCard{Front: front, Back: back})
+		}
+		return cards
+	default:
+		return []plainCard{{Front: card.Question, Back: card.Answer}}
+	}
+}
+
+// choiceText renders a multiple-choice card as a question followed by its
+// lettered options, and the correct letter and option followed by the
+// explanation.
+func choiceText(card ankify.AnkiQuestion) (string, string) {
+	options, correct := card.Options()
+	question := card.Question
+	for i, option := range options {
+		question += fmt.Sprintf("\n%c. %s", 'A'+i, option)
+	}
+	answer := fmt.Sprintf("%c. %s", 'A'+correct, card.Answer)
+	if card.Choices != nil && card.Choices.Explanation != "" {
+		answer += "\n" + card.Choices.Explanation
+	}
+	return question, answer
+}
+
+var sourcePage = regexp.MustCompile(`^page (\d+)$`)
+
+// parseSourceLabel reads back a label written by sourceLabel. The chunk is
+// not part of the label and is left at 0.
+func parseSourceLabel(label string) ankify.Source {
+	parts := strings.Split(strings.TrimSpace(label), ", ")
+	for i, part := range parts {
+		if match := sourcePage.FindStringSubmatch(part); match != nil {
+			page, _ := strconv.Atoi(match[1])
+			return ankify.Source{
+				Document: strings.Join(parts[:i], ", "),
+				Page:     page,
+				Section:  strings.Join(parts[i+1:], ", "),
+			}
+		}
+	}
+	return ankify.Source{Document: strings.TrimSpace(label)}
+}
+
+// documentGroup holds the cards written from one document.
+type documentGroup struct {
+	Document string
+	Cards    []ankify.AnkiQuestion
+}
+
+// groupByDocument groups the cards by their source document, in the order
+// the documents first appear.
+func groupByDocument(cards []ankify.AnkiQuestion) []documentGroup {
+	groups := []documentGroup{}
+	index := map[string]int{}
+	for _, card := range cards {
+		i, ok := index[card.Source.Document]
+		if !ok {
+			i = len(groups)
+			index[card.Source.Document] = i
+			groups = append(groups, documentGroup{Document: card.Source.Document})
+		}
+		groups[i].Cards = append(groups[i].Cards, card)
+	}
+	return groups
+}
+
+// QUESTION_NAME_LENGTH is the length in characters of the names quiz
+// formats give questions.
+const QUESTION_NAME_LENGTH = 60
+
+// questionName names a question after the start of its first line, with cloze
+// deletions shown.
+func questionName(question string) string {
+	line, _, _ := strings.Cut(strings.TrimSpace(ankify.ClozeText(question)), "\n")
+	name := []rune(strings.Join(strings.Fields(line), " "))
+	if len(name) > QUESTION_NAME_LENGTH {
+		return strings.TrimSpace(string(name[:QUESTION_NAME_LENGTH-1])) + "…"
+	}
+	return string(name)
+}
@@ -0,0 +1,471 @@
+// Package store keeps every ankify run in a local SQLite database: the
+// documents read, the chunks sent to the model, the prompts and model used,
+// the cards written, where they were exported and their embeddings.
+package store
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/acrucetta/anki-builder/pkg/ankify"
+	_ "github.com/mattn/go-sqlite3"
+)
+
+// DEFAULT_STORE_PATH is where the store is kept when neither --store nor
+// ANKIFY_STORE is set.
+const DEFAULT_STORE_PATH = "output/ankify.db"
+
+// SCHEMA_VERSION is the version of SCHEMA, kept in the database's user_version.
+const SCHEMA_VERSION = 2
+
+// SCHEMA creates the tables of the store.
+const SCHEMA = `
+CREATE TABLE IF NOT EXISTS sources (
+	id INTEGER PRIMARY KEY,
+	document TEXT NOT NULL UNIQUE,
+	file_type TEXT NOT NULL,
+	first_seen TIMESTAMP NOT NULL
+);
+CREATE TABLE IF NOT EXISTS runs (
+	id INTEGER PRIMARY KEY,
+	source_id INTEGER NOT NULL REFERENCES sources(id),
+	started_at TIMESTAMP NOT NULL,
+	provider TEXT NOT NULL,
+	model TEXT NOT NULL,
+	prompt_version TEXT NOT NULL,
+	card_type TEXT NOT NULL
+);
+CREATE TABLE IF NOT EXISTS chunks (
+	id INTEGER PRIMARY KEY,
+	run_id INTEGER NOT NULL REFERENCES runs(id),
+	page INTEGER NOT NULL,
+	section TEXT NOT NULL,
+	chunk INTEGER NOT NULL,
+	text TEXT NOT NULL
+);
+CREATE TABLE IF NOT EXISTS cards (
+	id INTEGER PRIMARY KEY,
+	run_id INTEGER NOT NULL REFERENCES runs(id),
+	created_at TIMESTAMP NOT NULL,
+	type TEXT NOT NULL,
+	question TEXT NOT NULL,
+	answer TEXT NOT NULL,
+	choices TEXT NOT NULL,
+	tags TEXT NOT NULL,
+	page INTEGER NOT NULL,
+	section TEXT NOT NULL,
+	chunk INTEGER NOT NULL
+);
+CREATE TABLE IF NOT EXISTS exports (
+	id INTEGER PRIMARY KEY,
+	card_id INTEGER NOT NULL REFERENCES cards(id),
+	format TEXT NOT NULL,
+	destination TEXT NOT NULL,
+	exported_at TIMESTAMP NOT NULL
+);
+CREATE TABLE IF NOT EXISTS embeddings (
+	card_id INTEGER NOT NULL REFERENCES cards(id),
+	model TEXT NOT NULL,
+	vector TEXT NOT NULL,
+	PRIMARY KEY (card_id, model)
+);
+CREATE INDEX IF NOT EXISTS cards_created_at ON cards(created_at);
+CREATE INDEX IF NOT EXISTS exports_card_id ON exports(card_id);
+`
+
+// ErrNotFound is returned when a run does not exist.
+var ErrNotFound = errors.New("not found")
+
+// Store is a SQLite database of runs and their cards.
+type Store struct {
+	db *sql.DB
+	// now returns the time recorded for new rows.
+	now func() time.Time
+}
+
+// Run is one ankify run over a document.
+type Run struct {
+	ID        int64
+	StartedAt time.Time
+	Document  string
+	// FileType is "txt", "pdf" or "url".
+	FileType string
+	Provider string
+	Model    string
+	// PromptVersion is ankify.PromptVersion of the card type.
+	PromptVersion string
+	CardType      ankify.CardType
+	// Cards and Exported count the run's cards and those exported at least once.
+	Cards    int
+	Exported int
+}
+
+// Chunk is a piece of a page sent to the model.
+type Chunk struct {
+	Source ankify.Source
+	Text   string
+}
+
+// Card is a stored card with where it was exported.
+type Card struct {
+	ankify.AnkiQuestion
+	ID        int64
+	RunID     int64
+	CreatedAt time.Time
+	Exports   []Export
+}
+
+// Export records one export of a card.
+type Export struct {
+	Format string
+	// Destination is the file written, or the Anki the cards were sent to.
+	Destination string
+	ExportedAt  time.Time
+}
+
+// CardFilter selects stored cards; zero fields match every card.
+type CardFilter struct {
+	RunID int64
+	// Since keeps the cards created at or after it.
+	Since time.Time
+	// Unexported keeps the cards that were never exported.
+	Unexported bool
+	// Document keeps the cards written from the document.
+	Document string
+}
+
+// Open opens the store at path, creating it and its folder if needed.
+func Open(path string) (*Store, error) {
+	if dir := filepath.Dir(path); dir != "" {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			return nil, err
+		}
+	}
+	db, err := sql.Open("sqlite3", path+"?_foreign_keys=on&_busy_timeout=5000")
+	if err != nil {
+		return nil, err
+	}
+	// A single connection serializes writes from concurrent pages
+	db.SetMaxOpenConns(1)
+
+	var version int
+	if err := db.QueryRow("PRAGMA user_version").Scan(&version); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("opening the store %s: %w", path, err)
+	}
+	if version > SCHEMA_VERSION {
+		db.Close()
+		return nil, fmt.Errorf("the store %s has schema version %d, this ankify supports up to %d", path, version, SCHEMA_VERSION)
+	}
+	if _, err := db.Exec(SCHEMA + fmt.Sprintf("PRAGMA user_version = %d;", SCHEMA_VERSION)); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("creating the store %s: %w", path, err)
+	}
+	return &Store{db: db, now: time.Now}, nil
+}
+
+func (s *Store) Close() error {
+	return s.db.Close()
+}
+
+// StartRun records a run and its source, and returns the run's id.
+func (s *Store) StartRun(run Run) (int64, error) {
+	now := s.now().UTC()
+	if _, err := s.db.Exec(
+		"INSERT INTO sources (document, file_type, first_seen) VALUES (?, ?, ?) ON CONFLICT (document) DO NOTHING",
+		run.Document, run.FileType, now,
+	); err != nil {
+		return 0, err
+	}
+	result, err := s.db.Exec(
+		`INSERT INTO runs (source_id, started_at, provider, model, prompt_version, card_type)
+		SELECT id, ?, ?, ?, ?, ? FROM sources WHERE document = ?`,
+		now, run.Provider, run.Model, run.PromptVersion, string(run.CardType), run.Document,
+	)
+	if err != nil {
+		return 0, err
+	}
+	return result.LastInsertId()
+}
+
+// AddChunk records a chunk sent to the model during a run.
+func (s *Store) AddChunk(run_id int64, source ankify.Source, text string) error {
+	_, err := s.db.Exec(
+		"INSERT INTO chunks (run_id, page, section, chunk, text) VALUES (?, ?, ?, ?, ?)",
+		run_id, source.Page, source.Section, source.Chunk, text,
+	)
+	return err
+}
+
+// AddCards records the cards of a run and returns their ids, in order.
+func (s *Store) AddCards(run_id int64, cards []ankify.AnkiQuestion) ([]int64, error) {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	now := s.now().UTC()
+	ids := []int64{}
+	for _, card := range cards {
+		choices := []byte("null")
+		if card.Choices != nil {
+			if choices, err = json.Marshal(card.Choices); err != nil {
+				return nil, err
+			}
+		}
+		card_type := card.Type
+		if card_type == "" {
+			card_type = ankify.CARD_TYPE_BASIC
+		}
+		result, err := tx.Exec(
+			`INSERT INTO cards (run_id, created_at, type, question, answer, choices, tags, page, section, chunk)
+			VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+			run_id, now, string(card_type), card.Question, card.Answer, string(choices),
+			strings.Join(strings.Fields(card.Tag), " "), card.Source.Page, card.Source.Section, card.Source.Chunk,
+		)
+		if err != nil {
+			return nil, err
+		}
+		id, err := result.LastInsertId()
+		if err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	return ids, tx.Commit()
+}
+
+// MarkExported records that the cards were exported in format to destination.
+func (s *Store) MarkExported(card_ids []int64, format string, destination string) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	now := s.now().UTC()
+	for _, id := range card_ids {
+		if _, err := tx.Exec(
+			"INSERT INTO exports (card_id, format, destination, exported_at) VALUES (?, ?, ?, ?)",
+			id, format, destination, now,
+		); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+const runColumns = `runs.id, runs.started_at, sources.document, sources.file_type, runs.provider, runs.model, runs.prompt_version, runs.card_type,
+	(SELECT COUNT(*) FROM cards WHERE cards.run_id = runs.id),
+	(SELECT COUNT(*) FROM cards WHERE cards.run_id = runs.id AND EXISTS (SELECT 1 FROM exports WHERE exports.card_id = cards.id))
+	FROM runs JOIN sources ON sources.id = runs.source_id`
+
+// Runs returns every run, most recent first.
+func (s *Store) Runs() ([]Run, error) {
+	rows, err := s.db.Query("SELECT " + runColumns + " ORDER BY runs.started_at DESC, runs.id DESC")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	runs := []Run{}
+	for rows.Next() {
+		run, err := scanRun(rows)
+		if err != nil {
+			return nil, err
+		}
+		runs = append(runs, run)
+	}
+	return runs, rows.Err()
+}
+
+// Run returns the run with the id, or ErrNotFound.
+func (s *Store) Run(id int64) (Run, error) {
+	run, err := scanRun(s.db.QueryRow("SELECT "+runColumns+" WHERE runs.id = ?", id))
+	if errors.Is(err, sql.ErrNoRows) {
+		return run, fmt.Errorf("run %d: %w", id, ErrNotFound)
+	}
+	return run, err
+}
+
+type scanner interface {
+	Scan(dest ...interface{}) error
+}
+
+func scanRun(row scanner) (Run, error) {
+	var run Run
+	var card_type string
+	err := row.Scan(&run.ID, &run.StartedAt, &run.Document, &run.FileType, &run.Provider, &run.Model, &run.PromptVersion, &card_type, &run.Cards, &run.Exported)
+	run.CardType = ankify.CardType(card_type)
+	return run, err
+}
+
+// Chunks returns the chunks of a run, in the order they were recorded.
+func (s *Store) Chunks(run_id int64) ([]Chunk, error) {
+	rows, err := s.db.Query(
+		`SELECT sources.document, chunks.page, chunks.section, chunks.chunk, chunks.text
+		FROM chunks JOIN runs ON runs.id = chunks.run_id JOIN sources ON sources.id = runs.source_id
+		WHERE chunks.run_id = ? ORDER BY chunks.id`,
+		run_id,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	chunks := []Chunk{}
+	for rows.Next() {
+		var chunk Chunk
+		if err := rows.Scan(&chunk.Source.Document, &chunk.Source.Page, &chunk.Source.Section, &chunk.Source.Chunk, &chunk.Text); err != nil {
+			return nil, err
+		}
+		chunks = append(chunks, chunk)
+	}
+	return chunks, rows.Err()
+}
+
+// Cards returns the cards matching the filter with their exports, oldest first.
+func (s *Store) Cards(filter CardFilter) ([]Card, error) {
+	query := `SELECT cards.id, cards.run_id, cards.created_at, cards.type, cards.question, cards.answer, cards.choices, cards.tags,
+		sources.document, cards.page, cards.section, cards.chunk
+		FROM cards JOIN runs ON runs.id = cards.run_id JOIN sources ON sources.id = runs.source_id WHERE 1 = 1`
+	args := []interface{}{}
+	if filter.RunID != 0 {
+		query += " AND cards.run_id = ?"
+		args = append(args, filter.RunID)
+	}
+	if !filter.Since.IsZero() {
+		query += " AND cards.created_at >= ?"
+		args = append(args, filter.Since.UTC())
+	}
+	if filter.Document != "" {
+		query += " AND sources.document = ?"
+		args = append(args, filter.Document)
+	}
+	if filter.Unexported {
+		query += " AND NOT EXISTS (SELECT 1 FROM exports WHERE exports.card_id = cards.id)"
+	}
+	rows, err := s.db.Query(query+" ORDER BY cards.id", args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	cards := []Card{}
+	index := map[int64]int{}
+	for rows.Next() {
+		var card Card
+		var card_type, choices string
+		if err := rows.Scan(
+			&card.ID, &card.RunID, &card.CreatedAt, &card_type, &card.Question, &card.Answer, &choices, &card.Tag,
+			&card.Source.Document, &card.Source.Page, &card.Source.Section, &card.Source.Chunk,
+		); err != nil {
+			return nil, err
+		}
+		card.Type = ankify.CardType(card_type)
+		if err := json.Unmarshal([]byte(choices), &card.Choices); err != nil {
+			return nil, fmt.Errorf("card %d: %w", card.ID, err)
+		}
+		index[card.ID] = len(cards)
+		cards = append(cards, card)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	rows.Close()
+
+	exports, err := s.db.Query("SELECT card_id, format, destination, exported_at FROM exports ORDER BY id")
+	if err != nil {
+		return nil, err
+	}
+	defer exports.Close()
+	for exports.Next() {
+		var card_id int64
+		var export Export
+		if err := exports.Scan(&card_id, &export.Format, &export.Destination, &export.ExportedAt); err != nil {
+			return nil, err
+		}
+		if i, ok := index[card_id]; ok {
+			cards[i].Exports = append(cards[i].Exports, export)
+		}
+	}
+	return cards, exports.Err()
+}
+
+// Embeddings returns the vectors stored for the cards by model, by card id.
+// Cards without one are missing from the map.
+func (s *Store) Embeddings(model string, card_ids []int64) (map[int64][]float64, error) {
+	wanted := map[int64]bool{}
+	for _, id := range card_ids {
+		wanted[id] = true
+	}
+	rows, err := s.db.Query("SELECT card_id, vector FROM embeddings WHERE model = ?", model)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	vectors := map[int64][]float64{}
+	for rows.Next() {
+		var card_id int64
+		var vector string
+		if err := rows.Scan(&card_id, &vector); err != nil {
+			return nil, err
+		}
+		if !wanted[card_id] {
+			continue
+		}
+		var values []float64
+		if err := json.Unmarshal([]byte(vector), &values); err != nil {
+			return nil, fmt.Errorf("embedding of card %d: %w", card_id, err)
+		}
+		vectors[card_id] = values
+	}
+	return vectors, rows.Err()
+}
+
+// AddEmbeddings records the vectors of cards computed by model, replacing
+// any stored before.
+func (s *Store) AddEmbeddings(model string, vectors map[int64][]float64) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	for card_id, vector := range vectors {
+		data, err := json.Marshal(vector)
+		if err != nil {
+			return err
+		}
+		if _, err := tx.Exec(
+			"INSERT OR REPLACE INTO embeddings (card_id, model, vector) VALUES (?, ?, ?)",
+			card_id, model, string(data),
+		); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// Questions returns the cards without their ids and exports, for an exporter.
+func Questions(cards []Card) []ankify.AnkiQuestion {
+	questions := []ankify.AnkiQuestion{}
+	for _, card := range cards {
+		questions = append(questions, card.AnkiQuestion)
+	}
+	return questions
+}
+
+// IDs returns the ids of the cards.
+func IDs(cards []Card) []int64 {
+	ids := []int64{}
+	for _, card := range cards {
+		ids = append(ids, card.ID)
+	}
+	return ids
+}
@@ -0,0 +1,175 @@
+package store
+
+import (
+	"errors"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/acrucetta/anki-builder/pkg/ankify"
+)
+
+func openTestStore(t *testing.T) *Store {
+	t.Helper()
+	store, err := Open(filepath.Join(t.TempDir(), "data", "ankify.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { store.Close() })
+	return store
+}
+
+func TestStoreRuns(t *testing.T) {
+
+	// Arrange
+	store := openTestStore(t)
+	store.now = func() time.Time { return time.Date(2026, 10, 1, 12, 0, 0, 0, time.UTC) }
+	source := ankify.Source{Document: "go.pdf", Page: 3, Section: "Intro", Chunk: 1}
+	cards := []ankify.AnkiQuestion{
+		{Question: "What is Go?", Answer: "A language", Tag: "go  intro", Source: source},
+		{Question: "Who wrote Go?", Answer: "Google", Type: ankify.CARD_TYPE_MULTIPLE_CHOICE, Choices: &ankify.MultipleChoice{Distractors: []string{"Apple", "IBM"}}, Source: source},
+	}
+
+	// Act
+	run_id, err := store.StartRun(Run{Document: "go.pdf", FileType: "pdf", Provider: "ollama", Model: "llama3", PromptVersion: "abc", CardType: ankify.CARD_TYPE_BASIC})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := store.AddChunk(run_id, source, "Go is a language."); err != nil {
+		t.Fatal(err)
+	}
+	ids, err := store.AddCards(run_id, cards)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := store.MarkExported(ids[:1], "csv", "output/cards.csv"); err != nil {
+		t.Fatal(err)
+	}
+
+	// Assert
+	run, err := store.Run(run_id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if run.Document != "go.pdf" || run.Model != "llama3" || run.PromptVersion != "abc" || run.Cards != 2 || run.Exported != 1 {
+		t.Errorf("Unexpected run %+v", run)
+	}
+	if !run.StartedAt.Equal(store.now()) {
+		t.Errorf("Expected the run to start at %v, got %v", store.now(), run.StartedAt)
+	}
+
+	chunks, err := store.Chunks(run_id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(chunks) != 1 || chunks[0].Source != source || chunks[0].Text != "Go is a language." {
+		t.Errorf("Unexpected chunks %+v", chunks)
+	}
+
+	stored, err := store.Cards(CardFilter{RunID: run_id})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(stored) != 2 || stored[0].Tag != "go intro" || stored[0].Source != source || stored[0].Type != ankify.CARD_TYPE_BASIC {
+		t.Fatalf("Unexpected cards %+v", stored)
+	}
+	if len(stored[0].Exports) != 1 || stored[0].Exports[0].Destination != "output/cards.csv" || len(stored[1].Exports) != 0 {
+		t.Errorf("Unexpected exports %+v, %+v", stored[0].Exports, stored[1].Exports)
+	}
+	if stored[1].Choices == nil || len(stored[1].Choices.Distractors) != 2 {
+		t.Errorf("Expected the distractors to be kept, got %+v", stored[1])
+	}
+	if _, err := store.Run(run_id + 1); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Expected ErrNotFound, got %v", err)
+	}
+}
+
+func TestStoreCardFilter(t *testing.T) {
+
+	// Arrange
+	store := openTestStore(t)
+	day := time.Date(2026, 10, 1, 0, 0, 0, 0, time.UTC)
+	for i, document := range []string{"a.txt", "b.txt", "a.txt"} {
+		store.now = func() time.Time { return day.AddDate(0, 0, i) }
+		run_id, err := store.StartRun(Run{Document: document, FileType: "txt", CardType: ankify.CARD_TYPE_BASIC})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := store.AddCards(run_id, []ankify.AnkiQuestion{{Question: document, Answer: "x"}}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := store.MarkExported([]int64{3}, "apkg", "output/a.apkg"); err != nil {
+		t.Fatal(err)
+	}
+
+	// Act
+	since, err := store.Cards(CardFilter{Since: day.AddDate(0, 0, 1)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	unexported, err := store.Cards(CardFilter{Unexported: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	runs, err := store.Runs()
+	if err != nil {
+		t.Fatal(err)
+	}
+	document, err := store.Cards(CardFilter{Document: "a.txt", Unexported: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Assert
+	if len(since) != 2 || since[0].ID != 2 || since[1].ID != 3 {
+		t.Errorf("Expected cards 2 and 3, got %+v", since)
+	}
+	if len(unexported) != 2 || unexported[0].ID != 1 || unexported[1].ID != 2 {
+		t.Errorf("Expected cards 1 and 2, got %+v", unexported)
+	}
+	if len(runs) != 3 || runs[0].ID != 3 || runs[0].Document != "a.txt" {
+		t.Errorf("Expected the latest run first, got %+v", runs)
+	}
+	if len(document) != 1 || document[0].ID != 1 {
+		t.Errorf("Expected card 1, got %+v", document)
+	}
+}
+
+func TestStoreEmbeddings(t *testing.T) {
+
+	// Arrange
+	store := openTestStore(t)
+	run_id, err := store.StartRun(Run{Document: "a.txt", FileType: "txt", CardType: ankify.CARD_TYPE_BASIC})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ids, err := store.AddCards(run_id, []ankify.AnkiQuestion{{Question: "Q1", Answer: "A1"}, {Question: "Q2", Answer: "A2"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Act
+	if err := store.AddEmbeddings("ollama/nomic", map[int64][]float64{ids[0]: {0.1, 0.2}}); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.AddEmbeddings("ollama/nomic", map[int64][]float64{ids[0]: {0.3, 0.4}}); err != nil {
+		t.Fatal(err)
+	}
+	vectors, err := store.Embeddings("ollama/nomic", ids)
+	if err != nil {
+		t.Fatal(err)
+	}
+	other, err := store.Embeddings("openai/text-embedding-3-small", ids)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Assert
+	if len(vectors) != 1 || len(vectors[ids[0]]) != 2 || vectors[ids[0]][1] != 0.4 {
+		t.Errorf("Expected the replaced vector of card %d, got %v", ids[0], vectors)
+	}
+	if len(other) != 0 {
+		t.Errorf("Expected no vectors for another model, got %v", other)
+	}
+}
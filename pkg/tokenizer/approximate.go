@@ -0,0 +1,37 @@
+package tokenizer
+
+import "unicode/utf8"
+
+// Approximate estimates tokens without a vocabulary: text is pre-tokenized
+// like cl100k_base and every piece counts as one token per 4 characters.
+// It is used when no rank file is available for the model's encoding.
+type Approximate struct{}
+
+func (Approximate) Name() string {
+	return "approximate"
+}
+
+func (a Approximate) Count(text string) int {
+	count := 0
+	for _, piece := range pretokenize(text) {
+		count += (utf8.RuneCountInString(piece) + 3) / 4
+	}
+	return count
+}
+
+func (Approximate) Split(text string) []string {
+	var tokens []string
+	for _, piece := range pretokenize(text) {
+		for len(piece) > 0 {
+			end, runes := 0, 0
+			for end < len(piece) && runes < 4 {
+				_, size := utf8.DecodeRuneInString(piece[end:])
+				end += size
+				runes++
+			}
+			tokens = append(tokens, piece[:end])
+			piece = piece[end:]
+		}
+	}
+	return tokens
+}
@@ -0,0 +1,125 @@
+package tokenizer
+
+import (
+	"bufio"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// BPE is a byte-level byte pair encoder using tiktoken-style merge ranks.
+type BPE struct {
+	name    string
+	split   func(string) []string
+	ranks   map[string]int
+	decoder map[int]string
+}
+
+// LoadBPE reads a .tiktoken rank file: one "<base64 token> <rank>" pair per line.
+// name selects the encoding's pre-tokenization pattern.
+func LoadBPE(name string, r io.Reader) (*BPE, error) {
+	bpe := &BPE{name: name, split: pretokenizerFor(name), ranks: make(map[string]int), decoder: make(map[int]string)}
+	scanner := bufio.NewScanner(r)
+	for line_number := 1; scanner.Scan(); line_number++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+		fields := strings.Fields(line)
+		if len(fields) != 2 {
+			return nil, fmt.Errorf("%s line %d: expected '<token> <rank>', got %q", name, line_number, line)
+		}
+		token, err := base64.StdEncoding.DecodeString(fields[0])
+		if err != nil {
+			return nil, fmt.Errorf("%s line %d: %w", name, line_number, err)
+		}
+		rank, err := strconv.Atoi(fields[1])
+		if err != nil {
+			return nil, fmt.Errorf("%s line %d: %w", name, line_number, err)
+		}
+		bpe.ranks[string(token)] = rank
+		bpe.decoder[rank] = string(token)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if len(bpe.ranks) == 0 {
+		return nil, fmt.Errorf("%s: no tokens found", name)
+	}
+	return bpe, nil
+}
+
+func (b *BPE) Name() string {
+	return b.name
+}
+
+// Encode returns the token ranks of text.
+func (b *BPE) Encode(text string) []int {
+	var tokens []int
+	for _, piece := range b.split(text) {
+		for _, part := range b.merge(piece) {
+			rank, ok := b.ranks[part]
+			if !ok {
+				// Every single byte is a token in a complete vocabulary; a
+				// partial one still has to produce something countable.
+				rank = -1
+			}
+			tokens = append(tokens, rank)
+		}
+	}
+	return tokens
+}
+
+// Decode returns the text of the given token ranks.
+func (b *BPE) Decode(tokens []int) string {
+	var builder strings.Builder
+	for _, token := range tokens {
+		builder.WriteString(b.decoder[token])
+	}
+	return builder.String()
+}
+
+func (b *BPE) Count(text string) int {
+	count := 0
+	for _, piece := range b.split(text) {
+		count += len(b.merge(piece))
+	}
+	return count
+}
+
+func (b *BPE) Split(text string) []string {
+	var tokens []string
+	for _, piece := range b.split(text) {
+		tokens = append(tokens, b.merge(piece)...)
+	}
+	return tokens
+}
+
+// merge splits a piece into single bytes and repeatedly joins the adjacent
+// pair with the lowest rank until no pair is in the vocabulary.
+func (b *BPE) merge(piece string) []string {
+	if _, ok := b.ranks[piece]; ok {
+		return []string{piece}
+	}
+	parts := make([]string, len(piece))
+	for i := 0; i < len(piece); i++ {
+		parts[i] = piece[i : i+1]
+	}
+	for len(parts) > 1 {
+		best_index, best_rank := -1, 0
+		for i := 0; i < len(parts)-1; i++ {
+			rank, ok := b.ranks[parts[i]+parts[i+1]]
+			if ok && (best_index < 0 || rank < best_rank) {
+				best_index, best_rank = i, rank
+			}
+		}
+		if best_index < 0 {
+			break
+		}
+		parts[best_index] += parts[best_index+1]
+		parts = append(parts[:best_index+1], parts[best_index+2:]...)
+	}
+	return parts
+}
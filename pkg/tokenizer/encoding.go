@@ -0,0 +1,78 @@
+package tokenizer
+
+import (
+	"embed"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// encodings holds the rank files compiled into the binary, see encodings/README.md.
+//
+//go:embed encodings
+var encodings embed.FS
+
+// DEFAULT_ENCODING is used for models that are not recognized.
+const DEFAULT_ENCODING = "cl100k_base"
+
+var (
+	cache   = make(map[string]Tokenizer)
+	cacheMu sync.Mutex
+)
+
+// EncodingForModel returns the name of the encoding used by model.
+func EncodingForModel(model string) string {
+	model = strings.ToLower(model)
+	switch {
+	case strings.HasPrefix(model, "gpt-4o"), strings.HasPrefix(model, "o1"), strings.HasPrefix(model, "o3"), strings.HasPrefix(model, "gpt-4.1"):
+		return "o200k_base"
+	case strings.HasPrefix(model, "text-davinci"), strings.HasPrefix(model, "code-"):
+		return "p50k_base"
+	default:
+		return DEFAULT_ENCODING
+	}
+}
+
+// ForModel returns the tokenizer for model's encoding.
+func ForModel(model string) Tokenizer {
+	return Get(EncodingForModel(model))
+}
+
+// Get returns the tokenizer for the named encoding, loading its rank file from
+// the embedded encodings or from ANKIFY_TOKENIZER_DIR. If neither has it, Get
+// logs a warning once and returns an Approximate tokenizer.
+func Get(encoding string) Tokenizer {
+	cacheMu.Lock()
+	defer cacheMu.Unlock()
+	if tokenizer, ok := cache[encoding]; ok {
+		return tokenizer
+	}
+
+	tokenizer, err := load(encoding)
+	if err != nil {
+		log.Printf("No %s rank file available (%v), token counts are approximate.", encoding, err)
+		tokenizer = Approximate{}
+	}
+	cache[encoding] = tokenizer
+	return tokenizer
+}
+
+func load(encoding string) (Tokenizer, error) {
+	file_name := encoding + ".tiktoken"
+	if f, err := encodings.Open("encodings/" + file_name); err == nil {
+		defer f.Close()
+		return LoadBPE(encoding, f)
+	}
+	dir := os.Getenv("ANKIFY_TOKENIZER_DIR")
+	if dir == "" {
+		return nil, os.ErrNotExist
+	}
+	f, err := os.Open(filepath.Join(dir, file_name))
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return LoadBPE(encoding, f)
+}
@@ -0,0 +1,188 @@
+package tokenizer
+
+import (
+	"regexp"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// splitPatterns holds the pre-tokenization patterns of the encodings other
+// than cl100k_base, anchored and without the trailing `\s+(?!\S)|\s+`
+// alternatives, which splitWhitespace implements instead.
+var splitPatterns = map[string]*regexp.Regexp{
+	// 's|'t|'re|'ve|'m|'ll|'d| ?\p{L}+| ?\p{N}+| ?[^\s\p{L}\p{N}]+|\s+(?!\S)|\s+
+	"p50k_base": regexp.MustCompile(`^(?:'s|'t|'re|'ve|'m|'ll|'d| ?\p{L}+| ?\p{N}+| ?[^\s\p{L}\p{N}]+)`),
+	"r50k_base": regexp.MustCompile(`^(?:'s|'t|'re|'ve|'m|'ll|'d| ?\p{L}+| ?\p{N}+| ?[^\s\p{L}\p{N}]+)`),
+	"o200k_base": regexp.MustCompile(`^(?:` +
+		`[^\r\n\p{L}\p{N}]?[\p{Lu}\p{Lt}\p{Lm}\p{Lo}\p{M}]*[\p{Ll}\p{Lm}\p{Lo}\p{M}]+(?i:'s|'t|'re|'ve|'m|'ll|'d)?|` +
+		`[^\r\n\p{L}\p{N}]?[\p{Lu}\p{Lt}\p{Lm}\p{Lo}\p{M}]+[\p{Ll}\p{Lm}\p{Lo}\p{M}]*(?i:'s|'t|'re|'ve|'m|'ll|'d)?|` +
+		`\p{N}{1,3}| ?[^\s\p{L}\p{N}]+[\r\n/]*|\s*[\r\n]+)`),
+}
+
+// pretokenizerFor returns the split function of the named encoding. Unknown
+// encodings are split like cl100k_base.
+func pretokenizerFor(encoding string) func(string) []string {
+	pattern, ok := splitPatterns[encoding]
+	if !ok {
+		return pretokenize
+	}
+	return func(text string) []string {
+		var pieces []string
+		for len(text) > 0 {
+			n := 0
+			if match := pattern.FindStringIndex(text); match != nil {
+				n = match[1]
+			}
+			if n == 0 {
+				n = splitWhitespace(text)
+			}
+			if n == 0 {
+				_, n = utf8.DecodeRuneInString(text)
+			}
+			pieces = append(pieces, text[:n])
+			text = text[n:]
+		}
+		return pieces
+	}
+}
+
+// contractions are matched case-insensitively right after an apostrophe.
+var contractions = []string{"s", "t", "re", "ve", "m", "ll", "d"}
+
+// pretokenize splits text into the pieces BPE merges are applied to. It
+// follows the cl100k_base pattern:
+//
+//	(?i:'s|'t|'re|'ve|'m|'ll|'d)|[^\r\n\p{L}\p{N}]?\p{L}+|\p{N}{1,3}| ?[^\s\p{L}\p{N}]+[\r\n]*|\s*[\r\n]+|\s+(?!\S)|\s+
+//
+// hand-written because Go's regexp package has no lookahead.
+func pretokenize(text string) []string {
+	var pieces []string
+	for len(text) > 0 {
+		n := nextPiece(text)
+		pieces = append(pieces, text[:n])
+		text = text[n:]
+	}
+	return pieces
+}
+
+// nextPiece returns the byte length of the piece at the start of text.
+func nextPiece(text string) int {
+	r, size := utf8.DecodeRuneInString(text)
+
+	// (?i:'s|'t|'re|'ve|'m|'ll|'d)
+	if r == '\'' {
+		for _, contraction := range contractions {
+			end := size + len(contraction)
+			if len(text) >= end && strings.EqualFold(text[size:end], contraction) {
+				return end
+			}
+		}
+	}
+
+	// [^\r\n\p{L}\p{N}]?\p{L}+
+	if unicode.IsLetter(r) {
+		return size + letters(text[size:])
+	}
+	if r != '\r' && r != '\n' && !unicode.IsNumber(r) {
+		if n := letters(text[size:]); n > 0 {
+			return size + n
+		}
+	}
+
+	// \p{N}{1,3}
+	if unicode.IsNumber(r) {
+		n := size
+		for i := 1; i < 3 && n < len(text); i++ {
+			next, next_size := utf8.DecodeRuneInString(text[n:])
+			if !unicode.IsNumber(next) {
+				break
+			}
+			n += next_size
+		}
+		return n
+	}
+
+	// ` ?[^\s\p{L}\p{N}]+[\r\n]*`
+	start := 0
+	if r == ' ' {
+		start = size
+	}
+	if n := punctuation(text[start:]); n > 0 {
+		n += start
+		for n < len(text) && (text[n] == '\r' || text[n] == '\n') {
+			n++
+		}
+		return n
+	}
+
+	// \s*[\r\n]+
+	spaces := 0
+	last_newline := -1
+	for spaces < len(text) {
+		next, next_size := utf8.DecodeRuneInString(text[spaces:])
+		if !unicode.IsSpace(next) {
+			break
+		}
+		if next == '\r' || next == '\n' {
+			last_newline = spaces + next_size
+		}
+		spaces += next_size
+	}
+	if last_newline > 0 {
+		return last_newline
+	}
+	if spaces == 0 {
+		return size
+	}
+	return splitWhitespace(text)
+}
+
+// splitWhitespace returns the byte length matched by `\s+(?!\S)|\s+` at the
+// start of text, or 0 if text does not start with whitespace.
+func splitWhitespace(text string) int {
+	spaces := 0
+	for spaces < len(text) {
+		next, next_size := utf8.DecodeRuneInString(text[spaces:])
+		if !unicode.IsSpace(next) {
+			break
+		}
+		spaces += next_size
+	}
+	if spaces == len(text) {
+		return spaces
+	}
+	// Leave the last space to the following word, like " hello".
+	_, last_size := utf8.DecodeLastRuneInString(text[:spaces])
+	if spaces > last_size {
+		return spaces - last_size
+	}
+	return spaces
+}
+
+// letters returns the byte length of the run of letters at the start of text.
+func letters(text string) int {
+	n := 0
+	for n < len(text) {
+		r, size := utf8.DecodeRuneInString(text[n:])
+		if !unicode.IsLetter(r) {
+			break
+		}
+		n += size
+	}
+	return n
+}
+
+// punctuation returns the byte length of the run at the start of text that is
+// neither whitespace, letters nor numbers.
+func punctuation(text string) int {
+	n := 0
+	for n < len(text) {
+		r, size := utf8.DecodeRuneInString(text[n:])
+		if unicode.IsSpace(r) || unicode.IsLetter(r) || unicode.IsNumber(r) {
+			break
+		}
+		n += size
+	}
+	return n
+}
@@ -0,0 +1,44 @@
+// Package tokenizer counts and splits text in model tokens, so prompt budgets
+// are computed the way the model sees the text rather than by byte length.
+package tokenizer
+
+import (
+	"strings"
+	"unicode/utf8"
+)
+
+// Tokenizer splits text into model tokens.
+type Tokenizer interface {
+	// Name identifies the encoding, e.g. "cl100k_base".
+	Name() string
+	// Count returns the number of tokens in text.
+	Count(text string) int
+	// Split returns the tokens of text as strings; joining them gives back text.
+	Split(text string) []string
+}
+
+// Truncate returns the longest prefix of text that fits in max_tokens tokens.
+// The cut falls on a token boundary and never inside a UTF-8 character.
+func Truncate(t Tokenizer, text string, max_tokens int) string {
+	if max_tokens <= 0 {
+		return ""
+	}
+	tokens := t.Split(text)
+	if len(tokens) <= max_tokens {
+		return text
+	}
+	return trimIncompleteRune(strings.Join(tokens[:max_tokens], ""))
+}
+
+// trimIncompleteRune drops a trailing partial UTF-8 sequence, which byte-level
+// BPE tokens can leave at a token boundary.
+func trimIncompleteRune(text string) string {
+	for i := 0; i < utf8.UTFMax && len(text) > 0; i++ {
+		r, size := utf8.DecodeLastRuneInString(text)
+		if r != utf8.RuneError || size != 1 {
+			break
+		}
+		text = text[:len(text)-1]
+	}
+	return text
+}
@@ -0,0 +1,169 @@
+package tokenizer
+
+import (
+	"encoding/base64"
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+	"unicode/utf8"
+)
+
+// testBPE builds a vocabulary with every single byte followed by the given merges, in rank order.
+func testBPE(t *testing.T, merges ...string) *BPE {
+	var builder strings.Builder
+	rank := 0
+	for i := 0; i < 256; i++ {
+		fmt.Fprintf(&builder, "%s %d\n", base64.StdEncoding.EncodeToString([]byte{byte(i)}), rank)
+		rank++
+	}
+	for _, merge := range merges {
+		fmt.Fprintf(&builder, "%s %d\n", base64.StdEncoding.EncodeToString([]byte(merge)), rank)
+		rank++
+	}
+	bpe, err := LoadBPE("test", strings.NewReader(builder.String()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return bpe
+}
+
+func TestPretokenize(t *testing.T) {
+	tests := map[string][]string{
+		"Hello world":           {"Hello", " world"},
+		"I'm here, aren't you?": {"I", "'m", " here", ",", " aren", "'t", " you", "?"},
+		"Year 20231!":           {"Year", " ", "202", "31", "!"},
+		"one  two\n\nthree":     {"one", " ", " two", "\n\n", "three"},
+		"(café) déjà vu":        {"(café", ")", " déjà", " vu"},
+		"end   ":                {"end", "   "},
+		"":                      nil,
+	}
+	for text, expected := range tests {
+		if got := pretokenize(text); !reflect.DeepEqual(got, expected) {
+			t.Errorf("pretokenize(%q) = %q, expected %q", text, got, expected)
+		}
+	}
+}
+
+func TestPretokenizeEncodings(t *testing.T) {
+	tests := map[string]map[string][]string{
+		"o200k_base": {
+			"camelCase HTTPServer": {"camel", "Case", " HTTPServer"},
+			"World's 12345":        {"World's", " ", "123", "45"},
+			"a //\ny":              {"a", " //\n", "y"},
+		},
+		"p50k_base": {
+			"Hello  world 12345!": {"Hello", " ", " world", " 12345", "!"},
+			"I'M here":            {"I", "'", "M", " here"},
+			"end\n\n":             {"end", "\n\n"},
+		},
+	}
+	for encoding, cases := range tests {
+		split := pretokenizerFor(encoding)
+		for text, expected := range cases {
+			if got := split(text); !reflect.DeepEqual(got, expected) {
+				t.Errorf("%s: pretokenize(%q) = %q, expected %q", encoding, text, got, expected)
+			}
+		}
+	}
+}
+
+func TestGetCountsWithEmbeddedEncoding(t *testing.T) {
+
+	// Arrange
+	if _, err := encodings.Open("encodings/" + DEFAULT_ENCODING + ".tiktoken"); err != nil {
+		t.Skipf("%s.tiktoken is not in encodings/, see encodings/README.md", DEFAULT_ENCODING)
+	}
+	t.Setenv("ANKIFY_TOKENIZER_DIR", "")
+
+	// Act
+	tokenizer := Get(DEFAULT_ENCODING)
+
+	// Assert
+	if _, ok := tokenizer.(*BPE); !ok {
+		t.Fatalf("Expected the embedded rank file to be loaded, got %T", tokenizer)
+	}
+	if count := tokenizer.Count("hello world"); count != 2 {
+		t.Errorf("Expected 2 tokens, got %d", count)
+	}
+}
+
+func TestBPEMerges(t *testing.T) {
+
+	// Arrange
+	bpe := testBPE(t, "ab", "cd", "abcd", " a")
+
+	// Act
+	split := bpe.Split("abcd abcde")
+	tokens := bpe.Encode("abcd abcde")
+
+	// Assert
+	// " abcde" merges "ab" (the lowest rank) first, so " a" never applies
+	expected := []string{"abcd", " ", "abcd", "e"}
+	if !reflect.DeepEqual(split, expected) {
+		t.Errorf("Expected %q, got %q", expected, split)
+	}
+	if bpe.Count("abcd abcde") != 4 {
+		t.Errorf("Expected 4 tokens, got %d", bpe.Count("abcd abcde"))
+	}
+	if bpe.Decode(tokens) != "abcd abcde" {
+		t.Errorf("Expected the text back, got %q", bpe.Decode(tokens))
+	}
+}
+
+func TestTruncateKeepsRunesWhole(t *testing.T) {
+
+	// Arrange
+	bpe := testBPE(t)
+	text := "日本語"
+
+	// Act
+	truncated := Truncate(bpe, text, 4)
+
+	// Assert
+	if !utf8.ValidString(truncated) {
+		t.Errorf("Expected valid UTF-8, got %q", truncated)
+	}
+	if truncated != "日" {
+		t.Errorf("Expected only the first character, got %q", truncated)
+	}
+	if Truncate(bpe, text, 100) != text {
+		t.Error("Expected text within the budget to be unchanged")
+	}
+}
+
+func TestApproximate(t *testing.T) {
+
+	// Arrange
+	text := "The mitochondria is the powerhouse of the cell."
+
+	approximate := Approximate{}
+
+	// Act
+	tokens := approximate.Split(text)
+
+	// Assert
+	if strings.Join(tokens, "") != text {
+		t.Errorf("Expected the tokens to join back into the text, got %q", tokens)
+	}
+	if len(tokens) != approximate.Count(text) {
+		t.Errorf("Expected Count and Split to agree, got %d and %d", approximate.Count(text), len(tokens))
+	}
+	if Truncate(approximate, text, 2) != "The mit" {
+		t.Errorf("Unexpected truncation %q", Truncate(approximate, text, 2))
+	}
+}
+
+func TestEncodingForModel(t *testing.T) {
+	tests := map[string]string{
+		"gpt-3.5-turbo":    "cl100k_base",
+		"gpt-4o-mini":      "o200k_base",
+		"text-davinci-003": "p50k_base",
+		"llama3":           "cl100k_base",
+	}
+	for model, expected := range tests {
+		if got := EncodingForModel(model); got != expected {
+			t.Errorf("EncodingForModel(%q) = %q, expected %q", model, got, expected)
+		}
+	}
+}